@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+
+	"qr-linker/auth"
+	"qr-linker/database"
+)
+
+// adminDashboardListSize is the number of entries in each list on the admin
+// dashboard.
+const adminDashboardListSize = 10
+
+// AdminDashboardData is passed to the admin dashboard template.
+type AdminDashboardData struct {
+	Title    string
+	Username string
+	Users    int
+	Stats    *database.DashboardStats
+	// BrokenLinks lists up to adminDashboardListSize of the BrokenCount
+	// links whose last check failed, most recently checked first.
+	BrokenLinks    []database.URLWithCreator
+	BrokenCount    int
+	RecentClicks   []database.RecentClick
+	RecentActivity []database.AuditEntry
+	StorageSize    string
+	ClickTracking  bool
+}
+
+// adminDashboardHandler serves /admin/dashboard, an overview of the whole
+// instance: users, links, clicks, broken links, recent clicks and audit
+// entries, and the database size. Like the other /admin/ pages it's wrapped
+// in requireUnrestricted.
+func adminDashboardHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	data := AdminDashboardData{
+		Title:         "Dashboard - QR Linker",
+		ClickTracking: clickTracking,
+	}
+	_, data.Username, _ = auth.GetUserFromSession(r)
+
+	var err error
+	if data.Users, err = db.CountUsers(); err != nil {
+		log.Printf("Error counting users: %v", err)
+		respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to load the dashboard")
+		return
+	}
+
+	stats, ok := dashboardCache.Get(0)
+	if !ok {
+		if stats, err = db.GetDashboardStats(0); err != nil {
+			log.Printf("Error fetching dashboard stats: %v", err)
+			respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to load the dashboard")
+			return
+		}
+		dashboardCache.Set(0, stats)
+	}
+	data.Stats = stats
+
+	broken, err := db.GetURLsByHealth(database.HealthBroken)
+	if err != nil {
+		log.Printf("Error fetching broken links: %v", err)
+	}
+	data.BrokenCount = len(broken)
+	data.BrokenLinks = broken[:min(len(broken), adminDashboardListSize)]
+
+	if clickTracking {
+		if data.RecentClicks, err = db.GetRecentClicks(adminDashboardListSize); err != nil {
+			log.Printf("Error fetching recent clicks: %v", err)
+		}
+	}
+
+	if data.RecentActivity, err = db.GetAuditLog(adminDashboardListSize); err != nil {
+		log.Printf("Error fetching audit log: %v", err)
+	}
+
+	if size, err := db.StorageSize(); err != nil {
+		log.Printf("Error reading database size: %v", err)
+	} else {
+		data.StorageSize = formatBytes(size)
+	}
+
+	tmpl, err := template.ParseFS(templatesFS, "templates/dashboard.html")
+	if err != nil {
+		http.Error(w, "Error loading template", http.StatusInternalServerError)
+		log.Printf("Template error: %v", err)
+		return
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Render error: %v", err)
+	}
+}
+
+// formatBytes writes a size in bytes, KiB, MiB or GiB.
+func formatBytes(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	size := float64(n) / 1024
+	for _, unit := range []string{"KiB", "MiB"} {
+		if size < 1024 {
+			return fmt.Sprintf("%.1f %s", size, unit)
+		}
+		size /= 1024
+	}
+	return fmt.Sprintf("%.1f GiB", size)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"qr-linker/auth"
+	"qr-linker/database"
+	"qr-linker/utils"
+)
+
+// errAliasDestination is returned when a request tries to change an alias's
+// destination directly.
+const errAliasDestination = "Aliases follow their canonical link's destination; edit that link instead"
+
+// resolveAlias returns the link an alias stands for: the alias itself with
+// its canonical link's destination and title. Other links are returned
+// unchanged. The canonical link is always read from the database, so edits
+// to it apply to its aliases straight away even when the alias is cached.
+func resolveAlias(url *database.URL) (*database.URL, error) {
+	if url.AliasOf == 0 {
+		return url, nil
+	}
+	canonical, err := db.GetURLByID(url.AliasOf)
+	if err != nil {
+		return nil, err
+	}
+	alias := *url
+	alias.FullURL = canonical.FullURL
+	alias.Title = canonical.Title
+	return &alias, nil
+}
+
+// createAliasHandler adds an alias to an existing link: another hash that
+// redirects to the same destination and whose clicks count towards the
+// link's stats. The alias hash is taken from the alias form value, or
+// generated when it's empty.
+func createAliasHandler(w http.ResponseWriter, r *http.Request, shortHash string) {
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		if isBodyTooLarge(err) {
+			respondError(w, r, http.StatusRequestEntityTooLarge, errCodeBodyTooLarge, "Request body too large")
+			return
+		}
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid form data")
+		return
+	}
+
+	canonical, err := lookupURL(shortHash)
+	if err != nil {
+		respondError(w, r, http.StatusNotFound, errCodeNotFound, "Short link not found")
+		return
+	}
+
+	userPrefix, err := userHashPrefix(r)
+	if err != nil {
+		log.Printf("Error looking up hash prefix: %v", err)
+		respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to create alias")
+		return
+	}
+
+	aliasHash := r.FormValue("alias")
+	if aliasHash == "" {
+		generatePrefix := ""
+		if userPrefix != "" {
+			generatePrefix = userPrefix + utils.PrefixSeparator
+		}
+		aliasHash, err = generateHash(generatePrefix)
+		if err != nil {
+			log.Printf("Error generating hash: %v", err)
+			respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to generate alias")
+			return
+		}
+	} else {
+		if err := utils.ValidateHash(aliasHash); err != nil {
+			respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
+			return
+		}
+		if err := checkHashPrefix(userPrefix, aliasHash); err != nil {
+			respondError(w, r, http.StatusForbidden, errCodeInvalidRequest, err.Error())
+			return
+		}
+		exists, err := hashExists(aliasHash)
+		if err != nil {
+			respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Error checking hash")
+			return
+		}
+		if exists {
+			respondError(w, r, http.StatusConflict, errCodeHashTaken, "Hash is already taken")
+			return
+		}
+	}
+
+	userID, _, _ := auth.GetUserFromSession(r)
+
+	alias, err := db.CreateAlias(canonical.ShortHash, aliasHash, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, r, http.StatusNotFound, errCodeNotFound, "Short link not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating alias %s of %s: %v", aliasHash, canonical.ShortHash, err)
+		respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to create alias")
+		return
+	}
+	counters.addLink()
+	if !utils.ValidateChecksum(alias.ShortHash) {
+		uncheckedHashes.add(alias.ShortHash)
+	}
+
+	recordAudit(r, database.AuditAliasCreated, alias.ShortHash+" -> "+canonical.ShortHash)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"short_url": shortURLFor(alias),
+		"url":       alias,
+	})
+}
@@ -0,0 +1,927 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"qr-linker/auth"
+	"qr-linker/cache"
+	"qr-linker/database"
+	"qr-linker/httpclient"
+	"qr-linker/importer"
+	"qr-linker/openapi"
+	"qr-linker/preview"
+	"qr-linker/qrgen"
+	"qr-linker/utils"
+)
+
+// dashboardCacheTTL is how long dashboard stats are reused, so frequent
+// polling from a widget doesn't rerun the aggregate queries every time.
+const dashboardCacheTTL = 10 * time.Second
+
+// dashboardCache holds recent dashboard stats keyed by user ID (0 for the
+// site-wide figures).
+var dashboardCache = cache.New[int, *database.DashboardStats](dashboardCacheTTL, 100)
+
+// maxBulkUpdateSize caps the number of links in one bulk update request.
+const maxBulkUpdateSize = 500
+
+// maxBulkTitleRows caps the number of rows in one bulk title CSV.
+const maxBulkTitleRows = 5000
+
+// maxQRBatchSize caps the number of hashes in one batch QR request.
+const maxQRBatchSize = 100
+
+// maxSrcsetSizes caps the number of sizes in one srcset request.
+const maxSrcsetSizes = 8
+
+// qrBatchRequest is the body of POST /api/v1/qr/batch.
+type qrBatchRequest struct {
+	Hashes []string `json:"hashes"`
+	Size   int      `json:"size"`
+	Format string   `json:"format"`
+	FG     string   `json:"fg"`
+	BG     string   `json:"bg"`
+	Style  string   `json:"style"`
+}
+
+// qrSheetRequest is the body of POST /api/v1/qr/batch/pdf.
+type qrSheetRequest struct {
+	Hashes  []string `json:"hashes"`
+	Page    string   `json:"page"`
+	Columns int      `json:"columns"`
+	Rows    int      `json:"rows"`
+	FG      string   `json:"fg"`
+	BG      string   `json:"bg"`
+	Style   string   `json:"style"`
+}
+
+// apiURLsHandler dispatches /api/v1/urls/<hash>/<action> requests.
+func apiURLsHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/urls/"), "/")
+	if len(parts) != 2 || parts[0] == "" {
+		respondError(w, r, http.StatusNotFound, errCodeNotFound, "Not found")
+		return
+	}
+
+	shortHash, action := parts[0], parts[1]
+	switch action {
+	case "qr.txt":
+		shortURLTextHandler(w, r, shortHash)
+	case "snippet":
+		snippetHandler(w, r, shortHash)
+	case "resolve":
+		auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+			resolveHandler(w, r, shortHash)
+		})(w, r)
+	case "aliases":
+		auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+			createAliasHandler(w, r, shortHash)
+		})(w, r)
+	case "edit-token":
+		auth.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+			editTokenHandler(w, r, shortHash)
+		})(w, r)
+	default:
+		respondError(w, r, http.StatusNotFound, errCodeNotFound, "Not found")
+	}
+}
+
+// openAPIHandler serves the OpenAPI description of the API. It's public so
+// client generators can fetch it without a session.
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(openapi.Spec)
+}
+
+// featuresHandler serves /api/v1/features, the public feature flags and
+// whether each is on, so pages can show or hide the matching controls.
+func featuresHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(featureFlags.Public()); err != nil {
+		log.Printf("Error encoding features: %v", err)
+	}
+}
+
+// shortURLTextHandler returns the plain short URL for easy copying in scripts.
+func shortURLTextHandler(w http.ResponseWriter, r *http.Request, shortHash string) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	url, err := lookupURL(shortHash)
+	if err != nil {
+		respondError(w, r, http.StatusNotFound, errCodeNotFound, "Short link not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(shortURLFor(url) + "\n"))
+}
+
+// markdownEscaper escapes the characters that would end a Markdown link text
+// early.
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`)
+
+// snippetHandler returns a ready-to-paste link to the short URL for
+// documentation: [title](short_url) with format=markdown (the default) or an
+// <a> tag with format=html. qr=1 adds an image of the link's QR code.
+func snippetHandler(w http.ResponseWriter, r *http.Request, shortHash string) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "markdown" && format != "html" {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid format (use markdown or html)")
+		return
+	}
+	withQR := r.URL.Query().Get("qr") == "1"
+
+	url, err := lookupURL(shortHash)
+	if err == nil {
+		url, err = resolveAlias(url)
+	}
+	if err != nil {
+		respondError(w, r, http.StatusNotFound, errCodeNotFound, "Short link not found")
+		return
+	}
+
+	shortURL := shortURLFor(url)
+	title := linkTitle(url.Title, url.FullURL)
+	qrURL := os.Getenv("_INTERNAL_BASE_URL") + "/qr/" + url.ShortHash
+
+	var snippet string
+	if format == "html" {
+		snippet = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(shortURL), html.EscapeString(title)) + "\n"
+		if withQR {
+			snippet += fmt.Sprintf(`<img src="%s" alt="QR code for %s" width="%d" height="%d">`,
+				html.EscapeString(qrURL), html.EscapeString(title), qrDefaultSize, qrDefaultSize) + "\n"
+		}
+	} else {
+		snippet = fmt.Sprintf("[%s](%s)\n", markdownEscaper.Replace(title), shortURL)
+		if withQR {
+			snippet += fmt.Sprintf("![QR code for %s](%s)\n", markdownEscaper.Replace(title), qrURL)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(snippet))
+}
+
+// resolveClient performs destination checks. Redirects aren't followed so the
+// destination's own status is reported.
+var resolveClient = httpclient.New(false)
+
+// resolveResponse is the body of GET /api/v1/urls/<hash>/resolve.
+type resolveResponse struct {
+	ShortHash   string `json:"short_hash"`
+	Destination string `json:"destination"`
+	// Status and CheckError are only set when check=1 was requested.
+	Status     int    `json:"status,omitempty"`
+	Location   string `json:"location,omitempty"`
+	CheckError string `json:"check_error,omitempty"`
+}
+
+// resolveHandler returns a link's destination without counting a click, for
+// testing links while editing them. With check=1 it also sends a HEAD request
+// to the destination, reports the status code and stores it as the link's
+// health. Only http and https destinations are checked.
+func resolveHandler(w http.ResponseWriter, r *http.Request, shortHash string) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Aliases redirect to their canonical link's current destination.
+	url, err := lookupURL(shortHash)
+	if err == nil {
+		url, err = resolveAlias(url)
+	}
+	if err != nil {
+		respondError(w, r, http.StatusNotFound, errCodeNotFound, "Short link not found")
+		return
+	}
+
+	resp := resolveResponse{
+		ShortHash:   url.ShortHash,
+		Destination: url.FullURL,
+	}
+
+	if r.URL.Query().Get("check") == "1" && !httpDestination(url.FullURL) {
+		// mailto:, tel: and app links can't be checked, and aren't broken.
+		resp.CheckError = "Only http and https destinations can be checked"
+	} else if r.URL.Query().Get("check") == "1" {
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodHead, url.FullURL, nil)
+		if err == nil {
+			var res *http.Response
+			res, err = resolveClient.Do(req)
+			if err == nil {
+				res.Body.Close()
+				resp.Status = res.StatusCode
+				resp.Location = res.Header.Get("Location")
+			}
+		}
+		if err != nil {
+			resp.CheckError = err.Error()
+		}
+		// A refused check says nothing about whether the destination works.
+		if !errors.Is(err, httpclient.ErrBlockedAddress) {
+			if err := db.RecordCheck(url.ShortHash, resp.Status); err != nil {
+				log.Printf("Error recording check of %s: %v", url.ShortHash, err)
+			}
+			invalidateCachedURL(url.ShortHash)
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// httpDestination reports whether a destination is an http or https URL,
+// which can be checked with a HEAD request.
+func httpDestination(destination string) bool {
+	scheme, _, ok := strings.Cut(destination, ":")
+	return ok && (strings.EqualFold(scheme, "http") || strings.EqualFold(scheme, "https"))
+}
+
+// previewMetaHandler fetches a destination's title and Open Graph metadata,
+// used to prefill the title field of the shorten form.
+func previewMetaHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	target, err := utils.NormalizeURL(r.URL.Query().Get("url"), autoPrependScheme)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidURL, err.Error())
+		return
+	}
+
+	meta, err := preview.Fetch(r.Context(), target)
+	if err != nil {
+		if errors.Is(err, httpclient.ErrBlockedAddress) || errors.Is(err, preview.ErrNotHTML) || errors.Is(err, preview.ErrUnsupportedScheme) {
+			respondError(w, r, http.StatusBadRequest, errCodeInvalidURL, err.Error())
+			return
+		}
+		log.Printf("Error fetching preview of %s: %v", loggedURL(target), loggedError(err))
+		respondError(w, r, http.StatusBadGateway, errCodeFetchFailed, "Couldn't fetch the destination")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(meta)
+}
+
+// qrBatchHandler renders QR codes for several links with one set of options.
+// The response is a ZIP of <hash>.png files when the client accepts
+// application/zip, otherwise a JSON object mapping each hash to a base64 PNG.
+// QR views aren't counted since only logged-in users can call this.
+func qrBatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req qrBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isBodyTooLarge(err) {
+			respondError(w, r, http.StatusRequestEntityTooLarge, errCodeBodyTooLarge, "Request body too large")
+			return
+		}
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid JSON body")
+		return
+	}
+
+	if len(req.Hashes) == 0 {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "No hashes given")
+		return
+	}
+	if len(req.Hashes) > maxQRBatchSize {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, fmt.Sprintf("At most %d hashes per batch", maxQRBatchSize))
+		return
+	}
+
+	opts, err := batchQROptions(req)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
+		return
+	}
+
+	// Resolve every hash before rendering so a typo fails the whole batch
+	// rather than producing a partial result.
+	var urls []*database.URL
+	var missing []string
+	for _, h := range req.Hashes {
+		url, err := lookupURL(h)
+		if err != nil {
+			missing = append(missing, h)
+			continue
+		}
+		urls = append(urls, url)
+	}
+	if len(missing) > 0 {
+		respondError(w, r, http.StatusNotFound, errCodeNotFound, "Unknown hashes: "+strings.Join(missing, ", "))
+		return
+	}
+
+	hashes := make([]string, 0, len(urls))
+	images := make(map[string][]byte, len(urls))
+	for _, url := range urls {
+		png, err := qrgen.PNG(qrContentFor(url), opts)
+		if err != nil {
+			respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Error generating QR code")
+			return
+		}
+		hashes = append(hashes, url.ShortHash)
+		images[url.ShortHash] = png
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "application/zip") {
+		writeQRZip(w, hashes, images)
+		return
+	}
+
+	encoded := make(map[string]string, len(images))
+	for h, png := range images {
+		encoded[h] = base64.StdEncoding.EncodeToString(png)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(encoded)
+}
+
+// qrBatchPDFHandler renders QR cards for several links as a PDF for
+// printing: each link's code with its title above and short URL below, in a
+// grid of columns by rows per page (one card per page by default). Like
+// batch images, the cards aren't counted as QR views.
+func qrBatchPDFHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req qrSheetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isBodyTooLarge(err) {
+			respondError(w, r, http.StatusRequestEntityTooLarge, errCodeBodyTooLarge, "Request body too large")
+			return
+		}
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid JSON body")
+		return
+	}
+
+	if len(req.Hashes) == 0 {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "No hashes given")
+		return
+	}
+	if len(req.Hashes) > maxQRBatchSize {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, fmt.Sprintf("At most %d hashes per batch", maxQRBatchSize))
+		return
+	}
+
+	opts, err := sheetOptions(req)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
+		return
+	}
+
+	var cards []qrgen.SheetCard
+	var missing []string
+	for _, h := range req.Hashes {
+		url, err := lookupURL(h)
+		if err != nil {
+			missing = append(missing, h)
+			continue
+		}
+		cards = append(cards, qrgen.SheetCard{
+			Content: qrContentFor(url),
+			Title:   url.Title,
+			Caption: strings.TrimPrefix(strings.TrimPrefix(shortURLFor(url), "https://"), "http://"),
+		})
+	}
+	if len(missing) > 0 {
+		respondError(w, r, http.StatusNotFound, errCodeNotFound, "Unknown hashes: "+strings.Join(missing, ", "))
+		return
+	}
+
+	pdf, err := qrgen.SheetPDF(cards, opts)
+	if err != nil {
+		log.Printf("Error generating QR sheet: %v", err)
+		respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Error generating PDF")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `attachment; filename="qr-codes.pdf"`)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(pdf)
+}
+
+// sheetOptions validates the layout and styling options of a PDF request.
+// Layout errors, including grids too dense for the page, are reported here
+// so they get a 400 rather than failing during rendering.
+func sheetOptions(req qrSheetRequest) (qrgen.SheetOptions, error) {
+	qrOpts, err := batchQROptions(qrBatchRequest{FG: req.FG, BG: req.BG, Style: req.Style})
+	if err != nil {
+		return qrgen.SheetOptions{}, err
+	}
+
+	// Zero columns or rows mean the default of one; negative ones are left
+	// for ValidateSheetLayout to reject.
+	opts := qrgen.SheetOptions{QR: qrOpts, Columns: req.Columns, Rows: req.Rows}
+	if opts.Columns == 0 {
+		opts.Columns = 1
+	}
+	if opts.Rows == 0 {
+		opts.Rows = 1
+	}
+	if opts.PageSize, err = qrgen.ParsePageSize(req.Page); err != nil {
+		return opts, err
+	}
+	if err := qrgen.ValidateSheetLayout(opts); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// qrSrcset renders content at each of the comma-separated ?sizes= for
+// building an <img srcset>. The response is a ZIP of <hash>-<size>.png files
+// when the client accepts application/zip, otherwise a JSON object mapping
+// each size to a PNG data URI. Like data URIs, these aren't counted as views.
+func qrSrcset(w http.ResponseWriter, r *http.Request, shortHash, content string) {
+	query := r.URL.Query()
+	if query.Get("size") != "" || query.Get("dpi") != "" || query.Get("physical_mm") != "" {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Use sizes instead of size, dpi or physical_mm")
+		return
+	}
+	if format := query.Get("format"); format != "" && format != string(qrgen.FormatPNG) {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "srcset images are only available as PNG")
+		return
+	}
+
+	var sizes []int
+	for _, v := range strings.Split(query.Get("sizes"), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, fmt.Sprintf("Invalid size %q", v))
+			return
+		}
+		if err := qrgen.ValidateSize(size); err != nil {
+			respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
+			return
+		}
+		if !slices.Contains(sizes, size) {
+			sizes = append(sizes, size)
+		}
+	}
+	if len(sizes) == 0 {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "No sizes given")
+		return
+	}
+	if len(sizes) > maxSrcsetSizes {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, fmt.Sprintf("At most %d sizes per request", maxSrcsetSizes))
+		return
+	}
+
+	opts, err := parseQROptions(r)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
+		return
+	}
+
+	names := make([]string, 0, len(sizes))
+	images := make(map[string][]byte, len(sizes))
+	for _, size := range sizes {
+		opts.Size = size
+		png, err := qrgen.PNG(content, opts)
+		if err != nil {
+			respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Error generating QR code")
+			return
+		}
+		name := fmt.Sprintf("%s-%d", shortHash, size)
+		names = append(names, name)
+		images[name] = png
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	if strings.Contains(r.Header.Get("Accept"), "application/zip") {
+		writeQRZip(w, names, images)
+		return
+	}
+
+	encoded := make(map[int]string, len(sizes))
+	for i, size := range sizes {
+		encoded[size] = "data:image/png;base64," + base64.StdEncoding.EncodeToString(images[names[i]])
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(encoded)
+}
+
+// qrPayloadHandler renders QR codes for Wi-Fi networks, contacts and
+// locations at /api/v1/qr/{wifi,vcard,geo}. The JSON body describes the
+// content and the usual QR query options control rendering.
+func qrPayloadHandler(w http.ResponseWriter, r *http.Request) {
+	var payload interface{ Payload() (string, error) }
+	switch strings.TrimPrefix(r.URL.Path, "/api/v1/qr/") {
+	case "wifi":
+		payload = &qrgen.WiFi{}
+	case "vcard":
+		payload = &qrgen.VCard{}
+	case "geo":
+		payload = &qrgen.Geo{}
+	default:
+		respondError(w, r, http.StatusNotFound, errCodeNotFound, "Not found")
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(payload); err != nil {
+		if isBodyTooLarge(err) {
+			respondError(w, r, http.StatusRequestEntityTooLarge, errCodeBodyTooLarge, "Request body too large")
+			return
+		}
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid JSON body")
+		return
+	}
+
+	content, err := payload.Payload()
+	if err == nil {
+		err = qrgen.ValidateContent(content)
+	}
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
+		return
+	}
+
+	opts, err := parseQROptions(r)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
+		return
+	}
+
+	png, err := qrgen.PNG(content, opts)
+	var tooLarge *qrgen.ContentTooLargeError
+	if errors.As(err, &tooLarge) {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Error generating QR code")
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(png)
+}
+
+// batchQROptions validates the styling options of a batch request.
+func batchQROptions(req qrBatchRequest) (qrgen.Options, error) {
+	opts := defaultQROptions()
+
+	if req.Format != "" && req.Format != "png" {
+		return opts, fmt.Errorf("Unsupported format %q (use png)", req.Format)
+	}
+
+	if req.Size != 0 {
+		if err := qrgen.ValidateSize(req.Size); err != nil {
+			return opts, err
+		}
+		opts.Size = req.Size
+	}
+
+	style, err := qrgen.ParseStyle(req.Style)
+	if err != nil {
+		return opts, err
+	}
+	opts.Style = style
+
+	if req.FG != "" {
+		if opts.Foreground, err = qrgen.ParseHexColor(req.FG); err != nil {
+			return opts, err
+		}
+	}
+	if req.BG != "" {
+		if opts.Background, err = qrgen.ParseHexColor(req.BG); err != nil {
+			return opts, err
+		}
+	}
+
+	return opts, nil
+}
+
+func writeQRZip(w http.ResponseWriter, names []string, images map[string][]byte) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="qr-codes.zip"`)
+
+	zw := zip.NewWriter(w)
+	for _, name := range names {
+		f, err := zw.Create(name + ".png")
+		if err != nil {
+			return
+		}
+		f.Write(images[name])
+	}
+	zw.Close()
+}
+
+// availabilityResponse is the body returned by GET /api/v1/available.
+type availabilityResponse struct {
+	Available bool   `json:"available"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// hashAvailableHandler reports whether a custom hash could be used for a new
+// link, for inline validation in forms.
+func hashAvailableHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	hash := r.URL.Query().Get("hash")
+	formatErr := utils.ValidateHash(hash)
+
+	// Always query the database, even for malformed hashes, and bypass the
+	// redirect cache, so response times don't hint at which hashes exist.
+	exists, err := hashExists(hash)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Error checking hash")
+		return
+	}
+
+	resp := availabilityResponse{Available: true}
+	switch {
+	case formatErr != nil:
+		resp = availabilityResponse{Reason: formatErr.Error()}
+	case exists:
+		resp = availabilityResponse{Reason: "hash is already taken"}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// bulkUpdateItem is one entry of a POST /api/v1/urls/bulk-update request.
+type bulkUpdateItem struct {
+	ShortHash string `json:"short_hash"`
+	NewURL    string `json:"new_url"`
+}
+
+// bulkUpdateResult reports the outcome of one bulk update entry.
+type bulkUpdateResult struct {
+	ShortHash string `json:"short_hash"`
+	NewURL    string `json:"new_url,omitempty"`
+	Updated   bool   `json:"updated"`
+	Error     string `json:"error,omitempty"`
+}
+
+// bulkUpdateHandler changes the destinations of many links at once, e.g.
+// after a domain rebrand. Entries are validated individually; valid ones are
+// applied together in one transaction, and invalid or unknown ones are
+// reported without failing the rest. Titles are left unchanged.
+func bulkUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var items []bulkUpdateItem
+	if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+		if isBodyTooLarge(err) {
+			respondError(w, r, http.StatusRequestEntityTooLarge, errCodeBodyTooLarge, "Request body too large")
+			return
+		}
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid JSON body")
+		return
+	}
+
+	if len(items) == 0 {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "No updates given")
+		return
+	}
+	if len(items) > maxBulkUpdateSize {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, fmt.Sprintf("At most %d updates per request", maxBulkUpdateSize))
+		return
+	}
+
+	results := make([]bulkUpdateResult, len(items))
+	var updates []database.URLUpdate
+	var pending []int // indexes into results of the entries in updates
+	for i, item := range items {
+		results[i].ShortHash = item.ShortHash
+		if item.ShortHash == "" {
+			results[i].Error = "short_hash is required"
+			continue
+		}
+
+		newURL, err := utils.NormalizeURL(item.NewURL, autoPrependScheme, allowedSchemes...)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].NewURL = newURL
+
+		updates = append(updates, database.URLUpdate{ShortHash: item.ShortHash, FullURL: newURL})
+		pending = append(pending, i)
+	}
+
+	if len(updates) > 0 {
+		updated, err := db.BulkUpdateURLs(updates)
+		if err != nil {
+			log.Printf("Error applying bulk update: %v", err)
+			respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to update URLs")
+			return
+		}
+
+		for j, i := range pending {
+			if !updated[j] {
+				results[i].Error = "URL not found"
+				if existing, err := db.GetURLByHash(updates[j].ShortHash); err == nil && existing.AliasOf != 0 {
+					results[i].Error = errAliasDestination
+				}
+				continue
+			}
+			results[i].Updated = true
+			invalidateCachedURL(updates[j].ShortHash)
+			recordAudit(r, database.AuditURLUpdated, updates[j].ShortHash+" -> "+loggedURL(updates[j].FullURL))
+		}
+	}
+
+	count := 0
+	for _, res := range results {
+		if res.Updated {
+			count++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"updated": count,
+		"results": results,
+	})
+}
+
+// unknownTitleRow is a bulk title CSV row whose hash doesn't exist.
+type unknownTitleRow struct {
+	Line      int    `json:"line"`
+	ShortHash string `json:"short_hash"`
+}
+
+// skippedEntry is an uploaded CSV row or export entry that couldn't be used.
+type skippedEntry struct {
+	Entry  string `json:"entry"`
+	Reason string `json:"reason"`
+}
+
+// bulkTitlesHandler sets link titles from an uploaded short_hash,title CSV,
+// sent either as the request body or as the "file" field of a multipart
+// form. Valid rows are applied in one transaction; rows with unknown hashes
+// or missing values are reported without stopping the rest.
+func bulkTitlesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	body := r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			if isBodyTooLarge(err) {
+				respondError(w, r, http.StatusRequestEntityTooLarge, errCodeBodyTooLarge, "Request body too large")
+				return
+			}
+			respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Missing CSV file")
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	rows, skipped, err := importer.ParseTitlesCSV(body)
+	if err != nil {
+		if isBodyTooLarge(err) {
+			respondError(w, r, http.StatusRequestEntityTooLarge, errCodeBodyTooLarge, "Request body too large")
+			return
+		}
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
+		return
+	}
+	if len(rows) > maxBulkTitleRows {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, fmt.Sprintf("At most %d rows per upload", maxBulkTitleRows))
+		return
+	}
+
+	updates := make([]database.TitleUpdate, len(rows))
+	for i, row := range rows {
+		updates[i] = database.TitleUpdate{ShortHash: row.ShortHash, Title: row.Title}
+	}
+
+	var updated []bool
+	if len(updates) > 0 {
+		updated, err = db.BulkUpdateTitles(updates)
+		if err != nil {
+			log.Printf("Error applying bulk title update: %v", err)
+			respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to update titles")
+			return
+		}
+	}
+
+	count := 0
+	unknown := []unknownTitleRow{}
+	for i, row := range rows {
+		if !updated[i] {
+			unknown = append(unknown, unknownTitleRow{Line: row.Line, ShortHash: row.ShortHash})
+			continue
+		}
+		count++
+		invalidateCachedURL(row.ShortHash)
+	}
+	if count > 0 {
+		recordAudit(r, database.AuditURLUpdated, fmt.Sprintf("bulk title update of %d links", count))
+	}
+
+	skippedRows := []skippedEntry{}
+	for _, s := range skipped {
+		skippedRows = append(skippedRows, skippedEntry{Entry: s.Entry, Reason: s.Reason})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"updated": count,
+		"unknown": unknown,
+		"skipped": skippedRows,
+	})
+}
+
+// dashboardHandler returns aggregate stats for a dashboard widget: link and
+// click totals, links created today and the most clicked link. Figures cover
+// the current user's links, or every link with scope=all.
+func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	userID, _, _ := auth.GetUserFromSession(r)
+	switch r.URL.Query().Get("scope") {
+	case "", "mine":
+	case "all":
+		userID = 0
+	default:
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid scope (use mine or all)")
+		return
+	}
+
+	stats, ok := dashboardCache.Get(userID)
+	if !ok {
+		var err error
+		stats, err = db.GetDashboardStats(userID)
+		if err != nil {
+			log.Printf("Error fetching dashboard stats: %v", err)
+			respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to load dashboard stats")
+			return
+		}
+		dashboardCache.Set(userID, stats)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, max-age=10")
+	json.NewEncoder(w).Encode(trackedDashboardView(stats))
+}
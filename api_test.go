@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"qr-linker/database"
+)
+
+func TestResolveCheckSkipsOtherSchemes(t *testing.T) {
+	testDB := useTestDB(t)
+	if _, err := testDB.CreateURL("mailto:someone@example.com", "mail12", "", 0); err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	resolveHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/urls/mail12/resolve?check=1", nil), "mail12")
+
+	var resp resolveResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if rec.Code != http.StatusOK || resp.Status != 0 || resp.CheckError == "" {
+		t.Errorf("resolve = %d %+v, want 200 with a check_error and no status", rec.Code, resp)
+	}
+
+	url, err := testDB.GetURLByHash("mail12")
+	if err != nil {
+		t.Fatalf("GetURLByHash: %v", err)
+	}
+	if url.Health != database.HealthUnchecked {
+		t.Errorf("health = %q, want %q", url.Health, database.HealthUnchecked)
+	}
+}
+
+func TestHTTPDestination(t *testing.T) {
+	tests := []struct {
+		destination string
+		want        bool
+	}{
+		{"https://example.com", true},
+		{"HTTP://example.com", true},
+		{"mailto:someone@example.com", false},
+		{"tel:+441234567890", false},
+		{"myapp://open/item/42", false},
+	}
+
+	for _, tt := range tests {
+		if got := httpDestination(tt.destination); got != tt.want {
+			t.Errorf("httpDestination(%q) = %v, want %v", tt.destination, got, tt.want)
+		}
+	}
+}
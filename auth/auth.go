@@ -1,24 +1,156 @@
 package auth
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/boj/redistore"
 	"github.com/gorilla/sessions"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var store = sessions.NewCookieStore([]byte("your-secret-key-change-this-in-production"))
+const (
+	defaultSessionSecret = "your-secret-key-change-this-in-production"
+	defaultCookieName    = "qr-linker-session"
+	sessionMaxAge        = 86400 * 7 // 7 days
+)
+
+var store sessions.Store
+
+// cookieName and cookiePath scope the session cookie, so several instances
+// can share a domain under different paths without overwriting each other's
+// sessions.
+var (
+	cookieName = defaultCookieName
+	cookiePath = "/"
+)
+
+// idleTimeout ends sessions that haven't been used for this long, on top of
+// the absolute sessionMaxAge (SESSION_IDLE_TIMEOUT). Zero disables it.
+var idleTimeout time.Duration
+
+// idleRefreshInterval limits how often a session's last activity is saved,
+// so a busy page doesn't rewrite the session cookie on every request.
+const idleRefreshInterval = time.Minute
+
+// sessionVersionLookup returns a user's current session version. When set,
+// sessions carrying an older version are no longer considered authenticated.
+var sessionVersionLookup func(userID int) (int, error)
 
 func init() {
-	store.Options = &sessions.Options{
-		Path:     "/",
-		MaxAge:   86400 * 7, // 7 days
+	store = newCookieStore([]byte(defaultSessionSecret))
+}
+
+func sessionOptions() *sessions.Options {
+	return &sessions.Options{
+		Path:     cookiePath,
+		MaxAge:   sessionMaxAge,
 		HttpOnly: true,
 		Secure:   false, // Set to true in production with HTTPS
 		SameSite: http.SameSiteLaxMode,
 	}
 }
 
+func newCookieStore(secret []byte) *sessions.CookieStore {
+	cs := sessions.NewCookieStore(secret)
+	cs.Options = sessionOptions()
+	return cs
+}
+
+// InitSessionStore selects the session backend from SESSION_STORE. The
+// default "cookie" store keeps session data in the signed cookie; "redis"
+// keeps it server-side at REDIS_URL so sessions can be invalidated and hold
+// larger payloads. SESSION_SECRET signs the cookie in both cases.
+// SESSION_COOKIE_NAME and BASE_PATH set the cookie's name and path, and
+// SESSION_IDLE_TIMEOUT how long an unused session stays logged in.
+func InitSessionStore() error {
+	if name := os.Getenv("SESSION_COOKIE_NAME"); name != "" {
+		if !validCookieName(name) {
+			return fmt.Errorf("invalid SESSION_COOKIE_NAME %q (use letters, digits, '-', '_' or '.')", name)
+		}
+		cookieName = name
+	}
+
+	path, err := normalizeBasePath(os.Getenv("BASE_PATH"))
+	if err != nil {
+		return err
+	}
+	cookiePath = path
+
+	if raw := os.Getenv("SESSION_IDLE_TIMEOUT"); raw != "" {
+		timeout, err := time.ParseDuration(raw)
+		if err != nil || timeout < 0 {
+			return fmt.Errorf("invalid SESSION_IDLE_TIMEOUT %q (use a duration such as 2h, or 0 to disable)", raw)
+		}
+		idleTimeout = timeout
+	}
+
+	secret := []byte(os.Getenv("SESSION_SECRET"))
+	if len(secret) == 0 {
+		secret = []byte(defaultSessionSecret)
+	}
+
+	switch backend := os.Getenv("SESSION_STORE"); backend {
+	case "", "cookie":
+		store = newCookieStore(secret)
+	case "redis":
+		redisURL := os.Getenv("REDIS_URL")
+		if redisURL == "" {
+			redisURL = "redis://localhost:6379"
+		}
+
+		rs, err := redistore.NewRediStoreWithURL(10, redisURL, secret)
+		if err != nil {
+			return fmt.Errorf("connecting to redis session store: %w", err)
+		}
+		rs.Options = sessionOptions()
+		rs.SetMaxAge(sessionMaxAge)
+		rs.SetKeyPrefix("qr-linker_session_")
+		store = rs
+	default:
+		return fmt.Errorf("unknown SESSION_STORE %q (use cookie or redis)", backend)
+	}
+
+	return nil
+}
+
+// normalizeBasePath turns BASE_PATH into a cookie path: "" and "/" mean the
+// whole domain, and any trailing slash is dropped.
+func normalizeBasePath(raw string) (string, error) {
+	if raw == "" || raw == "/" {
+		return "/", nil
+	}
+	if !strings.HasPrefix(raw, "/") || strings.ContainsAny(raw, "; \t\r\n") {
+		return "", fmt.Errorf("invalid BASE_PATH %q (must start with /)", raw)
+	}
+	if path := strings.TrimRight(raw, "/"); path != "" {
+		return path, nil
+	}
+	return "/", nil
+}
+
+func validCookieName(name string) bool {
+	for _, c := range name {
+		isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isAlnum && c != '-' && c != '_' && c != '.' {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// CloseSessionStore releases any resources held by the session backend.
+func CloseSessionStore() error {
+	if rs, ok := store.(*redistore.RediStore); ok {
+		return rs.Close()
+	}
+	return nil
+}
+
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	return string(bytes), err
@@ -30,14 +162,20 @@ func CheckPasswordHash(password, hash string) bool {
 }
 
 func GetSession(r *http.Request) (*sessions.Session, error) {
-	return store.Get(r, "qr-linker-session")
+	return store.Get(r, cookieName)
 }
 
 func SaveSession(w http.ResponseWriter, r *http.Request, session *sessions.Session) error {
 	return session.Save(r, w)
 }
 
-func SetUserSession(w http.ResponseWriter, r *http.Request, userID int, username string) error {
+// SetSessionVersionLookup registers the function used to validate session
+// versions in IsAuthenticated.
+func SetSessionVersionLookup(fn func(userID int) (int, error)) {
+	sessionVersionLookup = fn
+}
+
+func SetUserSession(w http.ResponseWriter, r *http.Request, userID int, username string, sessionVersion int) error {
 	session, err := GetSession(r)
 	if err != nil {
 		return err
@@ -45,11 +183,54 @@ func SetUserSession(w http.ResponseWriter, r *http.Request, userID int, username
 
 	session.Values["user_id"] = userID
 	session.Values["username"] = username
+	session.Values["session_version"] = sessionVersion
 	session.Values["authenticated"] = true
+	session.Values["last_activity"] = time.Now().Unix()
+	clearPendingLogin(session)
 
 	return SaveSession(w, r, session)
 }
 
+// pendingLoginTTL is how long a user has to enter their two-factor code
+// after the password step.
+const pendingLoginTTL = 5 * time.Minute
+
+// SetPendingLogin records that userID passed the password step and still has
+// to enter a two-factor code. The session isn't authenticated until
+// SetUserSession is called.
+func SetPendingLogin(w http.ResponseWriter, r *http.Request, userID int) error {
+	session, err := GetSession(r)
+	if err != nil {
+		return err
+	}
+
+	session.Values["pending_user_id"] = userID
+	session.Values["pending_since"] = time.Now().Unix()
+
+	return SaveSession(w, r, session)
+}
+
+// PendingLogin returns the user waiting for the two-factor step, if the
+// password step was completed recently enough.
+func PendingLogin(r *http.Request) (int, bool) {
+	session, err := GetSession(r)
+	if err != nil {
+		return 0, false
+	}
+
+	userID, ok := session.Values["pending_user_id"].(int)
+	since, _ := session.Values["pending_since"].(int64)
+	if !ok || time.Since(time.Unix(since, 0)) > pendingLoginTTL {
+		return 0, false
+	}
+	return userID, true
+}
+
+func clearPendingLogin(session *sessions.Session) {
+	delete(session.Values, "pending_user_id")
+	delete(session.Values, "pending_since")
+}
+
 func ClearSession(w http.ResponseWriter, r *http.Request) error {
 	session, err := GetSession(r)
 	if err != nil {
@@ -58,6 +239,7 @@ func ClearSession(w http.ResponseWriter, r *http.Request) error {
 
 	session.Values["user_id"] = nil
 	session.Values["username"] = nil
+	session.Values["session_version"] = nil
 	session.Values["authenticated"] = false
 	session.Options.MaxAge = -1
 
@@ -71,7 +253,29 @@ func IsAuthenticated(r *http.Request) bool {
 	}
 
 	auth, ok := session.Values["authenticated"].(bool)
-	return ok && auth
+	if !ok || !auth {
+		return false
+	}
+	if idleTimeout > 0 && time.Since(lastActivity(session)) > idleTimeout {
+		return false
+	}
+
+	if sessionVersionLookup == nil {
+		return true
+	}
+
+	userID, ok := session.Values["user_id"].(int)
+	if !ok {
+		return false
+	}
+
+	current, err := sessionVersionLookup(userID)
+	if err != nil {
+		return false
+	}
+
+	version, _ := session.Values["session_version"].(int)
+	return version == current
 }
 
 func GetUserFromSession(r *http.Request) (int, string, bool) {
@@ -90,13 +294,49 @@ func GetUserFromSession(r *http.Request) (int, string, bool) {
 	return userID, username, true
 }
 
+// lastActivity returns when the session was last used. Sessions from before
+// activity was tracked report the zero time, so they count as idle.
+func lastActivity(session *sessions.Session) time.Time {
+	last, ok := session.Values["last_activity"].(int64)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(last, 0)
+}
+
+// touchSession records activity on an authenticated session, so it doesn't
+// hit the idle timeout while in use. It's saved at most once per
+// idleRefreshInterval.
+func touchSession(w http.ResponseWriter, r *http.Request) {
+	if idleTimeout <= 0 {
+		return
+	}
+	session, err := GetSession(r)
+	if err != nil || time.Since(lastActivity(session)) < idleRefreshInterval {
+		return
+	}
+	session.Values["last_activity"] = time.Now().Unix()
+	SaveSession(w, r, session)
+}
+
+// RequireAuth redirects requests without an authenticated session to the
+// login page. Requests that pass count as activity for the idle timeout.
 func RequireAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !IsAuthenticated(r) {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			http.Redirect(w, r, LoginURL(r), http.StatusSeeOther)
 			return
 		}
+		touchSession(w, r)
 		next(w, r)
 	}
 }
 
+// LoginURL returns the login page URL, carrying the current path as the
+// "next" parameter for GET requests so the user returns there after login.
+func LoginURL(r *http.Request) string {
+	if r.Method != http.MethodGet || r.URL.Path == "/" {
+		return "/login"
+	}
+	return "/login?next=" + url.QueryEscape(r.URL.RequestURI())
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIdleTimeout(t *testing.T) {
+	t.Setenv("SESSION_IDLE_TIMEOUT", "1h")
+	if err := InitSessionStore(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { idleTimeout = 0 })
+
+	// requestWith returns a request carrying the cookies set on rec.
+	requestWith := func(rec *httptest.ResponseRecorder) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, c := range rec.Result().Cookies() {
+			r.AddCookie(c)
+		}
+		return r
+	}
+
+	rec := httptest.NewRecorder()
+	if err := SetUserSession(rec, httptest.NewRequest(http.MethodGet, "/", nil), 1, "bob", 0); err != nil {
+		t.Fatal(err)
+	}
+	if !IsAuthenticated(requestWith(rec)) {
+		t.Fatal("new session isn't authenticated")
+	}
+
+	// Backdate the session's activity past the timeout.
+	r := requestWith(rec)
+	session, _ := GetSession(r)
+	session.Values["last_activity"] = time.Now().Add(-2 * time.Hour).Unix()
+	rec = httptest.NewRecorder()
+	SaveSession(rec, r, session)
+	if IsAuthenticated(requestWith(rec)) {
+		t.Error("idle session still authenticated")
+	}
+
+	idleTimeout = 0
+	if !IsAuthenticated(requestWith(rec)) {
+		t.Error("idle session rejected with the timeout disabled")
+	}
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 test key from RFC 6238 appendix B.
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestValidateTOTP(t *testing.T) {
+	// RFC 6238 lists 94287082 for T=59; the last six digits are the
+	// 6-digit code.
+	at := time.Unix(59, 0)
+	if !ValidateTOTP(rfcSecret, "287082", at) {
+		t.Error("RFC test vector rejected")
+	}
+	if !ValidateTOTP(rfcSecret, "287082", at.Add(30*time.Second)) {
+		t.Error("code from the previous period rejected")
+	}
+	if ValidateTOTP(rfcSecret, "287082", at.Add(2*time.Minute)) {
+		t.Error("stale code accepted")
+	}
+	if ValidateTOTP(rfcSecret, "12345", at) || ValidateTOTP("not base32!", "287082", at) {
+		t.Error("malformed input accepted")
+	}
+
+	// The code belongs to step 1 whichever accepted step it's checked in.
+	for _, offset := range []time.Duration{0, 30 * time.Second} {
+		if step, ok := MatchTOTP(rfcSecret, "287082", at.Add(offset)); !ok || step != 1 {
+			t.Errorf("MatchTOTP at +%v = %d, %v, want step 1", offset, step, ok)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %v", err)
+	}
+	if len(codes) != RecoveryCodeCount || len(codes[0]) != 11 {
+		t.Fatalf("got %d codes like %q", len(codes), codes[0])
+	}
+
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(" "+codes[0][:5]+codes[0][6:]+" ") {
+		t.Error("hash depends on formatting")
+	}
+	if HashRecoveryCode(codes[0]) == HashRecoveryCode(codes[1]) {
+		t.Error("distinct codes hash the same")
+	}
+}
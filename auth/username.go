@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Username length limits. The minimum can be raised with USERNAME_MIN_LENGTH.
+const (
+	DefaultMinUsernameLength = 3
+	MaxUsernameLength        = 50
+)
+
+// minUsernameLength returns USERNAME_MIN_LENGTH, or the default when unset.
+func minUsernameLength() (int, error) {
+	raw := os.Getenv("USERNAME_MIN_LENGTH")
+	if raw == "" {
+		return DefaultMinUsernameLength, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 || n > MaxUsernameLength {
+		return 0, fmt.Errorf("invalid USERNAME_MIN_LENGTH %q (must be 1-%d)", raw, MaxUsernameLength)
+	}
+	return n, nil
+}
+
+// ValidateUsername checks a new username, ignoring surrounding whitespace,
+// which callers should trim before storing it. Usernames may only contain
+// ASCII letters, digits, '_', '-' and '.', so names can't contain spaces,
+// control characters or Unicode lookalikes of other users' names.
+func ValidateUsername(name string) error {
+	name = strings.TrimSpace(name)
+
+	minLength, err := minUsernameLength()
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return fmt.Errorf("username cannot be empty")
+	}
+	if len(name) < minLength || len(name) > MaxUsernameLength {
+		return fmt.Errorf("username must be between %d and %d characters", minLength, MaxUsernameLength)
+	}
+
+	for _, c := range name {
+		isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isAlnum && c != '_' && c != '-' && c != '.' {
+			return fmt.Errorf("username may only contain letters, digits, '_', '-' and '.'")
+		}
+	}
+	return nil
+}
+
+// ErrUserCreationDisabled is returned by CheckUserCreationAllowed when
+// DISABLE_USER_CREATION is set.
+var ErrUserCreationDisabled = errors.New("user creation is disabled on this deployment (unset DISABLE_USER_CREATION to allow it)")
+
+// CheckUserCreationAllowed returns ErrUserCreationDisabled when
+// DISABLE_USER_CREATION=true, so locked-down deployments can't gain users by
+// accident. The CLI tools call it before creating a user.
+func CheckUserCreationAllowed() error {
+	if os.Getenv("DISABLE_USER_CREATION") == "true" {
+		return ErrUserCreationDisabled
+	}
+	return nil
+}
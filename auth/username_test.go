@@ -0,0 +1,43 @@
+package auth
+
+import "testing"
+
+func TestValidateUsername(t *testing.T) {
+	for _, name := range []string{"bob", "  alice.smith ", "dev_ops-2"} {
+		if err := ValidateUsername(name); err != nil {
+			t.Errorf("ValidateUsername(%q) = %v, want nil", name, err)
+		}
+	}
+
+	for _, name := range []string{"", "ab", "john smith", "admin\x00", "аdmin", "bob@example", string(make([]byte, 51))} {
+		if err := ValidateUsername(name); err == nil {
+			t.Errorf("ValidateUsername(%q) succeeded, want error", name)
+		}
+	}
+}
+
+func TestValidateUsernameMinLength(t *testing.T) {
+	t.Setenv("USERNAME_MIN_LENGTH", "5")
+	if err := ValidateUsername("bob"); err == nil {
+		t.Error("ValidateUsername(bob) succeeded with USERNAME_MIN_LENGTH=5")
+	}
+	if err := ValidateUsername("bobby"); err != nil {
+		t.Errorf("ValidateUsername(bobby) = %v", err)
+	}
+
+	t.Setenv("USERNAME_MIN_LENGTH", "0")
+	if err := ValidateUsername("bobby"); err == nil {
+		t.Error("invalid USERNAME_MIN_LENGTH accepted")
+	}
+}
+
+func TestCheckUserCreationAllowed(t *testing.T) {
+	if err := CheckUserCreationAllowed(); err != nil {
+		t.Errorf("CheckUserCreationAllowed() = %v with DISABLE_USER_CREATION unset", err)
+	}
+
+	t.Setenv("DISABLE_USER_CREATION", "true")
+	if err := CheckUserCreationAllowed(); err != ErrUserCreationDisabled {
+		t.Errorf("CheckUserCreationAllowed() = %v, want ErrUserCreationDisabled", err)
+	}
+}
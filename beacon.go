@@ -0,0 +1,57 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"qr-linker/auth"
+)
+
+// With QR_BEACON, /beacon/{hash} serves a 1x1 transparent image that pages
+// embedding a QR code can include next to it. Unlike the QR image it's never
+// cached, so each view of the page reaches the server and is counted as a QR
+// view, at most once per client address and link per beaconDedupWindow.
+const beaconDedupWindow = 30 * time.Minute
+
+var beaconLimiter = newRateLimiter()
+
+// beaconGIF is a 1x1 transparent GIF.
+var beaconGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00,
+	0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00,
+	0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// beaconHandler serves /beacon/{hash}. The image is returned whether or not
+// the view was counted, including for unknown links, so the beacon never
+// shows as broken on the embedding page.
+func beaconHandler(w http.ResponseWriter, r *http.Request) {
+	shortHash := strings.TrimPrefix(r.URL.Path, "/beacon/")
+	if !featureFlags.QRBeacon || shortHash == "" || strings.Contains(shortHash, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Logged-in users and excluded clients aren't counted, as with QR
+	// images and clicks.
+	if !auth.IsAuthenticated(r) && !excludedClick(r) && hashMayExist(shortHash) {
+		if first, _ := beaconLimiter.allow(clientIP(r)+" "+shortHash, 1, beaconDedupWindow); first {
+			if url, err := lookupURL(shortHash); err == nil {
+				if err := db.IncrementQRViews(url.ShortHash); err != nil {
+					log.Printf("Error incrementing QR views: %v", err)
+				}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "no-store, max-age=0")
+	w.Write(beaconGIF)
+}
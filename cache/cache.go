@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+type entry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// TTL is a concurrency-safe, size-bounded cache whose entries expire after a
+// fixed time-to-live. A zero TTL or size disables the cache.
+type TTL[K comparable, V any] struct {
+	mu      sync.RWMutex
+	items   map[K]entry[V]
+	ttl     time.Duration
+	maxSize int
+}
+
+func New[K comparable, V any](ttl time.Duration, maxSize int) *TTL[K, V] {
+	return &TTL[K, V]{
+		items:   make(map[K]entry[V]),
+		ttl:     ttl,
+		maxSize: maxSize,
+	}
+}
+
+func (c *TTL[K, V]) enabled() bool {
+	return c.ttl > 0 && c.maxSize > 0
+}
+
+func (c *TTL[K, V]) Get(key K) (V, bool) {
+	var zero V
+	if !c.enabled() {
+		return zero, false
+	}
+
+	c.mu.RLock()
+	e, ok := c.items[key]
+	c.mu.RUnlock()
+
+	if !ok || time.Now().After(e.expires) {
+		return zero, false
+	}
+	return e.value, true
+}
+
+func (c *TTL[K, V]) Set(key K, value V) {
+	if !c.enabled() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.items[key]; !exists && len(c.items) >= c.maxSize {
+		c.evict()
+	}
+	c.items[key] = entry[V]{value: value, expires: time.Now().Add(c.ttl)}
+}
+
+// evict drops expired entries, or the entry closest to expiry if none have
+// expired. Callers must hold the write lock.
+func (c *TTL[K, V]) evict() {
+	now := time.Now()
+	var oldestKey K
+	var oldest time.Time
+
+	for k, e := range c.items {
+		if now.After(e.expires) {
+			delete(c.items, k)
+			continue
+		}
+		if oldest.IsZero() || e.expires.Before(oldest) {
+			oldestKey, oldest = k, e.expires
+		}
+	}
+
+	if len(c.items) >= c.maxSize {
+		delete(c.items, oldestKey)
+	}
+}
+
+func (c *TTL[K, V]) Delete(key K) {
+	c.mu.Lock()
+	delete(c.items, key)
+	c.mu.Unlock()
+}
+
+func (c *TTL[K, V]) Clear() {
+	c.mu.Lock()
+	c.items = make(map[K]entry[V])
+	c.mu.Unlock()
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetSet(t *testing.T) {
+	c := New[string, int](time.Minute, 10)
+
+	if _, ok := c.Get("a"); ok {
+		t.Error("Get on empty cache returned a value")
+	}
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	if v, ok := c.Get("a"); !ok || v != 2 {
+		t.Errorf("Get(a) = %d, %v, want 2, true", v, ok)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	c := New[string, int](20*time.Millisecond, 10)
+
+	c.Set("a", 1)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("Get(a) missed before expiry")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Error("Get(a) returned an expired entry")
+	}
+}
+
+func TestEviction(t *testing.T) {
+	c := New[string, int](time.Minute, 2)
+
+	c.Set("a", 1)
+	time.Sleep(time.Millisecond)
+	c.Set("b", 2)
+	time.Sleep(time.Millisecond)
+	c.Set("c", 3)
+
+	// The entry closest to expiry makes room for the new one.
+	if _, ok := c.Get("a"); ok {
+		t.Error("Get(a) found the oldest entry after eviction")
+	}
+	for key, want := range map[string]int{"b": 2, "c": 3} {
+		if v, ok := c.Get(key); !ok || v != want {
+			t.Errorf("Get(%s) = %d, %v, want %d, true", key, v, ok, want)
+		}
+	}
+
+	// Updating an existing key doesn't evict anything.
+	c.Set("b", 20)
+	if _, ok := c.Get("c"); !ok {
+		t.Error("updating b evicted c")
+	}
+	if len(c.items) != 2 {
+		t.Errorf("cache holds %d entries, want 2", len(c.items))
+	}
+}
+
+func TestEvictionPrefersExpired(t *testing.T) {
+	c := New[string, int](20*time.Millisecond, 2)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	time.Sleep(30 * time.Millisecond)
+	c.Set("c", 3)
+
+	if len(c.items) != 1 {
+		t.Errorf("cache holds %d entries, want only c after dropping expired ones", len(c.items))
+	}
+	if v, ok := c.Get("c"); !ok || v != 3 {
+		t.Errorf("Get(c) = %d, %v, want 3, true", v, ok)
+	}
+}
+
+func TestDeleteAndClear(t *testing.T) {
+	c := New[string, int](time.Minute, 10)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Delete("a")
+	if _, ok := c.Get("a"); ok {
+		t.Error("Get(a) found a deleted entry")
+	}
+	if _, ok := c.Get("b"); !ok {
+		t.Error("Delete(a) removed b")
+	}
+
+	c.Clear()
+	if _, ok := c.Get("b"); ok {
+		t.Error("Get(b) found an entry after Clear")
+	}
+
+	c.Set("c", 3)
+	if _, ok := c.Get("c"); !ok {
+		t.Error("Set after Clear didn't store the entry")
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	for _, c := range []*TTL[string, int]{
+		New[string, int](0, 10),
+		New[string, int](time.Minute, 0),
+	} {
+		c.Set("a", 1)
+		if _, ok := c.Get("a"); ok {
+			t.Errorf("disabled cache (ttl %v, size %d) stored a value", c.ttl, c.maxSize)
+		}
+	}
+}
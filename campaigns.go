@@ -0,0 +1,184 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"qr-linker/auth"
+	"qr-linker/database"
+)
+
+// maxCampaignNameLength caps campaign names.
+const maxCampaignNameLength = 100
+
+// CampaignsData is passed to the campaign list template.
+type CampaignsData struct {
+	Title         string
+	Campaigns     []database.Campaign
+	Error         string
+	Username      string
+	ClickTracking bool
+}
+
+// CampaignData is passed to the single campaign template.
+type CampaignData struct {
+	Title         string
+	Campaign      *database.Campaign
+	URLs          []database.URL
+	Host          string
+	Username      string
+	ClickTracking bool
+}
+
+// campaignsHandler serves /campaigns (list and create) and /campaigns/<id>.
+func campaignsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+
+	idParam := strings.Trim(strings.TrimPrefix(r.URL.Path, "/campaigns"), "/")
+	if idParam != "" {
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		campaignHandler(w, r, id)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		renderCampaigns(w, r, r.URL.Query().Get("error"))
+	case http.MethodPost:
+		createCampaignHandler(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func createCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" || len(name) > maxCampaignNameLength {
+		http.Redirect(w, r, "/campaigns?error="+url.QueryEscape("Campaign name must be between 1 and 100 characters"), http.StatusSeeOther)
+		return
+	}
+
+	if _, err := db.CreateCampaign(name); err != nil {
+		if errors.Is(err, database.ErrCampaignExists) {
+			http.Redirect(w, r, "/campaigns?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+			return
+		}
+		log.Printf("Error creating campaign: %v", err)
+		http.Error(w, "Failed to create campaign", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/campaigns", http.StatusSeeOther)
+}
+
+func renderCampaigns(w http.ResponseWriter, r *http.Request, errorMsg string) {
+	tmpl, err := template.ParseFS(templatesFS, "templates/campaigns.html")
+	if err != nil {
+		http.Error(w, "Error loading template", http.StatusInternalServerError)
+		log.Printf("Template error: %v", err)
+		return
+	}
+
+	campaigns, err := db.GetCampaigns()
+	if err != nil {
+		log.Printf("Error fetching campaigns: %v", err)
+		campaigns = []database.Campaign{}
+	}
+
+	_, username, _ := auth.GetUserFromSession(r)
+
+	data := CampaignsData{
+		Title:         "Campaigns - QR Linker",
+		Campaigns:     campaigns,
+		Error:         errorMsg,
+		Username:      username,
+		ClickTracking: clickTracking,
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Render error: %v", err)
+	}
+}
+
+// campaignHandler lists the links in one campaign.
+func campaignHandler(w http.ResponseWriter, r *http.Request, id int) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	campaign, err := db.GetCampaign(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching campaign %d: %v", id, err)
+		http.Error(w, "Failed to load campaign", http.StatusInternalServerError)
+		return
+	}
+
+	urls, err := db.GetURLsByCampaign(id)
+	if err != nil {
+		log.Printf("Error fetching campaign %d links: %v", id, err)
+		urls = []database.URL{}
+	}
+
+	tmpl, err := template.ParseFS(templatesFS, "templates/campaign.html")
+	if err != nil {
+		http.Error(w, "Error loading template", http.StatusInternalServerError)
+		log.Printf("Template error: %v", err)
+		return
+	}
+
+	_, username, _ := auth.GetUserFromSession(r)
+
+	data := CampaignData{
+		Title:         campaign.Name + " - QR Linker",
+		Campaign:      campaign,
+		URLs:          urls,
+		Host:          os.Getenv("_INTERNAL_BASE_URL"),
+		Username:      username,
+		ClickTracking: clickTracking,
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Render error: %v", err)
+	}
+}
+
+// parseCampaignID reads the shorten form's campaign selector. An empty value
+// means no campaign.
+func parseCampaignID(raw string) (int, error) {
+	if raw == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, errors.New("Invalid campaign")
+	}
+	if _, err := db.GetCampaign(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, errors.New("Campaign not found")
+		}
+		return 0, err
+	}
+	return id, nil
+}
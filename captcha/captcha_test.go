@@ -0,0 +1,53 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("secret") != "s3cret" || r.PostFormValue("remoteip") != "203.0.113.7" {
+			t.Errorf("request form = %v", r.PostForm)
+		}
+		if r.PostFormValue("response") == "good" {
+			w.Write([]byte(`{"success": true}`))
+			return
+		}
+		w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+	}))
+	defer server.Close()
+
+	v, err := New("Turnstile", "site", "s3cret")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	v.Endpoint = server.URL
+
+	if err := v.Verify(context.Background(), "good", "203.0.113.7"); err != nil {
+		t.Errorf("Verify(good) = %v", err)
+	}
+	if err := v.Verify(context.Background(), "bad", "203.0.113.7"); !errors.Is(err, ErrFailed) {
+		t.Errorf("Verify(bad) = %v, want ErrFailed", err)
+	}
+	if err := v.Verify(context.Background(), "", ""); !errors.Is(err, ErrFailed) {
+		t.Errorf("Verify(empty) = %v, want ErrFailed", err)
+	}
+
+	server.Close()
+	if err := v.Verify(context.Background(), "good", "203.0.113.7"); err == nil || errors.Is(err, ErrFailed) {
+		t.Errorf("Verify with the provider down = %v, want a request error", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New("recaptcha", "site", "secret"); err == nil {
+		t.Error("unknown provider accepted")
+	}
+	if _, err := New("hcaptcha", "site", ""); err == nil {
+		t.Error("missing secret accepted")
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"qr-linker/utils"
+)
+
+// checksumHashes makes generated hashes end in a checksum character
+// (CHECKSUM_HASHES), so redirects for mistyped or guessed hashes are refused
+// without a database lookup. Hashes without a valid checksum, such as
+// aliases, imported links and links created before the option was enabled,
+// are listed in uncheckedHashes and still looked up.
+var checksumHashes bool
+
+var uncheckedHashes = &hashSet{}
+
+// uncheckedHashesRefresh is how often uncheckedHashes may be reloaded when a
+// hash isn't found in it, to pick up links added by the CLI tools. Scanners
+// therefore cost at most one read of the hashes per interval.
+const uncheckedHashesRefresh = time.Minute
+
+// hashSet holds the hashes of links that don't carry a valid checksum. With
+// HASH_CASE_INSENSITIVE they're stored lowercased.
+type hashSet struct {
+	mu     sync.RWMutex
+	hashes map[string]bool
+	loaded time.Time
+}
+
+func (s *hashSet) key(hash string) string {
+	if caseInsensitiveHashes {
+		return strings.ToLower(hash)
+	}
+	return hash
+}
+
+// load replaces the set with the unchecked hashes in the database.
+func (s *hashSet) load() error {
+	all, err := db.GetAllHashes()
+	if err != nil {
+		return err
+	}
+	hashes := make(map[string]bool)
+	for _, hash := range all {
+		if !utils.ValidateChecksum(hash) {
+			hashes[s.key(hash)] = true
+		}
+	}
+
+	s.mu.Lock()
+	s.hashes = hashes
+	s.loaded = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *hashSet) add(hash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hashes == nil {
+		s.hashes = make(map[string]bool)
+	}
+	s.hashes[s.key(hash)] = true
+}
+
+// contains reports whether hash is in the set, reloading it first if it's
+// missing and the set is older than uncheckedHashesRefresh.
+func (s *hashSet) contains(hash string) bool {
+	s.mu.RLock()
+	found, stale := s.hashes[s.key(hash)], time.Since(s.loaded) > uncheckedHashesRefresh
+	s.mu.RUnlock()
+	if found || !stale {
+		return found
+	}
+
+	if err := s.load(); err != nil {
+		log.Printf("Error loading unchecked hashes: %v", err)
+		// Fail open: let the caller look the hash up.
+		return true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.hashes[s.key(hash)]
+}
+
+// hashMayExist reports whether a link with this hash could exist, without a
+// database lookup where possible. It's always true without CHECKSUM_HASHES.
+func hashMayExist(hash string) bool {
+	if !checksumHashes || utils.ValidateChecksum(hash) {
+		return true
+	}
+	return uncheckedHashes.contains(hash)
+}
+
+// generateHash returns an unused hash for a new link, starting with prefix.
+// With CHECKSUM_HASHES the checksum covers the prefix too.
+func generateHash(prefix string) (string, error) {
+	finish := func(hash string) string { return prefix + hash }
+	if checksumHashes {
+		finish = func(hash string) string { return utils.AddChecksum(prefix + hash) }
+	}
+
+	// Uniqueness is checked on the full hash, which is what gets stored
+	// and matched on redirect.
+	hash, attempts, err := utils.GenerateUniqueHashAttempts(func(hash string) (bool, error) {
+		return hashExists(finish(hash))
+	})
+	if err != nil {
+		return "", err
+	}
+	hashGeneration.record(attempts, hash != "")
+	if hash == "" {
+		return "", errors.New("no unused hash found")
+	}
+	return finish(hash), nil
+}
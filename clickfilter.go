@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Visits from monitoring tools and health checks can be kept out of click
+// counts: a visit whose User-Agent contains one of excludedUserAgents
+// (EXCLUDE_CLICK_USER_AGENTS, case-insensitive) or whose client address is in
+// one of excludedNetworks (EXCLUDE_CLICK_IPS) is still redirected but not
+// counted.
+var (
+	excludedUserAgents []string
+	excludedNetworks   []*net.IPNet
+)
+
+// parseUserAgentList parses a comma-separated list of User-Agent substrings,
+// lowercased for matching.
+func parseUserAgentList(raw string) []string {
+	var list []string
+	for _, part := range strings.Split(raw, ",") {
+		if part = strings.ToLower(strings.TrimSpace(part)); part != "" {
+			list = append(list, part)
+		}
+	}
+	return list
+}
+
+// parseNetworks parses a comma-separated list of CIDR ranges. Plain
+// addresses match only themselves.
+func parseNetworks(raw string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, "/") {
+			ip := net.ParseIP(part)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", part)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			part = fmt.Sprintf("%s/%d", part, bits)
+		}
+		_, network, err := net.ParseCIDR(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR range %q", part)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// excludedClick reports whether a visit matches the click exclusions, and
+// logs the match when DEBUG is on.
+func excludedClick(r *http.Request) bool {
+	if ua := strings.ToLower(r.UserAgent()); ua != "" {
+		for _, substr := range excludedUserAgents {
+			if strings.Contains(ua, substr) {
+				debugf("Not counting click on %s from user agent %q", r.URL.Path, r.UserAgent())
+				return true
+			}
+		}
+	}
+
+	if len(excludedNetworks) > 0 {
+		if ip := net.ParseIP(clientIP(r)); ip != nil {
+			for _, network := range excludedNetworks {
+				if network.Contains(ip) {
+					debugf("Not counting click on %s from %s", r.URL.Path, ip)
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
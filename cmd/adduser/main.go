@@ -2,6 +2,8 @@ package main
 
 import (
 	"bufio"
+	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -9,6 +11,7 @@ import (
 	"strings"
 	"syscall"
 
+	"qr-linker/auth"
 	"qr-linker/database"
 
 	"github.com/joho/godotenv"
@@ -60,9 +63,14 @@ Examples:
 Description:
   This tool creates new users for the QR Linker application.
   Passwords are securely hashed using bcrypt before storage.
-  Usernames must be unique and between 3-50 characters.
+  Usernames must be unique, 3-50 characters (USERNAME_MIN_LENGTH raises
+  the minimum) and may only contain letters, digits, '_', '-' and '.'.
   Passwords must be at least 6 characters long.
 
+Environment:
+  DISABLE_USER_CREATION=true  Refuse to create users (for locked-down
+                              deployments)
+
 `)
 	}
 
@@ -73,6 +81,10 @@ Description:
 		os.Exit(0)
 	}
 
+	if err := auth.CheckUserCreationAllowed(); err != nil {
+		log.Fatal(err)
+	}
+
 	// Initialize database connection
 	db, err := database.NewDB(*dbPath)
 	if err != nil {
@@ -86,7 +98,7 @@ Description:
 	// Get username
 	var user string
 	if *username != "" {
-		user = *username
+		user = strings.TrimSpace(*username)
 		// Validate provided username
 		if err := validateUsername(user, db); err != nil {
 			log.Fatal(err)
@@ -110,6 +122,14 @@ Description:
 		log.Fatal("Failed to create user:", err)
 	}
 
+	err = db.RecordAudit(database.AuditEntry{
+		Action: database.AuditUserCreated,
+		Target: newUser.Username,
+	})
+	if err != nil {
+		log.Printf("Warning: failed to record audit entry: %v", err)
+	}
+
 	fmt.Println()
 	fmt.Printf("✓ User '%s' created successfully!\n", newUser.Username)
 	fmt.Printf("  ID: %d\n", newUser.ID)
@@ -124,23 +144,18 @@ func getEnv(key, defaultValue string) string {
 }
 
 func validateUsername(username string, db *database.DB) error {
-	if username == "" {
-		return fmt.Errorf("username cannot be empty")
-	}
-
-	if len(username) < 3 {
-		return fmt.Errorf("username must be at least 3 characters long")
-	}
-
-	if len(username) > 50 {
-		return fmt.Errorf("username must be less than 50 characters")
+	if err := auth.ValidateUsername(username); err != nil {
+		return err
 	}
 
 	// Check if username already exists
-	existingUser, _ := db.GetUserByUsername(username)
-	if existingUser != nil {
+	_, err := db.GetUserByUsername(username)
+	if err == nil {
 		return fmt.Errorf("username '%s' already exists", username)
 	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to check username: %w", err)
+	}
 
 	return nil
 }
@@ -158,27 +173,20 @@ func promptUsername(db *database.DB) string {
 		username = strings.TrimSpace(username)
 
 		// Validate username
-		if username == "" {
-			fmt.Println("✗ Username cannot be empty. Please try again.")
-			continue
-		}
-
-		if len(username) < 3 {
-			fmt.Println("✗ Username must be at least 3 characters long. Please try again.")
-			continue
-		}
-
-		if len(username) > 50 {
-			fmt.Println("✗ Username must be less than 50 characters. Please try again.")
+		if err := auth.ValidateUsername(username); err != nil {
+			fmt.Printf("✗ Invalid username: %v. Please try again.\n", err)
 			continue
 		}
 
 		// Check if username already exists
-		existingUser, _ := db.GetUserByUsername(username)
-		if existingUser != nil {
+		_, err = db.GetUserByUsername(username)
+		if err == nil {
 			fmt.Printf("✗ Username '%s' already exists. Please choose a different username.\n", username)
 			continue
 		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Fatal("Failed to check username:", err)
+		}
 
 		return username
 	}
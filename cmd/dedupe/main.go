@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"qr-linker/database"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	// Load environment variables from .env file if it exists
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using defaults")
+	}
+
+	// Get default database path from environment variables (same logic as main app)
+	defaultDBPath := getEnv("DB_PATH_DEV", "")
+	if defaultDBPath == "" {
+		defaultDBPath = getEnv("DB_PATH", "urls.db")
+	}
+
+	var (
+		help         = flag.Bool("help", false, "Show help message")
+		h            = flag.Bool("h", false, "Show help message (shorthand)")
+		dbPath       = flag.String("db", defaultDBPath, "Path to database file")
+		deleteMerged = flag.Bool("delete", false, "Delete merged links instead of keeping them as aliases")
+		yes          = flag.Bool("yes", false, "Merge every group into its most-clicked link without asking")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, `QR Linker - Merge Duplicate Destinations Tool
+
+Usage:
+  go run cmd/dedupe/main.go [options]
+
+Options:
+  -h, -help     Show this help message
+  -db <path>    Path to database file (default: urls.db)
+  -delete       Delete merged links instead of keeping them as aliases
+  -yes          Merge every group into its most-clicked link without asking
+
+Examples:
+  # Review each duplicate destination and choose which link to keep
+  go run cmd/dedupe/main.go
+
+  # Keep the most-clicked link for every destination and delete the rest
+  go run cmd/dedupe/main.go -delete -yes
+
+Description:
+  Finds destinations that more than one short link points to and merges
+  each group into one link, which receives the others' clicks, QR views
+  and click events. By default the merged links become aliases of it,
+  with their counts reset, and aren't listed again; -delete removes them
+  instead, which breaks any printed codes using them. Each merge is applied in a single transaction.
+  A running server may keep redirecting deleted links for up to
+  REDIRECT_CACHE_TTL afterwards.
+
+`)
+	}
+
+	flag.Parse()
+
+	if *help || *h {
+		flag.Usage()
+		os.Exit(0)
+	}
+
+	// Initialize database connection
+	db, err := database.NewDB(*dbPath)
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer db.Close()
+
+	duplicates, err := db.FindDuplicateDestinations()
+	if err != nil {
+		log.Fatal("Failed to find duplicate destinations:", err)
+	}
+
+	if len(duplicates) == 0 {
+		fmt.Println("No duplicate destinations found")
+		return
+	}
+
+	fmt.Printf("%d destinations have more than one link\n", len(duplicates))
+
+	reader := bufio.NewReader(os.Stdin)
+	action := "aliased"
+	if *deleteMerged {
+		action = "deleted"
+	}
+
+	var groups, merged int
+	for _, dup := range duplicates {
+		fmt.Printf("\n%s\n", dup.FullURL)
+		for i, url := range dup.URLs {
+			fmt.Printf("  %d. /%s  %d clicks, created %s\n", i+1, url.ShortHash, url.Clicks, url.CreatedAt.Format("2006-01-02"))
+		}
+
+		keep := dup.URLs[mostClicked(dup.URLs)]
+		if !*yes {
+			choice, ok := promptKeep(reader, len(dup.URLs), mostClicked(dup.URLs))
+			if !ok {
+				fmt.Println("  Skipped")
+				continue
+			}
+			keep = dup.URLs[choice]
+		}
+
+		var hashes []string
+		for _, url := range dup.URLs {
+			if url.ID != keep.ID {
+				hashes = append(hashes, url.ShortHash)
+			}
+		}
+
+		if !*yes && !confirm(reader, fmt.Sprintf("Merge %d links into /%s? (y/N): ", len(hashes), keep.ShortHash)) {
+			fmt.Println("  Skipped")
+			continue
+		}
+
+		kept, err := db.MergeDuplicates(keep.ShortHash, hashes, *deleteMerged)
+		if err != nil {
+			fmt.Printf("  ✗ Merge failed, nothing was changed: %v\n", err)
+			continue
+		}
+
+		err = db.RecordAudit(database.AuditEntry{
+			Action: database.AuditURLsMerged,
+			Target: fmt.Sprintf("merged %s into %s (%s)", strings.Join(hashes, ", "), kept.ShortHash, action),
+		})
+		if err != nil {
+			log.Printf("Warning: failed to record audit entry: %v", err)
+		}
+
+		fmt.Printf("  ✓ Kept /%s (%d clicks), %s %s\n", kept.ShortHash, kept.Clicks, action, strings.Join(hashes, ", "))
+		groups++
+		merged += len(hashes)
+	}
+
+	fmt.Printf("\n✓ Merged %d links into %d destinations\n", merged, groups)
+}
+
+// mostClicked returns the index of the link with the most clicks, preferring
+// the oldest on ties.
+func mostClicked(urls []database.URL) int {
+	best := 0
+	for i, url := range urls {
+		if url.Clicks > urls[best].Clicks {
+			best = i
+		}
+	}
+	return best
+}
+
+// promptKeep asks which link of a group to keep. It returns the chosen index,
+// or false to skip the group.
+func promptKeep(reader *bufio.Reader, count, suggested int) (int, bool) {
+	for {
+		fmt.Printf("Keep which link? (1-%d, Enter for %d, s to skip): ", count, suggested+1)
+		answer, err := reader.ReadString('\n')
+		if err != nil {
+			return 0, false
+		}
+		answer = strings.ToLower(strings.TrimSpace(answer))
+
+		switch answer {
+		case "":
+			return suggested, true
+		case "s", "skip":
+			return 0, false
+		}
+
+		if choice, err := strconv.Atoi(answer); err == nil && choice >= 1 && choice <= count {
+			return choice - 1, true
+		}
+		fmt.Println("Invalid choice. Please try again.")
+	}
+}
+
+func confirm(reader *bufio.Reader, prompt string) bool {
+	fmt.Print(prompt)
+	answer, err := reader.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
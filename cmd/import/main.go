@@ -0,0 +1,202 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"qr-linker/database"
+	"qr-linker/importer"
+	"qr-linker/utils"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	// Load environment variables from .env file if it exists
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using defaults")
+	}
+
+	// Get default database path from environment variables (same logic as main app)
+	defaultDBPath := getEnv("DB_PATH_DEV", "")
+	if defaultDBPath == "" {
+		defaultDBPath = getEnv("DB_PATH", "urls.db")
+	}
+
+	var (
+		help     = flag.Bool("help", false, "Show help message")
+		h        = flag.Bool("h", false, "Show help message (shorthand)")
+		dbPath   = flag.String("db", defaultDBPath, "Path to database file")
+		format   = flag.String("format", "bitly", "Export format")
+		owner    = flag.String("owner", "", "Username to record as the creator of imported links")
+		dryRun   = flag.Bool("dry-run", false, "Parse the export and report what would be imported")
+		failFast = flag.Bool("fail-fast", false, "Stop at the first entry that can't be imported instead of skipping it")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, `QR Linker - Import Tool
+
+Usage:
+  go run cmd/import/main.go [options] <export>
+
+Options:
+  -h, -help        Show this help message
+  -db <path>       Path to database file (default: urls.db)
+  -format <name>   Export format: bitly, csv or json (default: bitly)
+  -owner <name>    Record this user as the creator of imported links
+  -dry-run         Parse the export without importing anything
+  -fail-fast       Import nothing if any entry can't be imported
+
+Examples:
+  # Import a Bitly export, keeping the original short codes where possible
+  go run cmd/import/main.go bitly-links.json
+
+  # Read the export from stdin
+  cat bitly-links.json | go run cmd/import/main.go -
+
+  # Check a CSV file, stopping at the first bad row
+  go run cmd/import/main.go -format csv -fail-fast -dry-run links.csv
+
+  # Copy links from another QR Linker's /export/json download
+  go run cmd/import/main.go -format json qr-linker-2025-01-02.json
+
+Description:
+  Imports links exported from another URL shortener. Short codes that are
+  already taken or not valid here are replaced with newly generated hashes,
+  and the remapping is printed. The import runs in a single transaction, so
+  nothing is imported if any link fails.
+
+  CSV files need a header row naming their columns: url, and optionally
+  short_hash, title, created_at (RFC 3339 or YYYY-MM-DD) and clicks.
+  Entries that can't be imported, such as rows with an empty URL or the
+  wrong number of columns, are skipped and listed with their line number;
+  with -fail-fast the first one aborts the import instead.
+
+  JSON files are exports from QR Linker's /export/json. Click and QR view
+  counts, timestamps, domains and aliases are kept; users in the export
+  are ignored.
+
+`)
+	}
+
+	flag.Parse()
+
+	if *help || *h {
+		flag.Usage()
+		os.Exit(0)
+	}
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *format != "bitly" && *format != "csv" && *format != "json" {
+		log.Fatalf("Unsupported format %q (supported: bitly, csv, json)", *format)
+	}
+
+	var input io.Reader = os.Stdin
+	if path := flag.Arg(0); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatal("Failed to open export:", err)
+		}
+		defer f.Close()
+		input = f
+	}
+
+	var urls []database.URL
+	var skipped []importer.Skipped
+	var err error
+	switch *format {
+	case "csv":
+		urls, skipped, err = importer.ParseCSV(input, *failFast)
+	case "json":
+		urls, skipped, err = importer.ParseJSON(input)
+	default:
+		urls, skipped, err = importer.ParseBitly(input)
+	}
+	if err != nil {
+		log.Fatal("Nothing was imported: ", err)
+	}
+	if *failFast && len(skipped) > 0 {
+		log.Fatalf("Nothing was imported: %s: %s", skipped[0].Entry, skipped[0].Reason)
+	}
+
+	for _, s := range skipped {
+		fmt.Printf("✗ Skipped %s: %s\n", s.Entry, s.Reason)
+	}
+
+	if *dryRun {
+		fmt.Printf("Would import %d links (%d skipped)\n", len(urls), len(skipped))
+		return
+	}
+
+	// Initialize database connection
+	db, err := database.NewDB(*dbPath)
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer db.Close()
+
+	var ownerID int
+	if *owner != "" {
+		user, err := db.GetUserByUsername(*owner)
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Fatalf("User '%s' not found", *owner)
+		}
+		if err != nil {
+			log.Fatal("Failed to look up owner:", err)
+		}
+		ownerID = user.ID
+	}
+
+	// Links that need a new hash get one in the same form as the server
+	// generates.
+	generateHash := utils.GenerateUniqueHash
+	if getEnv("CHECKSUM_HASHES", "false") == "true" {
+		generateHash = utils.GenerateUniqueChecksummedHash
+	}
+
+	results, err := db.ImportURLs(urls, ownerID, generateHash)
+	if err != nil {
+		log.Fatal("Import failed, nothing was imported:", err)
+	}
+
+	remapped := 0
+	for _, r := range results {
+		if !r.Remapped() {
+			continue
+		}
+		remapped++
+		if r.OriginalHash == "" {
+			fmt.Printf("→ %s: new hash %s\n", r.FullURL, r.ShortHash)
+		} else {
+			fmt.Printf("→ %s remapped to %s (%s)\n", r.OriginalHash, r.ShortHash, r.FullURL)
+		}
+	}
+
+	err = db.RecordAudit(database.AuditEntry{
+		ActorUserID: ownerID,
+		Action:      database.AuditURLsImported,
+		Target:      fmt.Sprintf("%d links from %s", len(results), *format),
+	})
+	if err != nil {
+		log.Printf("Warning: failed to record audit entry: %v", err)
+	}
+
+	fmt.Println()
+	fmt.Printf("✓ Imported %d links (%d remapped, %d skipped)\n", len(results), remapped, len(skipped))
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -11,7 +12,9 @@ import (
 	"strings"
 	"syscall"
 
+	"qr-linker/auth"
 	"qr-linker/database"
+	"qr-linker/utils"
 
 	"github.com/joho/godotenv"
 	"golang.org/x/crypto/bcrypt"
@@ -54,7 +57,14 @@ Interactive Menu Options:
   2. Add new user         - Create a new user with username and password
   3. Delete user          - Remove an existing user from the database (by ID)
   4. Change password      - Update password for an existing user (by username)
-  5. Exit                 - Quit the application
+  5. Reset two-factor     - Turn off two-factor auth for a user who lost their device
+  6. Set hash prefix      - Limit a user to hashes starting with a prefix, e.g.
+                            acme- (leave empty to remove the limit)
+  7. Exit                 - Quit the application
+
+Environment:
+  DISABLE_USER_CREATION=true  Disable "Add new user" (for locked-down
+                              deployments)
 
 Examples:
   # Interactive mode (menu-driven interface)
@@ -106,8 +116,10 @@ For adding a single user quickly, consider using:
 		fmt.Println("2. Add new user")
 		fmt.Println("3. Delete user")
 		fmt.Println("4. Change password")
-		fmt.Println("5. Exit")
-		fmt.Print("\nSelect option (1-5): ")
+		fmt.Println("5. Reset two-factor auth")
+		fmt.Println("6. Set hash prefix")
+		fmt.Println("7. Exit")
+		fmt.Print("\nSelect option (1-7): ")
 
 		reader := bufio.NewReader(os.Stdin)
 		choice, _ := reader.ReadString('\n')
@@ -123,6 +135,10 @@ For adding a single user quickly, consider using:
 		case "4":
 			changePassword(db)
 		case "5":
+			resetTwoFactor(db)
+		case "6":
+			setHashPrefix(db)
+		case "7":
 			fmt.Println("Goodbye!")
 			return
 		default:
@@ -145,20 +161,26 @@ func listUsers(db *database.DB) {
 		return
 	}
 
-	fmt.Printf("\n%-5s %-20s %-20s\n", "ID", "Username", "Created")
-	fmt.Println(strings.Repeat("-", 50))
+	fmt.Printf("\n%-5s %-20s %-20s %-16s\n", "ID", "Username", "Created", "Hash prefix")
+	fmt.Println(strings.Repeat("-", 67))
 	
 	for _, user := range users {
-		fmt.Printf("%-5d %-20s %-20s\n", 
+		fmt.Printf("%-5d %-20s %-20s %-16s\n", 
 			user.ID, 
 			user.Username, 
-			user.CreatedAt.Format("2006-01-02 15:04"))
+			user.CreatedAt.Format("2006-01-02 15:04"),
+			user.HashPrefix)
 	}
 }
 
 func addUser(db *database.DB) {
 	fmt.Println("\n--- Add New User ---")
 	
+	if err := auth.CheckUserCreationAllowed(); err != nil {
+		fmt.Printf("Cannot add user: %v.\n", err)
+		return
+	}
+
 	reader := bufio.NewReader(os.Stdin)
 	
 	// Get username
@@ -166,17 +188,21 @@ func addUser(db *database.DB) {
 	username, _ := reader.ReadString('\n')
 	username = strings.TrimSpace(username)
 	
-	if username == "" {
-		fmt.Println("Username cannot be empty.")
+	if err := auth.ValidateUsername(username); err != nil {
+		fmt.Printf("Invalid username: %v.\n", err)
 		return
 	}
 	
 	// Check if user exists
-	existingUser, _ := db.GetUserByUsername(username)
-	if existingUser != nil {
+	_, err := db.GetUserByUsername(username)
+	if err == nil {
 		fmt.Printf("User '%s' already exists.\n", username)
 		return
 	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		fmt.Printf("Error checking username: %v\n", err)
+		return
+	}
 	
 	// Get password
 	fmt.Print("Password: ")
@@ -220,6 +246,8 @@ func addUser(db *database.DB) {
 		return
 	}
 	
+	recordAudit(db, database.AuditUserCreated, user.Username)
+
 	fmt.Printf("✓ User '%s' created successfully (ID: %d)\n", user.Username, user.ID)
 }
 
@@ -275,6 +303,8 @@ func deleteUser(db *database.DB) {
 		return
 	}
 	
+	recordAudit(db, database.AuditUserDeleted, user.Username)
+
 	fmt.Printf("✓ User '%s' (ID: %d) deleted successfully.\n", user.Username, user.ID)
 }
 
@@ -340,9 +370,113 @@ func changePassword(db *database.DB) {
 		return
 	}
 	
+	recordAudit(db, database.AuditPasswordChanged, username)
+
 	fmt.Printf("✓ Password changed successfully for user '%s'.\n", username)
 }
 
+func resetTwoFactor(db *database.DB) {
+	fmt.Println("\n--- Reset Two-Factor Auth ---")
+
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Print("Username: ")
+	username, _ := reader.ReadString('\n')
+	username = strings.TrimSpace(username)
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			fmt.Printf("User '%s' not found.\n", username)
+		} else {
+			fmt.Printf("Error finding user: %v\n", err)
+		}
+		return
+	}
+
+	if user.TOTPSecret == "" {
+		fmt.Printf("User '%s' does not have two-factor auth enabled.\n", username)
+		return
+	}
+
+	fmt.Printf("Disable two-factor auth for '%s'? (yes/no): ", username)
+	confirm, _ := reader.ReadString('\n')
+	confirm = strings.TrimSpace(strings.ToLower(confirm))
+
+	if confirm != "yes" && confirm != "y" {
+		fmt.Println("Reset cancelled.")
+		return
+	}
+
+	if err := db.DisableTOTP(user.ID); err != nil {
+		fmt.Printf("Error resetting two-factor auth: %v\n", err)
+		return
+	}
+
+	recordAudit(db, database.AuditTOTPDisabled, username)
+
+	fmt.Printf("✓ Two-factor auth disabled for user '%s'.\n", username)
+}
+
+func setHashPrefix(db *database.DB) {
+	fmt.Println("\n--- Set Hash Prefix ---")
+
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Print("Username: ")
+	username, _ := reader.ReadString('\n')
+	username = strings.TrimSpace(username)
+
+	user, err := db.GetUserByUsername(username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			fmt.Printf("User '%s' not found.\n", username)
+		} else {
+			fmt.Printf("Error finding user: %v\n", err)
+		}
+		return
+	}
+
+	if user.HashPrefix != "" {
+		fmt.Printf("Current prefix: %s\n", user.HashPrefix)
+	}
+	fmt.Print("Hash prefix (empty for no limit): ")
+	raw, _ := reader.ReadString('\n')
+
+	prefix, err := utils.ValidateHashPrefix(raw)
+	if err != nil {
+		fmt.Printf("Invalid prefix: %v.\n", err)
+		return
+	}
+
+	if err := db.SetUserHashPrefix(user.ID, prefix); err != nil {
+		fmt.Printf("Error setting hash prefix: %v\n", err)
+		return
+	}
+
+	target := username
+	if prefix != "" {
+		target += " -> " + prefix
+	}
+	recordAudit(db, database.AuditHashPrefixSet, target)
+
+	if prefix == "" {
+		fmt.Printf("✓ User '%s' can now use any hash.\n", username)
+		return
+	}
+	fmt.Printf("✓ User '%s' is limited to hashes starting with %s%s.\n", username, prefix, utils.PrefixSeparator)
+}
+
+func recordAudit(db *database.DB, action, target string) {
+	err := db.RecordAudit(database.AuditEntry{
+		Action: action,
+		Target: target,
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to record audit entry: %v\n", err)
+	}
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"qr-linker/database"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	// Load environment variables from .env file if it exists
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using defaults")
+	}
+
+	// Get default database path from environment variables (same logic as main app)
+	defaultDBPath := getEnv("DB_PATH_DEV", "")
+	if defaultDBPath == "" {
+		defaultDBPath = getEnv("DB_PATH", "urls.db")
+	}
+
+	var (
+		help   = flag.Bool("help", false, "Show help message")
+		h      = flag.Bool("h", false, "Show help message (shorthand)")
+		dbPath = flag.String("db", defaultDBPath, "Path to database file")
+		dryRun = flag.Bool("dry-run", false, "Report discrepancies without changing anything")
+		yes    = flag.Bool("yes", false, "Apply without asking for confirmation")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, `QR Linker - Reconcile Click Counts Tool
+
+Usage:
+  go run cmd/reconcile/main.go [options]
+
+Options:
+  -h, -help        Show this help message
+  -db <path>       Path to database file (default: urls.db)
+  -dry-run         Report discrepancies without changing anything
+  -yes             Apply without asking for confirmation
+
+Examples:
+  # Report links whose click count doesn't match their click events
+  go run cmd/reconcile/main.go -dry-run
+
+  # Fix them without prompting
+  go run cmd/reconcile/main.go -yes
+
+Description:
+  Recomputes each link's click count from its recorded click events and
+  lists every link where the two differ. Nothing changes until you confirm,
+  and the updates are applied in a single transaction.
+
+  Only use this when the events are the complete record: links imported
+  with their click counts, links whose clicks were reset, and events pruned
+  by CLICK_RETENTION_DAYS all make the counts differ legitimately.
+
+`)
+	}
+
+	flag.Parse()
+
+	if *help || *h {
+		flag.Usage()
+		os.Exit(0)
+	}
+
+	if days, _ := strconv.Atoi(getEnv("CLICK_RETENTION_DAYS", "0")); days > 0 {
+		fmt.Printf("Warning: CLICK_RETENTION_DAYS is %d, so older click events may have been pruned\n", days)
+		fmt.Println("and reconciling would lower those links' counts.")
+		fmt.Println()
+	}
+
+	// Initialize database connection
+	db, err := database.NewDB(*dbPath)
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer db.Close()
+
+	preview, err := db.ReconcileClicks(true)
+	if err != nil {
+		log.Fatal("Failed to compare click counts:", err)
+	}
+
+	if len(preview) == 0 {
+		fmt.Println("All click counts match their click events")
+		return
+	}
+
+	fmt.Printf("%d links have click counts that don't match their events:\n\n", len(preview))
+	for _, d := range preview {
+		fmt.Printf("  /%s  %d → %d\n", d.ShortHash, d.Clicks, d.Events)
+	}
+	fmt.Println()
+
+	if *dryRun {
+		fmt.Println("Dry run, nothing was changed.")
+		return
+	}
+
+	if !*yes && !confirm(fmt.Sprintf("Set the click counts of %d links from their events? (y/N): ", len(preview))) {
+		fmt.Println("Cancelled, nothing was changed.")
+		return
+	}
+
+	fixed, err := db.ReconcileClicks(false)
+	if err != nil {
+		log.Fatal("Reconcile failed, nothing was changed:", err)
+	}
+
+	err = db.RecordAudit(database.AuditEntry{
+		Action: database.AuditClicksReconciled,
+		Target: fmt.Sprintf("reconciled clicks of %d links", len(fixed)),
+	})
+	if err != nil {
+		log.Printf("Warning: failed to record audit entry: %v", err)
+	}
+
+	fmt.Printf("✓ Updated %d links\n", len(fixed))
+}
+
+func confirm(prompt string) bool {
+	fmt.Print(prompt)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"qr-linker/database"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	// Load environment variables from .env file if it exists
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using defaults")
+	}
+
+	// Get default database path from environment variables (same logic as main app)
+	defaultDBPath := getEnv("DB_PATH_DEV", "")
+	if defaultDBPath == "" {
+		defaultDBPath = getEnv("DB_PATH", "urls.db")
+	}
+
+	var (
+		help    = flag.Bool("help", false, "Show help message")
+		h       = flag.Bool("h", false, "Show help message (shorthand)")
+		dbPath  = flag.String("db", defaultDBPath, "Path to database file")
+		find    = flag.String("find", "", "Text to find in destinations")
+		replace = flag.String("replace", "", "Replacement text")
+		yes     = flag.Bool("yes", false, "Apply without asking for confirmation")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, `QR Linker - Replace Destinations Tool
+
+Usage:
+  go run cmd/replace/main.go -find <text> -replace <text> [options]
+
+Options:
+  -h, -help        Show this help message
+  -db <path>       Path to database file (default: urls.db)
+  -find <text>     Text to find in link destinations (required)
+  -replace <text>  Text to replace it with
+  -yes             Apply without asking for confirmation
+
+Examples:
+  # Preview and confirm moving links to a new domain
+  go run cmd/replace/main.go -find old.example.com -replace new.example.com
+
+Description:
+  Replaces text across all link destinations, e.g. for domain migrations.
+  The affected links are listed first and nothing changes until you confirm.
+  Changes are applied in a single transaction. A running server may keep
+  redirecting to old destinations for up to REDIRECT_CACHE_TTL afterwards.
+
+`)
+	}
+
+	flag.Parse()
+
+	if *help || *h {
+		flag.Usage()
+		os.Exit(0)
+	}
+
+	if *find == "" {
+		fmt.Fprintln(os.Stderr, "-find is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Initialize database connection
+	db, err := database.NewDB(*dbPath)
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer db.Close()
+
+	preview, err := db.ReplaceInDestinations(*find, *replace, true)
+	if err != nil {
+		log.Fatal("Failed to find destinations:", err)
+	}
+
+	if len(preview) == 0 {
+		fmt.Printf("No destinations contain %q\n", *find)
+		return
+	}
+
+	fmt.Printf("%d links will change:\n\n", len(preview))
+	for _, url := range preview {
+		fmt.Printf("  /%s → %s\n", url.ShortHash, url.FullURL)
+	}
+	fmt.Println()
+
+	if !*yes && !confirm(fmt.Sprintf("Replace %q with %q in %d links? (y/N): ", *find, *replace, len(preview))) {
+		fmt.Println("Cancelled, nothing was changed.")
+		return
+	}
+
+	changed, err := db.ReplaceInDestinations(*find, *replace, false)
+	if err != nil {
+		log.Fatal("Replace failed, nothing was changed:", err)
+	}
+
+	err = db.RecordAudit(database.AuditEntry{
+		Action: database.AuditURLUpdated,
+		Target: fmt.Sprintf("replaced %q with %q in %d links", *find, *replace, len(changed)),
+	})
+	if err != nil {
+		log.Printf("Warning: failed to record audit entry: %v", err)
+	}
+
+	fmt.Printf("✓ Updated %d links\n", len(changed))
+}
+
+func confirm(prompt string) bool {
+	fmt.Print(prompt)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
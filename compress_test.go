@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`"v1-abc"`, true},
+		{`W/"v1-abc"`, true},
+		{`"v0-def", W/"v1-abc"`, true},
+		{`*`, true},
+		{`"v0-abc"`, false},
+		{``, false},
+	}
+
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, `"v1-abc"`); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestGzippedQRRevalidates(t *testing.T) {
+	testDB := useTestDB(t)
+	if _, err := testDB.CreateURL("https://example.com", "abc123", "", 0); err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+	handler := gzipMiddleware(http.HandlerFunc(qrCodeHandler))
+
+	req := httptest.NewRequest(http.MethodGet, "/qr/abc123?format=svg", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("first request = %d with encoding %q, want a gzipped 200", rec.Code, rec.Header().Get("Content-Encoding"))
+	}
+	etag := rec.Header().Get("ETag")
+	if !strings.HasPrefix(etag, "W/") {
+		t.Fatalf("ETag = %q, want a weak ETag on the gzipped response", etag)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/qr/abc123?format=svg", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("conditional request = %d, want %d", rec.Code, http.StatusNotModified)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("304 response has a %d byte body", rec.Body.Len())
+	}
+}
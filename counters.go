@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// countersReconcileInterval is how often the cached totals are replaced with
+// fresh figures from the database. It bounds how long changes made outside
+// this process, such as CLI imports, take to show up.
+const countersReconcileInterval = time.Minute
+
+// linkCounters caches site-wide totals for the home page summary so it
+// doesn't aggregate the whole urls table on every load. Handlers adjust the
+// counts as links are created and clicked, and they're periodically
+// reconciled against the database.
+type linkCounters struct {
+	mu     sync.Mutex
+	links  int
+	clicks int
+}
+
+var counters linkCounters
+
+func (c *linkCounters) addLink() {
+	c.mu.Lock()
+	c.links++
+	c.mu.Unlock()
+}
+
+func (c *linkCounters) addClick() {
+	c.mu.Lock()
+	c.clicks++
+	c.mu.Unlock()
+}
+
+// totals returns the cached number of links and clicks.
+func (c *linkCounters) totals() (links, clicks int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.links, c.clicks
+}
+
+// reconcile replaces the cached totals with the database's.
+func (c *linkCounters) reconcile() error {
+	links, clicks, err := db.GetTotals()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.links, c.clicks = links, clicks
+	c.mu.Unlock()
+	return nil
+}
+
+// runCountersReconciler reconciles the counters every
+// countersReconcileInterval until ctx is cancelled.
+func runCountersReconciler(ctx context.Context) {
+	ticker := time.NewTicker(countersReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := counters.reconcile(); err != nil {
+				log.Printf("Error reconciling link counters: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// CreateAlias adds aliasHash as an alias of the link with canonicalHash. If
+// that link is itself an alias, the new alias points to its canonical link
+// instead, so aliases never chain. The alias starts with the canonical
+// link's destination, title and domain. It returns sql.ErrNoRows if the
+// canonical link doesn't exist.
+func (db *DB) CreateAlias(canonicalHash, aliasHash string, userID int) (*URL, error) {
+	var alias *URL
+	err := retryOnBusy(func() error {
+		var err error
+		alias, err = db.createAlias(canonicalHash, aliasHash, userID)
+		return err
+	})
+	return alias, err
+}
+
+func (db *DB) createAlias(canonicalHash, aliasHash string, userID int) (*URL, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	canonical, err := scanURL(tx.QueryRow(`SELECT `+urlColumns+` FROM urls WHERE short_hash = ?`, canonicalHash))
+	if err != nil {
+		return nil, err
+	}
+	if canonical.AliasOf != 0 {
+		canonical, err = scanURL(tx.QueryRow(`SELECT `+urlColumns+` FROM urls WHERE id = ?`, canonical.AliasOf))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var creator sql.NullInt64
+	if userID != 0 {
+		creator = sql.NullInt64{Int64: int64(userID), Valid: true}
+	}
+
+	now := time.Now()
+	result, err := tx.Exec(`
+		INSERT INTO urls (full_url, short_hash, short_hash_lower, title, user_id, domain, alias_of, created_at, clicks)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, 0)
+	`, canonical.FullURL, aliasHash, strings.ToLower(aliasHash), canonical.Title, creator, canonical.Domain, canonical.ID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &URL{
+		ID:        int(id),
+		FullURL:   canonical.FullURL,
+		ShortHash: aliasHash,
+		CreatedAt: now,
+		Title:     canonical.Title,
+		UserID:    userID,
+		Domain:    canonical.Domain,
+		AliasOf:   canonical.ID,
+		Health:    HealthUnchecked,
+	}, nil
+}
+
+// GetAliases returns the aliases of the link with the given ID, oldest first.
+func (db *DB) GetAliases(urlID int) ([]URL, error) {
+	query := `
+		SELECT ` + urlColumns + `
+		FROM urls
+		WHERE alias_of = ?
+		ORDER BY id
+	`
+
+	rows, err := db.conn.Query(query, urlID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var aliases []URL
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, url)
+	}
+
+	return aliases, rows.Err()
+}
@@ -0,0 +1,94 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Audit actions recorded for administrative changes.
+const (
+	AuditUserCreated      = "user.created"
+	AuditUserDeleted      = "user.deleted"
+	AuditPasswordChanged  = "user.password_changed"
+	AuditSessionsRevoked  = "user.sessions_revoked"
+	AuditTOTPEnabled      = "user.totp_enabled"
+	AuditTOTPDisabled     = "user.totp_disabled"
+	AuditHashPrefixSet    = "user.hash_prefix_set"
+	AuditURLUpdated       = "url.updated"
+	AuditURLDeleted       = "url.deleted"
+	AuditURLsImported     = "url.imported"
+	AuditURLsMerged       = "url.merged"
+	AuditClicksReconciled = "url.clicks_reconciled"
+	AuditAliasCreated     = "url.alias_created"
+	AuditEditTokenCreated = "url.edit_token_created"
+	AuditEditTokenRevoked = "url.edit_token_revoked"
+	AuditQRCacheBumped    = "qr.cache_bumped"
+)
+
+// AuditEntry is a single row of the append-only audit log. ActorUserID is 0
+// when the action was performed outside a web session (e.g. from a CLI tool).
+type AuditEntry struct {
+	ID            int       `json:"id"`
+	ActorUserID   int       `json:"actor_user_id"`
+	ActorUsername string    `json:"actor_username"`
+	Action        string    `json:"action"`
+	Target        string    `json:"target"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+func (db *DB) RecordAudit(entry AuditEntry) error {
+	query := `
+		INSERT INTO audit_log (actor_user_id, action, target, timestamp)
+		VALUES (?, ?, ?, ?)
+	`
+
+	var actor sql.NullInt64
+	if entry.ActorUserID != 0 {
+		actor = sql.NullInt64{Int64: int64(entry.ActorUserID), Valid: true}
+	}
+
+	timestamp := entry.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	_, err := db.exec(query, actor, entry.Action, entry.Target, timestamp)
+	return err
+}
+
+func (db *DB) GetAuditLog(limit int) ([]AuditEntry, error) {
+	query := `
+		SELECT a.id, a.actor_user_id, COALESCE(u.username, ''), a.action, a.target, a.timestamp
+		FROM audit_log a
+		LEFT JOIN users u ON u.id = a.actor_user_id
+		ORDER BY a.timestamp DESC, a.id DESC
+		LIMIT ?
+	`
+
+	rows, err := db.conn.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		var actor sql.NullInt64
+		err := rows.Scan(
+			&entry.ID,
+			&actor,
+			&entry.ActorUsername,
+			&entry.Action,
+			&entry.Target,
+			&entry.Timestamp,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entry.ActorUserID = int(actor.Int64)
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,208 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// URLUpdate is one destination change in a bulk update.
+type URLUpdate struct {
+	ShortHash string
+	FullURL   string
+}
+
+// BulkUpdateURLs changes the destinations of several links in a single
+// transaction. The result has one entry per update, in order, reporting
+// whether a link with that hash existed and was updated. Unknown hashes don't
+// fail the batch. Aliases aren't updated, since they follow their canonical
+// link's destination.
+func (db *DB) BulkUpdateURLs(updates []URLUpdate) ([]bool, error) {
+	now := time.Now()
+	args := make([][]any, len(updates))
+	for i, u := range updates {
+		args[i] = []any{u.FullURL, now, u.ShortHash}
+	}
+	return db.bulkUpdate(`UPDATE urls SET full_url = ?, updated_at = ? WHERE short_hash = ? AND alias_of IS NULL`, args)
+}
+
+// TitleUpdate is one title change in a bulk title update.
+type TitleUpdate struct {
+	ShortHash string
+	Title     string
+}
+
+// BulkUpdateTitles sets the titles of several links in a single
+// transaction. Like BulkUpdateURLs, the result reports per update whether a
+// link with that hash existed, and unknown hashes don't fail the batch.
+func (db *DB) BulkUpdateTitles(updates []TitleUpdate) ([]bool, error) {
+	now := time.Now()
+	args := make([][]any, len(updates))
+	for i, u := range updates {
+		args[i] = []any{u.Title, now, u.ShortHash}
+	}
+	return db.bulkUpdate(`UPDATE urls SET title = ?, updated_at = ? WHERE short_hash = ?`, args)
+}
+
+// DeleteURLs deletes several links, their aliases and their click events in a
+// single transaction. The result reports per hash whether the link existed.
+func (db *DB) DeleteURLs(hashes []string) ([]bool, error) {
+	var deleted []bool
+	err := retryOnBusy(func() error {
+		var err error
+		deleted, err = db.deleteURLs(hashes)
+		return err
+	})
+	return deleted, err
+}
+
+func (db *DB) deleteURLs(hashes []string) ([]bool, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	deleted := make([]bool, len(hashes))
+	for i, hash := range hashes {
+		_, err := tx.Exec(`
+			DELETE FROM click_events WHERE url_id IN (
+				SELECT id FROM urls WHERE short_hash = ? OR alias_of = (SELECT id FROM urls WHERE short_hash = ?)
+			)`, hash, hash)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(`DELETE FROM urls WHERE alias_of = (SELECT id FROM urls WHERE short_hash = ?)`, hash)
+		if err != nil {
+			return nil, err
+		}
+		result, err := tx.Exec(`DELETE FROM urls WHERE short_hash = ?`, hash)
+		if err != nil {
+			return nil, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		deleted[i] = n > 0
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// bulkUpdate runs query once per argument list in one transaction, reporting
+// for each whether it changed a row.
+func (db *DB) bulkUpdate(query string, args [][]any) ([]bool, error) {
+	var updated []bool
+	err := retryOnBusy(func() error {
+		var err error
+		updated, err = db.bulkUpdateTx(query, args)
+		return err
+	})
+	return updated, err
+}
+
+func (db *DB) bulkUpdateTx(query string, args [][]any) ([]bool, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	updated := make([]bool, len(args))
+	for i, a := range args {
+		result, err := stmt.Exec(a...)
+		if err != nil {
+			return nil, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		updated[i] = n > 0
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// ReplaceInDestinations replaces every occurrence of find in link
+// destinations with replace. It returns the affected links with FullURL set
+// to the new destination. With dryRun nothing is changed, so the result
+// previews what a real run would do; otherwise all changes are made in one
+// transaction.
+func (db *DB) ReplaceInDestinations(find, replace string, dryRun bool) ([]URL, error) {
+	if find == "" {
+		return nil, errors.New("find must not be empty")
+	}
+
+	var affected []URL
+	err := retryOnBusy(func() error {
+		var err error
+		affected, err = db.replaceInDestinations(find, replace, dryRun)
+		return err
+	})
+	return affected, err
+}
+
+func (db *DB) replaceInDestinations(find, replace string, dryRun bool) ([]URL, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT ` + urlColumns + `
+		FROM urls
+		WHERE instr(full_url, ?) > 0
+		ORDER BY id
+	`
+	rows, err := tx.Query(query, find)
+	if err != nil {
+		return nil, err
+	}
+
+	var affected []URL
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		url.FullURL = strings.ReplaceAll(url.FullURL, find, replace)
+		affected = append(affected, url)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return affected, nil
+	}
+
+	now := time.Now()
+	for i, url := range affected {
+		if _, err := tx.Exec(`UPDATE urls SET full_url = ?, updated_at = ? WHERE id = ?`, url.FullURL, now, url.ID); err != nil {
+			return nil, err
+		}
+		affected[i].UpdatedAt = &now
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return affected, nil
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrCampaignExists is returned when creating a campaign whose name is taken.
+var ErrCampaignExists = errors.New("a campaign with that name already exists")
+
+// Campaign groups related links. Links and Clicks are aggregates over the
+// campaign's links.
+type Campaign struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Links     int       `json:"links"`
+	Clicks    int       `json:"clicks"`
+}
+
+// CreateCampaign adds a campaign, returning ErrCampaignExists if the name is
+// already used.
+func (db *DB) CreateCampaign(name string) (*Campaign, error) {
+	now := time.Now()
+	result, err := db.exec(`INSERT INTO campaigns (name, created_at) VALUES (?, ?)`, name, now)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return nil, ErrCampaignExists
+		}
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Campaign{ID: int(id), Name: name, CreatedAt: now}, nil
+}
+
+const campaignQuery = `
+	SELECT campaigns.id, campaigns.name, campaigns.created_at,
+		COUNT(urls.id), COALESCE(SUM(urls.clicks), 0)
+	FROM campaigns
+	LEFT JOIN urls ON urls.campaign_id = campaigns.id
+`
+
+func scanCampaign(row rowScanner) (Campaign, error) {
+	var c Campaign
+	err := row.Scan(&c.ID, &c.Name, &c.CreatedAt, &c.Links, &c.Clicks)
+	return c, err
+}
+
+// GetCampaigns returns all campaigns with their link and click totals,
+// newest first.
+func (db *DB) GetCampaigns() ([]Campaign, error) {
+	rows, err := db.conn.Query(campaignQuery + `
+		GROUP BY campaigns.id
+		ORDER BY campaigns.created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var campaigns []Campaign
+	for rows.Next() {
+		c, err := scanCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, c)
+	}
+
+	return campaigns, rows.Err()
+}
+
+// GetCampaign returns a campaign with its totals, or sql.ErrNoRows.
+func (db *DB) GetCampaign(id int) (*Campaign, error) {
+	c, err := scanCampaign(db.conn.QueryRow(campaignQuery+`
+		WHERE campaigns.id = ?
+		GROUP BY campaigns.id
+	`, id))
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// AssignURLToCampaign moves a link into a campaign. A campaignID of 0
+// removes it from its campaign. It returns sql.ErrNoRows if the link
+// doesn't exist.
+func (db *DB) AssignURLToCampaign(shortHash string, campaignID int) error {
+	var campaign sql.NullInt64
+	if campaignID != 0 {
+		campaign = sql.NullInt64{Int64: int64(campaignID), Valid: true}
+	}
+
+	result, err := db.exec(`UPDATE urls SET campaign_id = ? WHERE short_hash = ?`, campaign, shortHash)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetURLsByCampaign returns a campaign's links, newest first.
+func (db *DB) GetURLsByCampaign(id int) ([]URL, error) {
+	rows, err := db.conn.Query(`
+		SELECT `+urlColumns+`
+		FROM urls
+		WHERE campaign_id = ?
+		ORDER BY created_at DESC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []URL
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+
+	return urls, rows.Err()
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"time"
+)
+
+// ClickEvent is a single recorded visit to a short link.
+type ClickEvent struct {
+	ID        int       `json:"id"`
+	ClickedAt time.Time `json:"clicked_at"`
+	Referrer  string    `json:"referrer"`
+	UserAgent string    `json:"user_agent"`
+	// SampleRate is the number of clicks the event stands for: 1 when every
+	// click was recorded, N when one in N was.
+	SampleRate int `json:"sample_rate"`
+}
+
+// RecordClickEvent stores one visit to the link with the given ID, sampled
+// at one in sampleRate clicks.
+func (db *DB) RecordClickEvent(urlID int, referrer, userAgent string, sampleRate int) error {
+	query := `
+		INSERT INTO click_events (url_id, clicked_at, referrer, user_agent, sample_rate)
+		VALUES (?, ?, ?, ?, ?)
+	`
+
+	_, err := db.exec(query, urlID, time.Now(), referrer, userAgent, max(sampleRate, 1))
+	return err
+}
+
+// pruneBatchSize is the number of click events deleted per statement, so
+// pruning a large backlog doesn't hold the write lock for long.
+const pruneBatchSize = 5000
+
+// PruneClickEvents deletes click events recorded before the given time and
+// returns how many were deleted. The links' aggregate click counters are
+// left untouched.
+func (db *DB) PruneClickEvents(before time.Time) (int, error) {
+	query := `
+		DELETE FROM click_events
+		WHERE id IN (SELECT id FROM click_events WHERE clicked_at < ? LIMIT ?)
+	`
+
+	total := 0
+	for {
+		result, err := db.exec(query, before, pruneBatchSize)
+		if err != nil {
+			return total, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += int(n)
+		if n < pruneBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// linkAndAliases matches click events of the link with the given hash and of
+// its aliases, whose clicks count towards the canonical link's stats.
+const linkAndAliases = `(urls.short_hash = ? OR urls.alias_of = (SELECT id FROM urls WHERE short_hash = ?))`
+
+// GetClickEvents returns a link's click events, including its aliases',
+// newest first. since, when set, excludes earlier events. A limit of zero or
+// less returns every matching event.
+func (db *DB) GetClickEvents(shortHash string, limit, offset int, since *time.Time) ([]ClickEvent, error) {
+	query := `
+		SELECT click_events.id, click_events.clicked_at, click_events.referrer, click_events.user_agent, click_events.sample_rate
+		FROM click_events
+		JOIN urls ON urls.id = click_events.url_id
+		WHERE ` + linkAndAliases + `
+	`
+	args := []any{shortHash, shortHash}
+
+	if since != nil {
+		query += ` AND click_events.clicked_at >= ?`
+		args = append(args, *since)
+	}
+
+	if limit <= 0 {
+		limit = -1
+	}
+	query += ` ORDER BY click_events.clicked_at DESC, click_events.id DESC LIMIT ? OFFSET ?`
+	args = append(args, limit, offset)
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []ClickEvent
+	for rows.Next() {
+		var e ClickEvent
+		if err := rows.Scan(&e.ID, &e.ClickedAt, &e.Referrer, &e.UserAgent, &e.SampleRate); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// DailyClicks is the number of clicks a link got on one day.
+type DailyClicks struct {
+	Date   string `json:"date"` // YYYY-MM-DD
+	Clicks int    `json:"clicks"`
+}
+
+// sqliteMinuteLayout is the format of strftime('%Y-%m-%d %H:%M'), in UTC.
+const sqliteMinuteLayout = "2006-01-02 15:04"
+
+// GetDailyClicks returns a link's clicks per day in loc, including its
+// aliases', from the day of from to the day of to inclusive, oldest first.
+// Days without clicks are included with zero clicks. Sampled events count
+// for the clicks they stand for, so those days are estimates.
+func (db *DB) GetDailyClicks(shortHash string, from, to time.Time, loc *time.Location) ([]DailyClicks, error) {
+	from, to = from.In(loc), to.In(loc)
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	end := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, loc)
+
+	// Clicks are counted per UTC minute and the minutes assigned to days in
+	// loc here, since SQLite can't convert to a named zone. Every zone
+	// offset is a whole number of minutes.
+	query := `
+		SELECT strftime('%Y-%m-%d %H:%M', click_events.clicked_at), SUM(click_events.sample_rate)
+		FROM click_events
+		JOIN urls ON urls.id = click_events.url_id
+		WHERE ` + linkAndAliases + `
+			AND datetime(click_events.clicked_at) >= ? AND datetime(click_events.clicked_at) < ?
+		GROUP BY 1
+	`
+
+	rangeStart := start.UTC().Format(time.DateTime)
+	rangeEnd := end.AddDate(0, 0, 1).UTC().Format(time.DateTime)
+	rows, err := db.conn.Query(query, shortHash, shortHash, rangeStart, rangeEnd)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var minute string
+		var clicks int
+		if err := rows.Scan(&minute, &clicks); err != nil {
+			return nil, err
+		}
+		t, err := time.ParseInLocation(sqliteMinuteLayout, minute, time.UTC)
+		if err != nil {
+			return nil, err
+		}
+		counts[t.In(loc).Format(time.DateOnly)] += clicks
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var series []DailyClicks
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		date := day.Format(time.DateOnly)
+		series = append(series, DailyClicks{Date: date, Clicks: counts[date]})
+	}
+	return series, nil
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// DashboardStats are aggregate figures for the dashboard widget.
+type DashboardStats struct {
+	TotalLinks  int  `json:"total_links"`
+	TotalClicks int  `json:"total_clicks"`
+	LinksToday  int  `json:"links_today"`
+	TopLink     *URL `json:"top_link"`
+}
+
+// GetTotals returns the number of links and the sum of their clicks across
+// all links.
+func (db *DB) GetTotals() (links, clicks int, err error) {
+	query := `SELECT COUNT(*), COALESCE(SUM(clicks), 0) FROM urls`
+	err = db.conn.QueryRow(query).Scan(&links, &clicks)
+	return links, clicks, err
+}
+
+// GetDashboardStats returns totals across the links created by userID, or
+// across all links when userID is 0. "Today" starts at local midnight.
+// TopLink is the most clicked link, or nil when there are no links.
+func (db *DB) GetDashboardStats(userID int) (*DashboardStats, error) {
+	where, args := "1 = 1", []any{}
+	if userID != 0 {
+		where, args = "user_id = ?", []any{userID}
+	}
+
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	var stats DashboardStats
+	query := `
+		SELECT COUNT(*), COALESCE(SUM(clicks), 0), COUNT(CASE WHEN created_at >= ? THEN 1 END)
+		FROM urls
+		WHERE ` + where
+	err := db.conn.QueryRow(query, append([]any{midnight}, args...)...).Scan(&stats.TotalLinks, &stats.TotalClicks, &stats.LinksToday)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT ` + urlColumns + `
+		FROM urls
+		WHERE ` + where + `
+		ORDER BY clicks DESC, created_at DESC
+		LIMIT 1
+	`
+	top, err := scanURL(db.conn.QueryRow(query, args...))
+	if err == nil {
+		stats.TopLink = &top
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// RecentClick is a click event with the hash of the link it was on.
+type RecentClick struct {
+	ClickEvent
+	ShortHash string `json:"short_hash"`
+}
+
+// GetRecentClicks returns the latest click events across all links, newest
+// first.
+func (db *DB) GetRecentClicks(limit int) ([]RecentClick, error) {
+	query := `
+		SELECT click_events.id, click_events.clicked_at, click_events.referrer, click_events.user_agent,
+			click_events.sample_rate, urls.short_hash
+		FROM click_events
+		JOIN urls ON urls.id = click_events.url_id
+		ORDER BY click_events.clicked_at DESC, click_events.id DESC
+		LIMIT ?
+	`
+	rows, err := db.conn.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clicks []RecentClick
+	for rows.Next() {
+		var c RecentClick
+		if err := rows.Scan(&c.ID, &c.ClickedAt, &c.Referrer, &c.UserAgent, &c.SampleRate, &c.ShortHash); err != nil {
+			return nil, err
+		}
+		clicks = append(clicks, c)
+	}
+	return clicks, rows.Err()
+}
+
+// StorageSize returns the size of the database in bytes, from SQLite's page
+// count and page size. A write-ahead log not yet checkpointed isn't included.
+func (db *DB) StorageSize() (int64, error) {
+	var pages, pageSize int64
+	if err := db.conn.QueryRow(`PRAGMA page_count`).Scan(&pages); err != nil {
+		return 0, err
+	}
+	if err := db.conn.QueryRow(`PRAGMA page_size`).Scan(&pageSize); err != nil {
+		return 0, err
+	}
+	return pages * pageSize, nil
+}
@@ -2,7 +2,9 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -14,17 +16,142 @@ type URL struct {
 	ShortHash string    `json:"short_hash"`
 	CreatedAt time.Time `json:"created_at"`
 	Clicks    int       `json:"clicks"`
+	QRViews   int       `json:"qr_views"`
+	Title     string    `json:"title"`
+	UserID    int       `json:"user_id,omitempty"`
+	// LastClickedAt is nil for links that have never been clicked.
+	LastClickedAt *time.Time `json:"last_clicked_at"`
+	CampaignID    int        `json:"campaign_id,omitempty"`
+	// Domain is the vanity domain the link is served from, or empty for the
+	// default BASE_URL host.
+	Domain string `json:"domain,omitempty"`
+	// PublicStats overrides the PUBLIC_STATS default for showing the link's
+	// click counts to anonymous visitors. nil follows the default.
+	PublicStats *bool `json:"public_stats,omitempty"`
+	// UpdatedAt is when the destination or title was last edited, nil for
+	// links that have never been edited.
+	UpdatedAt *time.Time `json:"updated_at"`
+	// AliasOf is the ID of the canonical link this link is an alias of, or 0
+	// for links that aren't aliases.
+	AliasOf int `json:"alias_of,omitempty"`
+	// ForwardQuery overrides the FEATURE_FORWARD_QUERY default for passing
+	// the short link's query string on to the destination. nil follows the
+	// default.
+	ForwardQuery *bool `json:"forward_query,omitempty"`
+	// QRPreview overrides the FEATURE_QR_PREVIEW default for having the
+	// link's QR codes open its preview page. nil follows the default.
+	QRPreview *bool `json:"qr_preview,omitempty"`
+	// ClickSampleRate overrides the CLICK_SAMPLE_RATE default: one in this
+	// many of the link's clicks is recorded as a click event. 0 follows the
+	// default.
+	ClickSampleRate int `json:"click_sample_rate,omitempty"`
+	// LastStatus is the HTTP status the destination answered its last check
+	// with, 0 if that check got no response. LastChecked is nil for links
+	// that have never been checked.
+	LastStatus  int        `json:"last_status,omitempty"`
+	LastChecked *time.Time `json:"last_checked"`
+	// Health is HealthOK, HealthBroken or HealthUnchecked, computed from the
+	// last check.
+	Health string `json:"health"`
+}
+
+// URLWithCreator is a URL along with the username of the user who created
+// it. CreatorUsername is empty for legacy links without a recorded creator
+// or whose creator has been deleted.
+type URLWithCreator struct {
+	URL
+	CreatorUsername string `json:"creator_username"`
+}
+
+// urlColumns lists the urls columns read by scanURL, in scan order.
+const urlColumns = `id, full_url, short_hash, created_at, clicks, qr_views, title, user_id, last_clicked_at, campaign_id, domain, public_stats, updated_at, alias_of, forward_query, last_status, last_checked, qr_preview, click_sample_rate`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanURL(row rowScanner, extra ...any) (URL, error) {
+	var url URL
+	var userID sql.NullInt64
+	var lastClicked sql.NullTime
+	var campaignID sql.NullInt64
+	var publicStats sql.NullBool
+	var updated sql.NullTime
+	var aliasOf sql.NullInt64
+	var forwardQuery sql.NullBool
+	var lastStatus sql.NullInt64
+	var lastChecked sql.NullTime
+	var qrPreview sql.NullBool
+	var clickSampleRate sql.NullInt64
+	dest := append([]any{
+		&url.ID,
+		&url.FullURL,
+		&url.ShortHash,
+		&url.CreatedAt,
+		&url.Clicks,
+		&url.QRViews,
+		&url.Title,
+		&userID,
+		&lastClicked,
+		&campaignID,
+		&url.Domain,
+		&publicStats,
+		&updated,
+		&aliasOf,
+		&forwardQuery,
+		&lastStatus,
+		&lastChecked,
+		&qrPreview,
+		&clickSampleRate,
+	}, extra...)
+
+	err := row.Scan(dest...)
+	url.UserID = int(userID.Int64)
+	url.CampaignID = int(campaignID.Int64)
+	url.AliasOf = int(aliasOf.Int64)
+	if lastClicked.Valid {
+		url.LastClickedAt = &lastClicked.Time
+	}
+	if publicStats.Valid {
+		url.PublicStats = &publicStats.Bool
+	}
+	if updated.Valid {
+		url.UpdatedAt = &updated.Time
+	}
+	if forwardQuery.Valid {
+		url.ForwardQuery = &forwardQuery.Bool
+	}
+	url.LastStatus = int(lastStatus.Int64)
+	if lastChecked.Valid {
+		url.LastChecked = &lastChecked.Time
+	}
+	url.Health = linkHealth(url.LastStatus, url.LastChecked)
+	if qrPreview.Valid {
+		url.QRPreview = &qrPreview.Bool
+	}
+	url.ClickSampleRate = int(clickSampleRate.Int64)
+	return url, err
 }
 
 type User struct {
-	ID           int       `json:"id"`
-	Username     string    `json:"username"`
-	PasswordHash string    `json:"-"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID             int       `json:"id"`
+	Username       string    `json:"username"`
+	PasswordHash   string    `json:"-"`
+	CreatedAt      time.Time `json:"created_at"`
+	SessionVersion int       `json:"-"`
+	// TOTPSecret is the base32 two-factor secret, empty when two-factor
+	// authentication is off.
+	TOTPSecret string `json:"-"`
+	// HashPrefix limits the user to creating links whose hashes start with
+	// it and utils.PrefixSeparator. Empty means unrestricted.
+	HashPrefix string `json:"hash_prefix,omitempty"`
 }
 
 type DB struct {
 	conn *sql.DB
+	// returning is whether the SQLite library supports RETURNING clauses,
+	// added in 3.35.0.
+	returning bool
 }
 
 func NewDB(dataSourceName string) (*DB, error) {
@@ -37,11 +164,24 @@ func NewDB(dataSourceName string) (*DB, error) {
 		return nil, err
 	}
 
+	// WAL lets readers proceed while a write is in progress, which makes
+	// locked-database errors much rarer under concurrent requests.
+	if _, err := conn.Exec("PRAGMA journal_mode=WAL"); err != nil {
+		return nil, err
+	}
+
 	db := &DB{conn: conn}
+	if db.returning, err = supportsReturning(conn); err != nil {
+		return nil, err
+	}
 	if err := db.createTables(); err != nil {
 		return nil, err
 	}
 
+	if err := db.migrate(); err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
 
@@ -65,6 +205,55 @@ func (db *DB) createTables() error {
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_username ON users(username);
+
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		actor_user_id INTEGER,
+		action TEXT NOT NULL,
+		target TEXT NOT NULL,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_audit_timestamp ON audit_log(timestamp);
+
+	CREATE TABLE IF NOT EXISTS campaigns (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT UNIQUE NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS recovery_codes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		code_hash TEXT NOT NULL,
+		used_at DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON recovery_codes(user_id);
+
+	CREATE TABLE IF NOT EXISTS click_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url_id INTEGER NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+		clicked_at DATETIME NOT NULL,
+		referrer TEXT NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_click_events_url ON click_events(url_id, clicked_at);
+	CREATE INDEX IF NOT EXISTS idx_click_events_clicked_at ON click_events(clicked_at);
+
+	-- The audit log is append-only
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_update
+	BEFORE UPDATE ON audit_log
+	BEGIN
+		SELECT RAISE(ABORT, 'audit_log is append-only');
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_delete
+	BEFORE DELETE ON audit_log
+	BEGIN
+		SELECT RAISE(ABORT, 'audit_log is append-only');
+	END;
 	`
 
 	_, err := db.conn.Exec(query)
@@ -76,17 +265,96 @@ func (db *DB) createTables() error {
 	return nil
 }
 
+// migrate adds columns introduced after the initial schema to existing databases.
+func (db *DB) migrate() error {
+	migrations := []struct {
+		table, column, definition string
+	}{
+		{"users", "session_version", "INTEGER NOT NULL DEFAULT 0"},
+		{"users", "totp_secret", "TEXT NOT NULL DEFAULT ''"},
+		{"users", "totp_last_step", "INTEGER NOT NULL DEFAULT 0"},
+		{"users", "hash_prefix", "TEXT NOT NULL DEFAULT ''"},
+		{"urls", "qr_views", "INTEGER NOT NULL DEFAULT 0"},
+		{"urls", "short_hash_lower", "TEXT"},
+		{"urls", "title", "TEXT NOT NULL DEFAULT ''"},
+		{"urls", "user_id", "INTEGER REFERENCES users(id)"},
+		{"urls", "last_clicked_at", "DATETIME"},
+		{"urls", "campaign_id", "INTEGER REFERENCES campaigns(id)"},
+		{"urls", "domain", "TEXT NOT NULL DEFAULT ''"},
+		{"urls", "public_stats", "BOOLEAN"},
+		{"urls", "updated_at", "DATETIME"},
+		{"urls", "alias_of", "INTEGER REFERENCES urls(id)"},
+		{"urls", "edit_token_hash", "TEXT NOT NULL DEFAULT ''"},
+		{"urls", "forward_query", "BOOLEAN"},
+		{"urls", "last_status", "INTEGER"},
+		{"urls", "last_checked", "DATETIME"},
+		{"urls", "qr_preview", "BOOLEAN"},
+		{"urls", "click_sample_rate", "INTEGER"},
+		{"click_events", "sample_rate", "INTEGER NOT NULL DEFAULT 1"},
+	}
+
+	for _, m := range migrations {
+		if err := db.addColumnIfMissing(m.table, m.column, m.definition); err != nil {
+			return err
+		}
+	}
+
+	// Backfill and index the normalized hash used for case-insensitive lookups
+	_, err := db.conn.Exec(`
+		UPDATE urls SET short_hash_lower = lower(short_hash) WHERE short_hash_lower IS NULL;
+		CREATE INDEX IF NOT EXISTS idx_short_hash_lower ON urls(short_hash_lower);
+	`)
+	return err
+}
+
+func (db *DB) addColumnIfMissing(table, column, definition string) error {
+	rows, err := db.conn.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = db.conn.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Added column %s.%s", table, column)
+	return nil
+}
+
 func (db *DB) Close() error {
 	return db.conn.Close()
 }
 
-func (db *DB) CreateURL(fullURL, shortHash string) (*URL, error) {
+// CreateURL stores a new link. userID records the creator; pass 0 when the
+// link isn't created by a logged-in user.
+func (db *DB) CreateURL(fullURL, shortHash, title string, userID int) (*URL, error) {
 	query := `
-		INSERT INTO urls (full_url, short_hash, created_at, clicks)
-		VALUES (?, ?, ?, 0)
+		INSERT INTO urls (full_url, short_hash, short_hash_lower, title, user_id, created_at, clicks)
+		VALUES (?, ?, ?, ?, ?, ?, 0)
 	`
 
-	result, err := db.conn.Exec(query, fullURL, shortHash, time.Now())
+	var creator sql.NullInt64
+	if userID != 0 {
+		creator = sql.NullInt64{Int64: int64(userID), Valid: true}
+	}
+
+	result, err := db.exec(query, fullURL, shortHash, strings.ToLower(shortHash), title, creator, time.Now())
 	if err != nil {
 		return nil, err
 	}
@@ -102,25 +370,55 @@ func (db *DB) CreateURL(fullURL, shortHash string) (*URL, error) {
 		ShortHash: shortHash,
 		CreatedAt: time.Now(),
 		Clicks:    0,
+		Title:     title,
+		UserID:    userID,
+		Health:    HealthUnchecked,
 	}, nil
 }
 
 func (db *DB) GetURLByHash(shortHash string) (*URL, error) {
 	query := `
-		SELECT id, full_url, short_hash, created_at, clicks
+		SELECT ` + urlColumns + `
 		FROM urls
 		WHERE short_hash = ?
 	`
 
-	var url URL
-	err := db.conn.QueryRow(query, shortHash).Scan(
-		&url.ID,
-		&url.FullURL,
-		&url.ShortHash,
-		&url.CreatedAt,
-		&url.Clicks,
-	)
+	url, err := scanURL(db.conn.QueryRow(query, shortHash))
+	if err != nil {
+		return nil, err
+	}
+
+	return &url, nil
+}
+
+// GetURLByID returns sql.ErrNoRows when no link has that ID.
+func (db *DB) GetURLByID(id int) (*URL, error) {
+	query := `
+		SELECT ` + urlColumns + `
+		FROM urls
+		WHERE id = ?
+	`
+
+	url, err := scanURL(db.conn.QueryRow(query, id))
+	if err != nil {
+		return nil, err
+	}
+
+	return &url, nil
+}
+
+// GetURLByHashFold looks up a link ignoring case. An exact match is
+// preferred when several hashes differ only by case.
+func (db *DB) GetURLByHashFold(shortHash string) (*URL, error) {
+	query := `
+		SELECT ` + urlColumns + `
+		FROM urls
+		WHERE short_hash_lower = ?
+		ORDER BY short_hash = ? DESC, id
+		LIMIT 1
+	`
 
+	url, err := scanURL(db.conn.QueryRow(query, strings.ToLower(shortHash), shortHash))
 	if err != nil {
 		return nil, err
 	}
@@ -131,17 +429,205 @@ func (db *DB) GetURLByHash(shortHash string) (*URL, error) {
 func (db *DB) IncrementClicks(shortHash string) error {
 	query := `
 		UPDATE urls
-		SET clicks = clicks + 1
+		SET clicks = clicks + 1, last_clicked_at = ?
+		WHERE short_hash = ?
+	`
+
+	_, err := db.exec(query, time.Now(), shortHash)
+	return err
+}
+
+// ClickURL counts a click on a link and returns its destination, read in the
+// same statement as the increment so concurrent redirects can't interleave
+// between them. It returns sql.ErrNoRows if the link doesn't exist. With a
+// SQLite older than 3.35, which has no RETURNING, the update and the read run
+// in one transaction instead.
+func (db *DB) ClickURL(shortHash string) (string, error) {
+	if !db.returning {
+		return db.clickURLTx(shortHash)
+	}
+
+	query := `
+		UPDATE urls
+		SET clicks = clicks + 1, last_clicked_at = ?
+		WHERE short_hash = ?
+		RETURNING full_url
+	`
+
+	var fullURL string
+	err := retryOnBusy(func() error {
+		return db.conn.QueryRow(query, time.Now(), shortHash).Scan(&fullURL)
+	})
+	return fullURL, err
+}
+
+// clickURLTx is ClickURL for SQLite versions without RETURNING.
+func (db *DB) clickURLTx(shortHash string) (string, error) {
+	var fullURL string
+	err := retryOnBusy(func() error {
+		tx, err := db.conn.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		result, err := tx.Exec(`UPDATE urls SET clicks = clicks + 1, last_clicked_at = ? WHERE short_hash = ?`, time.Now(), shortHash)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return sql.ErrNoRows
+		}
+		if err := tx.QueryRow(`SELECT full_url FROM urls WHERE short_hash = ?`, shortHash).Scan(&fullURL); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+	return fullURL, err
+}
+
+// supportsReturning reports whether the SQLite library behind conn is 3.35.0
+// or newer, the first version with RETURNING.
+func supportsReturning(conn *sql.DB) (bool, error) {
+	var version string
+	if err := conn.QueryRow(`SELECT sqlite_version()`).Scan(&version); err != nil {
+		return false, err
+	}
+	var major, minor int
+	if _, err := fmt.Sscanf(version, "%d.%d", &major, &minor); err != nil {
+		return false, fmt.Errorf("unrecognised SQLite version %q", version)
+	}
+	return major > 3 || major == 3 && minor >= 35, nil
+}
+
+// SetURLDomain sets the vanity domain a link is served from. An empty domain
+// moves it back to the default host. It returns sql.ErrNoRows if the link
+// doesn't exist.
+func (db *DB) SetURLDomain(shortHash, domain string) error {
+	result, err := db.exec(`UPDATE urls SET domain = ? WHERE short_hash = ?`, domain, shortHash)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetURLPublicStats overrides whether a link's click counts are public. nil
+// clears the override so the link follows the global default. It returns
+// sql.ErrNoRows if the link doesn't exist.
+func (db *DB) SetURLPublicStats(shortHash string, public *bool) error {
+	var value sql.NullBool
+	if public != nil {
+		value = sql.NullBool{Bool: *public, Valid: true}
+	}
+
+	result, err := db.exec(`UPDATE urls SET public_stats = ? WHERE short_hash = ?`, value, shortHash)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetURLForwardQuery overrides whether a link passes its query string on to
+// the destination. nil clears the override so the link follows the global
+// default. It returns sql.ErrNoRows if the link doesn't exist.
+func (db *DB) SetURLForwardQuery(shortHash string, forward *bool) error {
+	var value sql.NullBool
+	if forward != nil {
+		value = sql.NullBool{Bool: *forward, Valid: true}
+	}
+
+	result, err := db.exec(`UPDATE urls SET forward_query = ? WHERE short_hash = ?`, value, shortHash)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetURLQRPreview overrides whether a link's QR codes open its preview page
+// instead of redirecting. nil clears the override so the link follows the
+// global default. It returns sql.ErrNoRows if the link doesn't exist.
+func (db *DB) SetURLQRPreview(shortHash string, preview *bool) error {
+	var value sql.NullBool
+	if preview != nil {
+		value = sql.NullBool{Bool: *preview, Valid: true}
+	}
+
+	result, err := db.exec(`UPDATE urls SET qr_preview = ? WHERE short_hash = ?`, value, shortHash)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetURLClickSampleRate sets the link's click event sampling rate, recording
+// one in rate clicks. 0 clears it so the link follows the global default. It
+// returns sql.ErrNoRows if the link doesn't exist.
+func (db *DB) SetURLClickSampleRate(shortHash string, rate int) error {
+	var value sql.NullInt64
+	if rate > 0 {
+		value = sql.NullInt64{Int64: int64(rate), Valid: true}
+	}
+
+	result, err := db.exec(`UPDATE urls SET click_sample_rate = ? WHERE short_hash = ?`, value, shortHash)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// IncrementQRViews counts a fetch of the link's QR code image. This is a
+// separate signal from redirect clicks.
+func (db *DB) IncrementQRViews(shortHash string) error {
+	query := `
+		UPDATE urls
+		SET qr_views = qr_views + 1
 		WHERE short_hash = ?
 	`
 
-	_, err := db.conn.Exec(query, shortHash)
+	_, err := db.exec(query, shortHash)
 	return err
 }
 
 func (db *DB) GetAllURLs() ([]URL, error) {
 	query := `
-		SELECT id, full_url, short_hash, created_at, clicks
+		SELECT ` + urlColumns + `
 		FROM urls
 		ORDER BY created_at DESC
 		LIMIT 100
@@ -155,14 +641,7 @@ func (db *DB) GetAllURLs() ([]URL, error) {
 
 	var urls []URL
 	for rows.Next() {
-		var url URL
-		err := rows.Scan(
-			&url.ID,
-			&url.FullURL,
-			&url.ShortHash,
-			&url.CreatedAt,
-			&url.Clicks,
-		)
+		url, err := scanURL(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -172,6 +651,94 @@ func (db *DB) GetAllURLs() ([]URL, error) {
 	return urls, nil
 }
 
+// GetAllHashes returns the short hash of every link.
+func (db *DB) GetAllHashes() ([]string, error) {
+	rows, err := db.conn.Query(`SELECT short_hash FROM urls`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, rows.Err()
+}
+
+// EachURL calls fn for every link in ID order, reading them one at a time so
+// large databases can be exported without loading every link into memory. It
+// stops at the first error fn returns.
+func (db *DB) EachURL(fn func(URL) error) error {
+	rows, err := db.conn.Query(`SELECT ` + urlColumns + ` FROM urls ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(url); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// GetAllURLsWithCreator returns the most recent links joined with the
+// username of their creator.
+func (db *DB) GetAllURLsWithCreator() ([]URLWithCreator, error) {
+	query := `
+		SELECT ` + prefixColumns("urls", urlColumns) + `, COALESCE(users.username, '')
+		FROM urls
+		LEFT JOIN users ON users.id = urls.user_id
+		ORDER BY urls.created_at DESC
+		LIMIT 100
+	`
+
+	rows, err := db.conn.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []URLWithCreator
+	for rows.Next() {
+		var creator string
+		url, err := scanURL(rows, &creator)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, URLWithCreator{URL: url, CreatorUsername: creator})
+	}
+
+	return urls, nil
+}
+
+// prefixColumns qualifies each column in a comma-separated list with table,
+// for use in joins.
+func prefixColumns(table, columns string) string {
+	parts := strings.Split(columns, ",")
+	for i, col := range parts {
+		parts[i] = table + "." + strings.TrimSpace(col)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// CountURLsByUser returns how many links the user has created.
+func (db *DB) CountURLsByUser(userID int) (int, error) {
+	var count int
+	err := db.conn.QueryRow(`SELECT COUNT(*) FROM urls WHERE user_id = ?`, userID).Scan(&count)
+	return count, err
+}
+
 func (db *DB) CheckHashExists(shortHash string) (bool, error) {
 	query := `SELECT EXISTS(SELECT 1 FROM urls WHERE short_hash = ?)`
 	
@@ -180,13 +747,22 @@ func (db *DB) CheckHashExists(shortHash string) (bool, error) {
 	return exists, err
 }
 
+// CheckHashExistsFold reports whether a hash exists ignoring case.
+func (db *DB) CheckHashExistsFold(shortHash string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM urls WHERE short_hash_lower = ?)`
+
+	var exists bool
+	err := db.conn.QueryRow(query, strings.ToLower(shortHash)).Scan(&exists)
+	return exists, err
+}
+
 func (db *DB) CreateUser(username, passwordHash string) (*User, error) {
 	query := `
 		INSERT INTO users (username, password_hash, created_at)
 		VALUES (?, ?, ?)
 	`
 
-	result, err := db.conn.Exec(query, username, passwordHash, time.Now())
+	result, err := db.exec(query, username, passwordHash, time.Now())
 	if err != nil {
 		return nil, err
 	}
@@ -204,9 +780,18 @@ func (db *DB) CreateUser(username, passwordHash string) (*User, error) {
 	}, nil
 }
 
+// CountUsers returns the number of user accounts.
+func (db *DB) CountUsers() (int, error) {
+	var count int
+	err := db.conn.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&count)
+	return count, err
+}
+
+// GetUserByUsername returns sql.ErrNoRows when no user has that username.
+// Any other error means the lookup itself failed.
 func (db *DB) GetUserByUsername(username string) (*User, error) {
 	query := `
-		SELECT id, username, password_hash, created_at
+		SELECT id, username, password_hash, created_at, session_version, totp_secret, hash_prefix
 		FROM users
 		WHERE username = ?
 	`
@@ -217,6 +802,9 @@ func (db *DB) GetUserByUsername(username string) (*User, error) {
 		&user.Username,
 		&user.PasswordHash,
 		&user.CreatedAt,
+		&user.SessionVersion,
+		&user.TOTPSecret,
+		&user.HashPrefix,
 	)
 
 	if err != nil {
@@ -226,9 +814,10 @@ func (db *DB) GetUserByUsername(username string) (*User, error) {
 	return &user, nil
 }
 
+// GetUserByID returns sql.ErrNoRows when no user has that ID.
 func (db *DB) GetUserByID(id int) (*User, error) {
 	query := `
-		SELECT id, username, password_hash, created_at
+		SELECT id, username, password_hash, created_at, session_version, totp_secret, hash_prefix
 		FROM users
 		WHERE id = ?
 	`
@@ -239,6 +828,9 @@ func (db *DB) GetUserByID(id int) (*User, error) {
 		&user.Username,
 		&user.PasswordHash,
 		&user.CreatedAt,
+		&user.SessionVersion,
+		&user.TOTPSecret,
+		&user.HashPrefix,
 	)
 
 	if err != nil {
@@ -250,7 +842,7 @@ func (db *DB) GetUserByID(id int) (*User, error) {
 
 func (db *DB) GetAllUsers() ([]User, error) {
 	query := `
-		SELECT id, username, password_hash, created_at
+		SELECT id, username, password_hash, created_at, session_version, hash_prefix
 		FROM users
 		ORDER BY created_at DESC
 	`
@@ -269,6 +861,8 @@ func (db *DB) GetAllUsers() ([]User, error) {
 			&user.Username,
 			&user.PasswordHash,
 			&user.CreatedAt,
+			&user.SessionVersion,
+			&user.HashPrefix,
 		)
 		if err != nil {
 			return nil, err
@@ -280,19 +874,61 @@ func (db *DB) GetAllUsers() ([]User, error) {
 }
 
 func (db *DB) DeleteUser(id int) error {
-	query := `DELETE FROM users WHERE id = ?`
-	_, err := db.conn.Exec(query, id)
+	query := `
+		DELETE FROM recovery_codes WHERE user_id = ?;
+		DELETE FROM users WHERE id = ?;
+	`
+	_, err := db.exec(query, id, id)
 	return err
 }
 
 func (db *DB) UpdateUserPassword(id int, passwordHash string) error {
 	query := `UPDATE users SET password_hash = ? WHERE id = ?`
-	_, err := db.conn.Exec(query, passwordHash, id)
+	_, err := db.exec(query, passwordHash, id)
 	return err
 }
 
-func (db *DB) UpdateURL(shortHash, newFullURL string) error {
-	query := `UPDATE urls SET full_url = ? WHERE short_hash = ?`
-	_, err := db.conn.Exec(query, newFullURL, shortHash)
+// UpdateURL changes a link's destination and title and records the time in
+// updated_at. With resetClicks the click count and last-clicked time are
+// cleared in the same statement, for links being repurposed.
+func (db *DB) UpdateURL(shortHash, newFullURL, title string, resetClicks bool) error {
+	query := `UPDATE urls SET full_url = ?, title = ?, updated_at = ? WHERE short_hash = ?`
+	if resetClicks {
+		query = `UPDATE urls SET full_url = ?, title = ?, updated_at = ?, clicks = 0, last_clicked_at = NULL WHERE short_hash = ?`
+	}
+	_, err := db.exec(query, newFullURL, title, time.Now(), shortHash)
 	return err
-}
\ No newline at end of file
+}
+
+// SetUserHashPrefix limits the user to hashes starting with prefix, or lifts
+// the limit when prefix is empty. It returns sql.ErrNoRows when no user has
+// that ID.
+func (db *DB) SetUserHashPrefix(id int, prefix string) error {
+	result, err := db.exec(`UPDATE users SET hash_prefix = ? WHERE id = ?`, prefix, id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// BumpSessionVersion invalidates every existing session for the user.
+func (db *DB) BumpSessionVersion(userID int) error {
+	query := `UPDATE users SET session_version = session_version + 1 WHERE id = ?`
+	_, err := db.exec(query, userID)
+	return err
+}
+
+func (db *DB) GetSessionVersion(userID int) (int, error) {
+	query := `SELECT session_version FROM users WHERE id = ?`
+
+	var version int
+	err := db.conn.QueryRow(query, userID).Scan(&version)
+	return version, err
+}
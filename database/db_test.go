@@ -0,0 +1,1380 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestDB returns a fresh in-memory database. Each test gets its own
+// named shared-cache database so pooled connections see the same data.
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	db, err := NewDB(fmt.Sprintf("file:%s?mode=memory&cache=shared", name))
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestCreateAndGetURL(t *testing.T) {
+	db := newTestDB(t)
+
+	created, err := db.CreateURL("https://example.com", "abc123", "Example", 0)
+	if err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+	if created.ID == 0 {
+		t.Error("CreateURL returned zero ID")
+	}
+
+	got, err := db.GetURLByHash("abc123")
+	if err != nil {
+		t.Fatalf("GetURLByHash: %v", err)
+	}
+	if got.FullURL != "https://example.com" || got.Title != "Example" || got.Clicks != 0 {
+		t.Errorf("GetURLByHash = %+v", got)
+	}
+
+	if _, err := db.CreateURL("https://example.org", "abc123", "", 0); err == nil {
+		t.Error("CreateURL with duplicate hash succeeded")
+	}
+}
+
+func TestGetURLByHashNotFound(t *testing.T) {
+	db := newTestDB(t)
+
+	_, err := db.GetURLByHash("missing")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetURLByHash error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestGetURLByHashFold(t *testing.T) {
+	db := newTestDB(t)
+
+	if _, err := db.CreateURL("https://example.com", "abc", "", 0); err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+
+	for _, hash := range []string{"abc", "ABC", "aBc"} {
+		got, err := db.GetURLByHashFold(hash)
+		if err != nil {
+			t.Errorf("GetURLByHashFold(%q) error: %v", hash, err)
+			continue
+		}
+		if got.ShortHash != "abc" {
+			t.Errorf("GetURLByHashFold(%q) = %q, want abc", hash, got.ShortHash)
+		}
+
+		exists, err := db.CheckHashExistsFold(hash)
+		if err != nil || !exists {
+			t.Errorf("CheckHashExistsFold(%q) = %v, %v, want true", hash, exists, err)
+		}
+	}
+
+	if _, err := db.GetURLByHashFold("abd"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetURLByHashFold(abd) error = %v, want sql.ErrNoRows", err)
+	}
+	if exists, err := db.CheckHashExistsFold("abd"); err != nil || exists {
+		t.Errorf("CheckHashExistsFold(abd) = %v, %v, want false", exists, err)
+	}
+
+	// Plain lookups stay case-sensitive.
+	for _, hash := range []string{"ABC", "aBc"} {
+		if _, err := db.GetURLByHash(hash); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetURLByHash(%q) error = %v, want sql.ErrNoRows", hash, err)
+		}
+		if exists, err := db.CheckHashExists(hash); err != nil || exists {
+			t.Errorf("CheckHashExists(%q) = %v, %v, want false", hash, exists, err)
+		}
+	}
+}
+
+func TestGetURLByHashFoldPrefersExactMatch(t *testing.T) {
+	db := newTestDB(t)
+
+	for _, hash := range []string{"abc", "ABC"} {
+		if _, err := db.CreateURL("https://example.com/"+hash, hash, "", 0); err != nil {
+			t.Fatalf("CreateURL(%q): %v", hash, err)
+		}
+	}
+
+	for _, hash := range []string{"abc", "ABC"} {
+		got, err := db.GetURLByHashFold(hash)
+		if err != nil {
+			t.Fatalf("GetURLByHashFold(%q): %v", hash, err)
+		}
+		if got.ShortHash != hash {
+			t.Errorf("GetURLByHashFold(%q) = %q, want the exact match", hash, got.ShortHash)
+		}
+	}
+}
+
+func TestIncrementClicks(t *testing.T) {
+	db := newTestDB(t)
+
+	created, err := db.CreateURL("https://example.com", "abc123", "", 0)
+	if err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+	if created.LastClickedAt != nil {
+		t.Errorf("LastClickedAt = %v for a new link, want nil", created.LastClickedAt)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := db.IncrementClicks("abc123"); err != nil {
+			t.Fatalf("IncrementClicks: %v", err)
+		}
+	}
+
+	got, err := db.GetURLByHash("abc123")
+	if err != nil {
+		t.Fatalf("GetURLByHash: %v", err)
+	}
+	if got.Clicks != 3 {
+		t.Errorf("Clicks = %d, want 3", got.Clicks)
+	}
+	if got.LastClickedAt == nil {
+		t.Error("LastClickedAt = nil after clicks, want a timestamp")
+	}
+
+	// Unknown hashes are a no-op rather than an error
+	if err := db.IncrementClicks("missing"); err != nil {
+		t.Errorf("IncrementClicks(missing): %v", err)
+	}
+}
+
+func TestClickURL(t *testing.T) {
+	for _, returning := range []bool{true, false} {
+		t.Run(fmt.Sprintf("returning=%v", returning), func(t *testing.T) {
+			db := newTestDB(t)
+			db.returning = db.returning && returning
+
+			if _, err := db.CreateURL("https://example.com", "abc123", "", 0); err != nil {
+				t.Fatalf("CreateURL: %v", err)
+			}
+
+			const clicks = 50
+			var wg sync.WaitGroup
+			errs := make(chan error, clicks)
+			for i := 0; i < clicks; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					fullURL, err := db.ClickURL("abc123")
+					if err == nil && fullURL != "https://example.com" {
+						err = fmt.Errorf("ClickURL = %q, want https://example.com", fullURL)
+					}
+					errs <- err
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := db.GetURLByHash("abc123")
+			if err != nil {
+				t.Fatalf("GetURLByHash: %v", err)
+			}
+			if got.Clicks != clicks {
+				t.Errorf("Clicks = %d, want %d", got.Clicks, clicks)
+			}
+			if got.LastClickedAt == nil {
+				t.Error("LastClickedAt = nil after clicks, want a timestamp")
+			}
+
+			if _, err := db.ClickURL("missing"); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("ClickURL(missing) error = %v, want sql.ErrNoRows", err)
+			}
+		})
+	}
+}
+
+// BenchmarkLookupThenIncrement is the redirect path before ClickURL: a
+// lookup followed by a separate increment.
+func BenchmarkLookupThenIncrement(b *testing.B) {
+	db := newBenchDB(b)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := db.GetURLByHash("abc123"); err != nil {
+				b.Fatal(err)
+			}
+			if err := db.IncrementClicks("abc123"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkClickURL(b *testing.B) {
+	db := newBenchDB(b)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := db.ClickURL("abc123"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func newBenchDB(b *testing.B) *DB {
+	b.Helper()
+
+	db, err := NewDB(filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatalf("NewDB: %v", err)
+	}
+	b.Cleanup(func() { db.Close() })
+
+	if _, err := db.CreateURL("https://example.com", "abc123", "", 0); err != nil {
+		b.Fatalf("CreateURL: %v", err)
+	}
+	return db
+}
+
+func TestCheckHashExists(t *testing.T) {
+	db := newTestDB(t)
+
+	if _, err := db.CreateURL("https://example.com", "abc123", "", 0); err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+
+	tests := []struct {
+		hash string
+		want bool
+	}{
+		{"abc123", true},
+		{"ABC123", false},
+		{"missing", false},
+	}
+
+	for _, tt := range tests {
+		got, err := db.CheckHashExists(tt.hash)
+		if err != nil {
+			t.Fatalf("CheckHashExists(%q): %v", tt.hash, err)
+		}
+		if got != tt.want {
+			t.Errorf("CheckHashExists(%q) = %v, want %v", tt.hash, got, tt.want)
+		}
+	}
+}
+
+func TestUsers(t *testing.T) {
+	db := newTestDB(t)
+
+	created, err := db.CreateUser("alice", "hash1")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	if _, err := db.CreateUser("alice", "hash2"); err == nil {
+		t.Error("CreateUser with duplicate username succeeded")
+	}
+
+	byName, err := db.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	if byName.ID != created.ID || byName.PasswordHash != "hash1" {
+		t.Errorf("GetUserByUsername = %+v", byName)
+	}
+
+	if err := db.UpdateUserPassword(created.ID, "hash3"); err != nil {
+		t.Fatalf("UpdateUserPassword: %v", err)
+	}
+	byID, err := db.GetUserByID(created.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if byID.PasswordHash != "hash3" {
+		t.Errorf("PasswordHash = %q, want hash3", byID.PasswordHash)
+	}
+
+	users, err := db.GetAllUsers()
+	if err != nil {
+		t.Fatalf("GetAllUsers: %v", err)
+	}
+	if len(users) != 1 {
+		t.Errorf("GetAllUsers returned %d users, want 1", len(users))
+	}
+
+	if err := db.DeleteUser(created.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err := db.GetUserByID(created.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUserByID after delete error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestGetUserByUsernameNotFound(t *testing.T) {
+	db := newTestDB(t)
+
+	user, err := db.GetUserByUsername("nobody")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUserByUsername error = %v, want sql.ErrNoRows", err)
+	}
+	if user != nil {
+		t.Errorf("GetUserByUsername user = %+v, want nil", user)
+	}
+}
+
+func TestGetUserByUsernameLookupError(t *testing.T) {
+	db := newTestDB(t)
+	db.Close()
+
+	// A failed lookup must not look like "not found", or callers could
+	// create duplicate users.
+	_, err := db.GetUserByUsername("alice")
+	if err == nil || errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUserByUsername on closed DB error = %v, want non-ErrNoRows error", err)
+	}
+}
+
+func TestSetUserHashPrefix(t *testing.T) {
+	db := newTestDB(t)
+
+	user, err := db.CreateUser("acme", "hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if user.HashPrefix != "" {
+		t.Errorf("new user HashPrefix = %q, want empty", user.HashPrefix)
+	}
+
+	if err := db.SetUserHashPrefix(user.ID, "acme"); err != nil {
+		t.Fatalf("SetUserHashPrefix: %v", err)
+	}
+	byName, err := db.GetUserByUsername("acme")
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	if byName.HashPrefix != "acme" {
+		t.Errorf("HashPrefix = %q, want acme", byName.HashPrefix)
+	}
+
+	if err := db.SetUserHashPrefix(user.ID, ""); err != nil {
+		t.Fatalf("SetUserHashPrefix(\"\"): %v", err)
+	}
+	byID, err := db.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if byID.HashPrefix != "" {
+		t.Errorf("HashPrefix = %q, want empty after clearing", byID.HashPrefix)
+	}
+
+	if err := db.SetUserHashPrefix(user.ID+1, "other"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("SetUserHashPrefix for unknown user error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestCountURLsByUser(t *testing.T) {
+	db := newTestDB(t)
+
+	user, err := db.CreateUser("alice", "hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	for _, hash := range []string{"a1", "a2"} {
+		if _, err := db.CreateURL("https://example.com", hash, "", user.ID); err != nil {
+			t.Fatalf("CreateURL: %v", err)
+		}
+	}
+	if _, err := db.CreateURL("https://example.com", "legacy", "", 0); err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+
+	count, err := db.CountURLsByUser(user.ID)
+	if err != nil {
+		t.Fatalf("CountURLsByUser: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("CountURLsByUser = %d, want 2", count)
+	}
+}
+
+func TestGetAllURLsWithCreator(t *testing.T) {
+	db := newTestDB(t)
+
+	user, err := db.CreateUser("alice", "hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err := db.CreateURL("https://example.com", "owned1", "", user.ID); err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+	if _, err := db.CreateURL("https://example.org", "legacy", "", 0); err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+
+	urls, err := db.GetAllURLsWithCreator()
+	if err != nil {
+		t.Fatalf("GetAllURLsWithCreator: %v", err)
+	}
+
+	creators := map[string]string{}
+	for _, u := range urls {
+		creators[u.ShortHash] = u.CreatorUsername
+	}
+	if creators["owned1"] != "alice" {
+		t.Errorf("creator of owned1 = %q, want alice", creators["owned1"])
+	}
+	if creators["legacy"] != "" {
+		t.Errorf("creator of legacy = %q, want empty", creators["legacy"])
+	}
+}
+
+func TestImportURLs(t *testing.T) {
+	db := newTestDB(t)
+
+	if _, err := db.CreateURL("https://example.com", "taken", "", 0); err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+
+	generate := func(exists func(string) (bool, error)) (string, error) {
+		return "fresh", nil
+	}
+	results, err := db.ImportURLs([]URL{
+		{FullURL: "https://example.org", ShortHash: "keep"},
+		{FullURL: "https://example.net", ShortHash: "TAKEN"},
+	}, 0, generate)
+	if err != nil {
+		t.Fatalf("ImportURLs: %v", err)
+	}
+
+	if results[0].Remapped() || results[0].ShortHash != "keep" {
+		t.Errorf("results[0] = %+v, want hash kept", results[0])
+	}
+	if !results[1].Remapped() || results[1].ShortHash != "fresh" {
+		t.Errorf("results[1] = %+v, want remapped to fresh", results[1])
+	}
+
+	got, err := db.GetURLByHash("fresh")
+	if err != nil || got.FullURL != "https://example.net" {
+		t.Errorf("GetURLByHash(fresh) = %+v, %v", got, err)
+	}
+}
+
+func TestImportURLsSkipConflicts(t *testing.T) {
+	db := newTestDB(t)
+
+	existing, err := db.CreateURL("https://example.com", "taken", "", 0)
+	if err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+
+	clicked := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	results, err := db.ImportURLs([]URL{
+		{ID: 1, FullURL: "https://example.org", ShortHash: "TAKEN"},
+		{ID: 2, FullURL: "https://example.org", ShortHash: "alias1", AliasOf: 1},
+		{ID: 3, FullURL: "https://example.net", ShortHash: "new1", QRViews: 4, LastClickedAt: &clicked},
+		{ID: 4, FullURL: "https://example.net", ShortHash: "alias2", AliasOf: 3},
+		{ID: 5, FullURL: "https://example.net", ShortHash: "orphan", AliasOf: 99},
+	}, 0, nil)
+	if err != nil {
+		t.Fatalf("ImportURLs: %v", err)
+	}
+
+	if !results[0].Skipped || results[0].Remapped() {
+		t.Errorf("results[0] = %+v, want skipped", results[0])
+	}
+	if got, _ := db.GetURLByHash("taken"); got.FullURL != "https://example.com" {
+		t.Errorf("existing link changed to %q", got.FullURL)
+	}
+
+	// Aliases point at the existing link they were skipped for, or at the
+	// imported link's new ID.
+	newLink, err := db.GetURLByHash("new1")
+	if err != nil {
+		t.Fatalf("GetURLByHash(new1): %v", err)
+	}
+	if newLink.QRViews != 4 || newLink.LastClickedAt == nil || !newLink.LastClickedAt.Equal(clicked) {
+		t.Errorf("new1 = %+v, want counts kept", newLink)
+	}
+	for hash, want := range map[string]int{"alias1": existing.ID, "alias2": newLink.ID, "orphan": 0} {
+		got, err := db.GetURLByHash(hash)
+		if err != nil {
+			t.Fatalf("GetURLByHash(%s): %v", hash, err)
+		}
+		if got.AliasOf != want {
+			t.Errorf("%s AliasOf = %d, want %d", hash, got.AliasOf, want)
+		}
+	}
+}
+
+func TestEditToken(t *testing.T) {
+	db := newTestDB(t)
+
+	if _, err := db.CreateURL("https://example.com", "abc123", "", 0); err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+	if got, err := db.GetEditTokenHash("abc123"); err != nil || got != "" {
+		t.Errorf("GetEditTokenHash of a new link = %q, %v, want none", got, err)
+	}
+
+	if err := db.SetEditToken("abc123", "hash1"); err != nil {
+		t.Fatalf("SetEditToken: %v", err)
+	}
+	if got, _ := db.GetEditTokenHash("abc123"); got != "hash1" {
+		t.Errorf("GetEditTokenHash = %q, want hash1", got)
+	}
+
+	if err := db.SetEditToken("abc123", ""); err != nil {
+		t.Fatalf("SetEditToken to revoke: %v", err)
+	}
+	if got, _ := db.GetEditTokenHash("abc123"); got != "" {
+		t.Errorf("GetEditTokenHash after revoking = %q, want none", got)
+	}
+
+	if err := db.SetEditToken("missing", "hash1"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("SetEditToken(missing) error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestUpdateURLResetClicks(t *testing.T) {
+	db := newTestDB(t)
+
+	if _, err := db.CreateURL("https://example.com", "abc123", "", 0); err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+	if err := db.IncrementClicks("abc123"); err != nil {
+		t.Fatalf("IncrementClicks: %v", err)
+	}
+	if got, _ := db.GetURLByHash("abc123"); got.UpdatedAt != nil {
+		t.Errorf("UpdatedAt = %v before any edit, want nil", got.UpdatedAt)
+	}
+
+	if err := db.UpdateURL("abc123", "https://example.org", "Org", false); err != nil {
+		t.Fatalf("UpdateURL: %v", err)
+	}
+	got, _ := db.GetURLByHash("abc123")
+	if got.Clicks != 1 || got.FullURL != "https://example.org" {
+		t.Errorf("after update = %+v, want clicks kept", got)
+	}
+	if got.UpdatedAt == nil || got.UpdatedAt.Before(got.CreatedAt) {
+		t.Errorf("UpdatedAt = %v after edit, want set after CreatedAt %v", got.UpdatedAt, got.CreatedAt)
+	}
+
+	if err := db.UpdateURL("abc123", "https://example.net", "Net", true); err != nil {
+		t.Fatalf("UpdateURL: %v", err)
+	}
+	got, _ = db.GetURLByHash("abc123")
+	if got.Clicks != 0 || got.LastClickedAt != nil {
+		t.Errorf("after reset = %+v, want clicks cleared", got)
+	}
+}
+
+func TestGetClickEvents(t *testing.T) {
+	db := newTestDB(t)
+
+	url, err := db.CreateURL("https://example.com", "abc123", "", 0)
+	if err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+	for _, ref := range []string{"first", "second", "third"} {
+		if err := db.RecordClickEvent(url.ID, ref, "test-agent", 1); err != nil {
+			t.Fatalf("RecordClickEvent: %v", err)
+		}
+	}
+
+	page, err := db.GetClickEvents("abc123", 2, 0, nil)
+	if err != nil {
+		t.Fatalf("GetClickEvents: %v", err)
+	}
+	if len(page) != 2 || page[0].Referrer != "third" {
+		t.Errorf("first page = %+v, want newest two", page)
+	}
+
+	page, err = db.GetClickEvents("abc123", 2, 2, nil)
+	if err != nil {
+		t.Fatalf("GetClickEvents: %v", err)
+	}
+	if len(page) != 1 || page[0].Referrer != "first" {
+		t.Errorf("second page = %+v, want oldest", page)
+	}
+
+	future := time.Now().Add(time.Hour)
+	page, err = db.GetClickEvents("abc123", 0, 0, &future)
+	if err != nil {
+		t.Fatalf("GetClickEvents: %v", err)
+	}
+	if len(page) != 0 {
+		t.Errorf("events since the future = %d, want 0", len(page))
+	}
+}
+
+func TestCountUsers(t *testing.T) {
+	db := newTestDB(t)
+
+	for i, name := range []string{"", "alice", "bob"} {
+		if name != "" {
+			if _, err := db.CreateUser(name, "hash"); err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+		}
+		count, err := db.CountUsers()
+		if err != nil {
+			t.Fatalf("CountUsers: %v", err)
+		}
+		if count != i {
+			t.Errorf("CountUsers = %d, want %d", count, i)
+		}
+	}
+}
+
+func TestBulkUpdateURLs(t *testing.T) {
+	db := newTestDB(t)
+
+	if _, err := db.CreateURL("https://old.example.com/a", "abc123", "Custom", 0); err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+	if _, err := db.CreateAlias("abc123", "alias1", 0); err != nil {
+		t.Fatalf("CreateAlias: %v", err)
+	}
+
+	updated, err := db.BulkUpdateURLs([]URLUpdate{
+		{ShortHash: "abc123", FullURL: "https://new.example.com/a"},
+		{ShortHash: "missing", FullURL: "https://new.example.com/b"},
+		{ShortHash: "alias1", FullURL: "https://new.example.com/c"},
+	})
+	if err != nil {
+		t.Fatalf("BulkUpdateURLs: %v", err)
+	}
+	if len(updated) != 3 || !updated[0] || updated[1] || updated[2] {
+		t.Errorf("updated = %v, want [true false false]", updated)
+	}
+
+	got, err := db.GetURLByHash("abc123")
+	if err != nil {
+		t.Fatalf("GetURLByHash: %v", err)
+	}
+	if got.FullURL != "https://new.example.com/a" || got.Title != "Custom" {
+		t.Errorf("after bulk update = %+v, want new destination and title kept", got)
+	}
+}
+
+func TestBulkUpdateTitles(t *testing.T) {
+	db := newTestDB(t)
+
+	if _, err := db.CreateURL("https://example.com/a", "abc123", "Old", 0); err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+
+	updated, err := db.BulkUpdateTitles([]TitleUpdate{
+		{ShortHash: "abc123", Title: "New"},
+		{ShortHash: "missing", Title: "Other"},
+	})
+	if err != nil {
+		t.Fatalf("BulkUpdateTitles: %v", err)
+	}
+	if len(updated) != 2 || !updated[0] || updated[1] {
+		t.Errorf("updated = %v, want [true false]", updated)
+	}
+
+	if got, err := db.GetURLByHash("abc123"); err != nil || got.Title != "New" || got.FullURL != "https://example.com/a" {
+		t.Errorf("after bulk title update = %+v, %v", got, err)
+	}
+}
+
+func TestReplaceInDestinations(t *testing.T) {
+	db := newTestDB(t)
+
+	for _, link := range []struct{ hash, dest string }{
+		{"one", "https://old.example.com/a"},
+		{"two", "https://old.example.com/b"},
+		{"other", "https://unrelated.example.org"},
+	} {
+		if _, err := db.CreateURL(link.dest, link.hash, "", 0); err != nil {
+			t.Fatalf("CreateURL: %v", err)
+		}
+	}
+
+	preview, err := db.ReplaceInDestinations("old.example.com", "new.example.com", true)
+	if err != nil {
+		t.Fatalf("ReplaceInDestinations dry run: %v", err)
+	}
+	if len(preview) != 2 || preview[0].FullURL != "https://new.example.com/a" {
+		t.Errorf("preview = %+v, want two rewritten links", preview)
+	}
+	if got, _ := db.GetURLByHash("one"); got.FullURL != "https://old.example.com/a" {
+		t.Errorf("dry run changed destination to %q", got.FullURL)
+	}
+
+	if _, err := db.ReplaceInDestinations("old.example.com", "new.example.com", false); err != nil {
+		t.Fatalf("ReplaceInDestinations: %v", err)
+	}
+	if got, _ := db.GetURLByHash("two"); got.FullURL != "https://new.example.com/b" {
+		t.Errorf("destination = %q, want replaced", got.FullURL)
+	}
+	if got, _ := db.GetURLByHash("other"); got.FullURL != "https://unrelated.example.org" {
+		t.Errorf("unrelated destination = %q, want unchanged", got.FullURL)
+	}
+
+	if _, err := db.ReplaceInDestinations("", "x", true); err == nil {
+		t.Error("ReplaceInDestinations with empty find succeeded, want error")
+	}
+}
+
+func TestGetDashboardStats(t *testing.T) {
+	db := newTestDB(t)
+
+	stats, err := db.GetDashboardStats(0)
+	if err != nil {
+		t.Fatalf("GetDashboardStats on empty db: %v", err)
+	}
+	if stats.TotalLinks != 0 || stats.TopLink != nil {
+		t.Errorf("empty stats = %+v", stats)
+	}
+
+	user, err := db.CreateUser("alice", "hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	for _, hash := range []string{"mine1", "mine2"} {
+		if _, err := db.CreateURL("https://example.com", hash, "", user.ID); err != nil {
+			t.Fatalf("CreateURL: %v", err)
+		}
+	}
+	if _, err := db.CreateURL("https://example.org", "legacy", "", 0); err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+	for _, hash := range []string{"mine2", "mine2", "legacy", "legacy", "legacy"} {
+		if err := db.IncrementClicks(hash); err != nil {
+			t.Fatalf("IncrementClicks: %v", err)
+		}
+	}
+
+	all, err := db.GetDashboardStats(0)
+	if err != nil {
+		t.Fatalf("GetDashboardStats: %v", err)
+	}
+	if all.TotalLinks != 3 || all.TotalClicks != 5 || all.LinksToday != 3 || all.TopLink.ShortHash != "legacy" {
+		t.Errorf("all stats = %+v", all)
+	}
+
+	mine, err := db.GetDashboardStats(user.ID)
+	if err != nil {
+		t.Fatalf("GetDashboardStats: %v", err)
+	}
+	if mine.TotalLinks != 2 || mine.TotalClicks != 2 || mine.TopLink.ShortHash != "mine2" {
+		t.Errorf("user stats = %+v", mine)
+	}
+}
+
+func TestGetRecentClicks(t *testing.T) {
+	db := newTestDB(t)
+
+	var ids []int
+	for _, hash := range []string{"first", "second"} {
+		url, err := db.CreateURL("https://example.com", hash, "", 0)
+		if err != nil {
+			t.Fatalf("CreateURL: %v", err)
+		}
+		ids = append(ids, url.ID)
+	}
+	for _, id := range []int{ids[0], ids[1], ids[0]} {
+		if err := db.RecordClickEvent(id, "", "agent", 1); err != nil {
+			t.Fatalf("RecordClickEvent: %v", err)
+		}
+	}
+
+	clicks, err := db.GetRecentClicks(2)
+	if err != nil {
+		t.Fatalf("GetRecentClicks: %v", err)
+	}
+	if len(clicks) != 2 || clicks[0].ShortHash != "first" || clicks[1].ShortHash != "second" {
+		t.Errorf("GetRecentClicks(2) = %+v, want first then second", clicks)
+	}
+
+	size, err := db.StorageSize()
+	if err != nil || size <= 0 {
+		t.Errorf("StorageSize() = %d, %v, want a positive size", size, err)
+	}
+}
+
+func TestCampaigns(t *testing.T) {
+	db := newTestDB(t)
+
+	campaign, err := db.CreateCampaign("Spring Sale")
+	if err != nil {
+		t.Fatalf("CreateCampaign: %v", err)
+	}
+	if _, err := db.CreateCampaign("Spring Sale"); !errors.Is(err, ErrCampaignExists) {
+		t.Errorf("duplicate CreateCampaign error = %v, want ErrCampaignExists", err)
+	}
+
+	for _, hash := range []string{"a1", "a2", "other"} {
+		if _, err := db.CreateURL("https://example.com", hash, "", 0); err != nil {
+			t.Fatalf("CreateURL: %v", err)
+		}
+	}
+	for _, hash := range []string{"a1", "a2"} {
+		if err := db.AssignURLToCampaign(hash, campaign.ID); err != nil {
+			t.Fatalf("AssignURLToCampaign: %v", err)
+		}
+	}
+	if err := db.AssignURLToCampaign("missing", campaign.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("AssignURLToCampaign(missing) = %v, want sql.ErrNoRows", err)
+	}
+	if err := db.IncrementClicks("a1"); err != nil {
+		t.Fatalf("IncrementClicks: %v", err)
+	}
+
+	urls, err := db.GetURLsByCampaign(campaign.ID)
+	if err != nil {
+		t.Fatalf("GetURLsByCampaign: %v", err)
+	}
+	if len(urls) != 2 || urls[0].CampaignID != campaign.ID {
+		t.Errorf("campaign links = %+v, want a1 and a2", urls)
+	}
+
+	got, err := db.GetCampaign(campaign.ID)
+	if err != nil {
+		t.Fatalf("GetCampaign: %v", err)
+	}
+	if got.Links != 2 || got.Clicks != 1 {
+		t.Errorf("campaign totals = %d links, %d clicks, want 2 and 1", got.Links, got.Clicks)
+	}
+}
+
+func TestGetDailyClicks(t *testing.T) {
+	db := newTestDB(t)
+
+	url, err := db.CreateURL("https://example.com", "abc123", "", 0)
+	if err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+	// A sampled event counts for the clicks it stands for.
+	for _, rate := range []int{1, 10} {
+		if err := db.RecordClickEvent(url.ID, "", "", rate); err != nil {
+			t.Fatalf("RecordClickEvent: %v", err)
+		}
+	}
+
+	today := time.Now().UTC()
+	series, err := db.GetDailyClicks("abc123", today.AddDate(0, 0, -2), today, time.UTC)
+	if err != nil {
+		t.Fatalf("GetDailyClicks: %v", err)
+	}
+
+	if len(series) != 3 {
+		t.Fatalf("got %d days, want 3", len(series))
+	}
+	if series[0].Clicks != 0 || series[1].Clicks != 0 || series[2].Clicks != 11 {
+		t.Errorf("series = %+v, want two zero days then 11 clicks", series)
+	}
+	if series[2].Date != today.Format(time.DateOnly) {
+		t.Errorf("last day = %s, want today", series[2].Date)
+	}
+
+	// 23:30 UTC is the next day in Tokyo.
+	late := time.Date(2025, 3, 1, 23, 30, 0, 0, time.UTC)
+	if _, err := db.exec(`INSERT INTO click_events (url_id, clicked_at, referrer, user_agent) VALUES (?, ?, '', '')`, url.ID, late); err != nil {
+		t.Fatalf("inserting click event: %v", err)
+	}
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	for _, tt := range []struct {
+		loc  *time.Location
+		want []DailyClicks
+	}{
+		{time.UTC, []DailyClicks{{"2025-03-01", 1}, {"2025-03-02", 0}}},
+		{tokyo, []DailyClicks{{"2025-03-01", 0}, {"2025-03-02", 1}}},
+	} {
+		from := time.Date(2025, 3, 1, 12, 0, 0, 0, tt.loc)
+		series, err := db.GetDailyClicks("abc123", from, from.AddDate(0, 0, 1), tt.loc)
+		if err != nil {
+			t.Fatalf("GetDailyClicks(%s): %v", tt.loc, err)
+		}
+		if !reflect.DeepEqual(series, tt.want) {
+			t.Errorf("GetDailyClicks(%s) = %+v, want %+v", tt.loc, series, tt.want)
+		}
+	}
+}
+
+func TestSetURLDomain(t *testing.T) {
+	db := newTestDB(t)
+
+	if _, err := db.CreateURL("https://example.com", "abc123", "", 0); err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+	if err := db.SetURLDomain("abc123", "go.example.com"); err != nil {
+		t.Fatalf("SetURLDomain: %v", err)
+	}
+
+	url, err := db.GetURLByHash("abc123")
+	if err != nil {
+		t.Fatalf("GetURLByHash: %v", err)
+	}
+	if url.Domain != "go.example.com" {
+		t.Errorf("Domain = %q, want go.example.com", url.Domain)
+	}
+
+	if err := db.SetURLDomain("missing", "go.example.com"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("SetURLDomain(missing) = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestSetURLPublicStats(t *testing.T) {
+	db := newTestDB(t)
+
+	if _, err := db.CreateURL("https://example.com", "abc123", "", 0); err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+
+	private := false
+	if err := db.SetURLPublicStats("abc123", &private); err != nil {
+		t.Fatalf("SetURLPublicStats: %v", err)
+	}
+	url, err := db.GetURLByHash("abc123")
+	if err != nil {
+		t.Fatalf("GetURLByHash: %v", err)
+	}
+	if url.PublicStats == nil || *url.PublicStats {
+		t.Errorf("PublicStats = %v, want false", url.PublicStats)
+	}
+
+	if err := db.SetURLPublicStats("abc123", nil); err != nil {
+		t.Fatalf("SetURLPublicStats(nil): %v", err)
+	}
+	url, err = db.GetURLByHash("abc123")
+	if err != nil {
+		t.Fatalf("GetURLByHash: %v", err)
+	}
+	if url.PublicStats != nil {
+		t.Errorf("PublicStats = %v, want nil after clearing", *url.PublicStats)
+	}
+}
+
+func TestSetURLForwardQuery(t *testing.T) {
+	db := newTestDB(t)
+
+	if _, err := db.CreateURL("https://example.com", "abc123", "", 0); err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+
+	forward := true
+	if err := db.SetURLForwardQuery("abc123", &forward); err != nil {
+		t.Fatalf("SetURLForwardQuery: %v", err)
+	}
+	url, err := db.GetURLByHash("abc123")
+	if err != nil {
+		t.Fatalf("GetURLByHash: %v", err)
+	}
+	if url.ForwardQuery == nil || !*url.ForwardQuery {
+		t.Errorf("ForwardQuery = %v, want true", url.ForwardQuery)
+	}
+
+	if err := db.SetURLForwardQuery("abc123", nil); err != nil {
+		t.Fatalf("SetURLForwardQuery(nil): %v", err)
+	}
+	url, err = db.GetURLByHash("abc123")
+	if err != nil {
+		t.Fatalf("GetURLByHash: %v", err)
+	}
+	if url.ForwardQuery != nil {
+		t.Errorf("ForwardQuery = %v, want nil after clearing", *url.ForwardQuery)
+	}
+}
+
+func TestSetURLQRPreview(t *testing.T) {
+	db := newTestDB(t)
+
+	if _, err := db.CreateURL("https://example.com", "abc123", "", 0); err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+
+	preview := true
+	if err := db.SetURLQRPreview("abc123", &preview); err != nil {
+		t.Fatalf("SetURLQRPreview: %v", err)
+	}
+	url, err := db.GetURLByHash("abc123")
+	if err != nil {
+		t.Fatalf("GetURLByHash: %v", err)
+	}
+	if url.QRPreview == nil || !*url.QRPreview {
+		t.Errorf("QRPreview = %v, want true", url.QRPreview)
+	}
+
+	if err := db.SetURLQRPreview("abc123", nil); err != nil {
+		t.Fatalf("SetURLQRPreview(nil): %v", err)
+	}
+	url, err = db.GetURLByHash("abc123")
+	if err != nil {
+		t.Fatalf("GetURLByHash: %v", err)
+	}
+	if url.QRPreview != nil {
+		t.Errorf("QRPreview = %v, want nil after clearing", *url.QRPreview)
+	}
+}
+
+func TestPruneClickEvents(t *testing.T) {
+	db := newTestDB(t)
+
+	url, err := db.CreateURL("https://example.com", "abc123", "", 0)
+	if err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := db.RecordClickEvent(url.ID, "", "", 1); err != nil {
+			t.Fatalf("RecordClickEvent: %v", err)
+		}
+		if err := db.IncrementClicks("abc123"); err != nil {
+			t.Fatalf("IncrementClicks: %v", err)
+		}
+	}
+
+	n, err := db.PruneClickEvents(time.Now().Add(-time.Hour))
+	if err != nil || n != 0 {
+		t.Fatalf("PruneClickEvents(an hour ago) = %d, %v, want 0", n, err)
+	}
+
+	n, err = db.PruneClickEvents(time.Now().Add(time.Second))
+	if err != nil || n != 3 {
+		t.Fatalf("PruneClickEvents(now) = %d, %v, want 3", n, err)
+	}
+
+	events, err := db.GetClickEvents("abc123", 0, 0, nil)
+	if err != nil || len(events) != 0 {
+		t.Errorf("GetClickEvents after pruning = %d events, %v, want none", len(events), err)
+	}
+	url, err = db.GetURLByHash("abc123")
+	if err != nil || url.Clicks != 3 {
+		t.Errorf("Clicks after pruning = %d, %v, want 3", url.Clicks, err)
+	}
+}
+
+func TestGetTotals(t *testing.T) {
+	db := newTestDB(t)
+
+	for _, hash := range []string{"aaa111", "bbb222"} {
+		if _, err := db.CreateURL("https://example.com", hash, "", 0); err != nil {
+			t.Fatalf("CreateURL: %v", err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if err := db.IncrementClicks("aaa111"); err != nil {
+			t.Fatalf("IncrementClicks: %v", err)
+		}
+	}
+
+	links, clicks, err := db.GetTotals()
+	if err != nil || links != 2 || clicks != 3 {
+		t.Errorf("GetTotals() = %d, %d, %v, want 2, 3", links, clicks, err)
+	}
+}
+
+func TestTOTPRecoveryCodes(t *testing.T) {
+	db := newTestDB(t)
+
+	user, err := db.CreateUser("alice", "hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if err := db.EnableTOTP(user.ID, "SECRET", []string{"h1", "h2"}); err != nil {
+		t.Fatalf("EnableTOTP: %v", err)
+	}
+
+	got, err := db.GetUserByID(user.ID)
+	if err != nil || got.TOTPSecret != "SECRET" {
+		t.Fatalf("TOTPSecret = %q, %v, want SECRET", got.TOTPSecret, err)
+	}
+
+	if ok, err := db.UseRecoveryCode(user.ID, "h1"); !ok || err != nil {
+		t.Errorf("UseRecoveryCode(h1) = %v, %v, want true", ok, err)
+	}
+	if ok, err := db.UseRecoveryCode(user.ID, "h1"); ok || err != nil {
+		t.Errorf("reusing h1 = %v, %v, want false", ok, err)
+	}
+	if n, err := db.CountRecoveryCodes(user.ID); n != 1 || err != nil {
+		t.Errorf("CountRecoveryCodes = %d, %v, want 1", n, err)
+	}
+
+	if ok, err := db.UseTOTPStep(user.ID, 100); !ok || err != nil {
+		t.Errorf("UseTOTPStep(100) = %v, %v, want true", ok, err)
+	}
+	for _, step := range []int64{100, 99} {
+		if ok, err := db.UseTOTPStep(user.ID, step); ok || err != nil {
+			t.Errorf("UseTOTPStep(%d) after 100 = %v, %v, want false", step, ok, err)
+		}
+	}
+	if ok, err := db.UseTOTPStep(user.ID, 101); !ok || err != nil {
+		t.Errorf("UseTOTPStep(101) = %v, %v, want true", ok, err)
+	}
+
+	if err := db.DisableTOTP(user.ID); err != nil {
+		t.Fatalf("DisableTOTP: %v", err)
+	}
+	got, err = db.GetUserByID(user.ID)
+	if err != nil || got.TOTPSecret != "" {
+		t.Errorf("TOTPSecret after disabling = %q, %v", got.TOTPSecret, err)
+	}
+	if n, _ := db.CountRecoveryCodes(user.ID); n != 0 {
+		t.Errorf("%d recovery codes left after disabling", n)
+	}
+}
+
+func TestMergeDuplicates(t *testing.T) {
+	db := newTestDB(t)
+
+	keep, _ := db.CreateURL("https://example.com", "keep01", "", 0)
+	db.CreateURL("https://example.com", "dupe01", "", 0)
+	gone, _ := db.CreateURL("https://example.com", "gone01", "", 0)
+	db.CreateURL("https://other.example.com", "other1", "", 0)
+
+	for _, hash := range []string{"dupe01", "gone01", "gone01"} {
+		if err := db.IncrementClicks(hash); err != nil {
+			t.Fatalf("IncrementClicks: %v", err)
+		}
+	}
+	if err := db.RecordClickEvent(gone.ID, "", "", 1); err != nil {
+		t.Fatalf("RecordClickEvent: %v", err)
+	}
+
+	duplicates, err := db.FindDuplicateDestinations()
+	if err != nil {
+		t.Fatalf("FindDuplicateDestinations: %v", err)
+	}
+	if len(duplicates) != 1 || len(duplicates[0].URLs) != 3 || duplicates[0].URLs[0].ID != keep.ID {
+		t.Fatalf("FindDuplicateDestinations = %+v, want one group of 3 starting with keep01", duplicates)
+	}
+
+	if _, err := db.MergeDuplicates("keep01", []string{"other1"}, false); err == nil {
+		t.Error("merging a link with a different destination succeeded")
+	}
+
+	merged, err := db.MergeDuplicates("keep01", []string{"dupe01"}, false)
+	if err != nil {
+		t.Fatalf("MergeDuplicates: %v", err)
+	}
+	if merged.Clicks != 1 || merged.LastClickedAt == nil {
+		t.Errorf("kept link has %d clicks (last %v), want 1", merged.Clicks, merged.LastClickedAt)
+	}
+	if url, err := db.GetURLByHash("dupe01"); err != nil || url.Clicks != 0 || url.AliasOf != keep.ID {
+		t.Errorf("aliased link = %+v, %v; want an alias of keep01 with 0 clicks", url, err)
+	}
+	if duplicates, _ := db.FindDuplicateDestinations(); len(duplicates) != 1 || len(duplicates[0].URLs) != 2 {
+		t.Errorf("after merging, FindDuplicateDestinations = %+v, want keep01 and gone01 only", duplicates)
+	}
+
+	merged, err = db.MergeDuplicates("keep01", []string{"gone01"}, true)
+	if err != nil {
+		t.Fatalf("MergeDuplicates: %v", err)
+	}
+	if merged.Clicks != 3 {
+		t.Errorf("kept link has %d clicks, want 3", merged.Clicks)
+	}
+	if _, err := db.GetURLByHash("gone01"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("deleted link lookup error = %v, want sql.ErrNoRows", err)
+	}
+	if events, err := db.GetClickEvents("keep01", 10, 0, nil); err != nil || len(events) != 1 {
+		t.Errorf("kept link has %d click events (%v), want 1", len(events), err)
+	}
+}
+
+func TestAliases(t *testing.T) {
+	db := newTestDB(t)
+
+	canonical, _ := db.CreateURL("https://example.com", "canon1", "Example", 0)
+	db.CreateURL("https://example.com/other", "other1", "", 0)
+
+	alias, err := db.CreateAlias("canon1", "alias1", 0)
+	if err != nil {
+		t.Fatalf("CreateAlias: %v", err)
+	}
+	if alias.AliasOf != canonical.ID || alias.FullURL != canonical.FullURL || alias.Title != "Example" {
+		t.Errorf("CreateAlias = %+v, want an alias of canon1 with its destination and title", alias)
+	}
+
+	// Aliasing an alias points at the canonical link instead.
+	chained, err := db.CreateAlias("alias1", "alias2", 0)
+	if err != nil || chained.AliasOf != canonical.ID {
+		t.Errorf("CreateAlias of an alias = %+v, %v; want an alias of canon1", chained, err)
+	}
+
+	if _, err := db.CreateAlias("missing", "alias3", 0); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("CreateAlias of a missing link error = %v, want sql.ErrNoRows", err)
+	}
+
+	aliases, err := db.GetAliases(canonical.ID)
+	if err != nil || len(aliases) != 2 || aliases[0].ShortHash != "alias1" {
+		t.Fatalf("GetAliases = %+v, %v; want alias1 and alias2", aliases, err)
+	}
+
+	db.RecordClickEvent(canonical.ID, "", "", 1)
+	db.RecordClickEvent(alias.ID, "", "", 1)
+	if events, _ := db.GetClickEvents("canon1", 0, 0, nil); len(events) != 2 {
+		t.Errorf("canonical link has %d click events, want 2 including its alias's", len(events))
+	}
+	if events, _ := db.GetClickEvents("alias1", 0, 0, nil); len(events) != 1 {
+		t.Errorf("alias has %d click events, want only its own", len(events))
+	}
+
+	if _, err := db.DeleteURLs([]string{"canon1"}); err != nil {
+		t.Fatalf("DeleteURLs: %v", err)
+	}
+	for _, hash := range []string{"alias1", "alias2"} {
+		if _, err := db.GetURLByHash(hash); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("alias %s lookup error after deleting its link = %v, want sql.ErrNoRows", hash, err)
+		}
+	}
+	if exists, _ := db.CheckHashExists("other1"); !exists {
+		t.Error("deleting a link removed an unrelated link")
+	}
+}
+
+func TestStaleURLsAndDelete(t *testing.T) {
+	db := newTestDB(t)
+
+	stale, _ := db.CreateURL("https://example.com/old", "old001", "", 0)
+	db.CreateURL("https://example.com/used", "used01", "", 0)
+	db.CreateURL("https://example.com/new", "new001", "", 0)
+	if err := db.IncrementClicks("used01"); err != nil {
+		t.Fatalf("IncrementClicks: %v", err)
+	}
+	backdate := time.Now().AddDate(0, 0, -40)
+	if _, err := db.conn.Exec(`UPDATE urls SET created_at = ? WHERE short_hash IN ('old001', 'used01')`, backdate); err != nil {
+		t.Fatalf("backdating links: %v", err)
+	}
+
+	urls, err := db.GetStaleURLs(30 * 24 * time.Hour)
+	if err != nil {
+		t.Fatalf("GetStaleURLs: %v", err)
+	}
+	if len(urls) != 1 || urls[0].ShortHash != "old001" {
+		t.Fatalf("GetStaleURLs = %+v, want only old001", urls)
+	}
+
+	if err := db.RecordClickEvent(stale.ID, "", "", 1); err != nil {
+		t.Fatalf("RecordClickEvent: %v", err)
+	}
+	deleted, err := db.DeleteURLs([]string{"old001", "missing"})
+	if err != nil {
+		t.Fatalf("DeleteURLs: %v", err)
+	}
+	if len(deleted) != 2 || !deleted[0] || deleted[1] {
+		t.Errorf("deleted = %v, want [true false]", deleted)
+	}
+	if _, err := db.GetURLByHash("old001"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("deleted link lookup error = %v, want sql.ErrNoRows", err)
+	}
+
+	var events int
+	db.conn.QueryRow(`SELECT COUNT(*) FROM click_events WHERE url_id = ?`, stale.ID).Scan(&events)
+	if events != 0 {
+		t.Errorf("%d click events left for deleted link", events)
+	}
+}
+
+func TestReconcileClicks(t *testing.T) {
+	db := newTestDB(t)
+
+	under, _ := db.CreateURL("https://example.com/a", "under1", "", 0)
+	db.CreateURL("https://example.com/b", "over01", "", 0)
+	ok, _ := db.CreateURL("https://example.com/c", "match1", "", 0)
+	sampled, _ := db.CreateURL("https://example.com/d", "sample", "", 0)
+
+	// under1 lost an increment, over01 lost its event, match1 is consistent
+	// and sample's events are a sample of its clicks.
+	db.RecordClickEvent(under.ID, "", "", 1)
+	db.RecordClickEvent(under.ID, "", "", 1)
+	db.IncrementClicks("under1")
+	db.IncrementClicks("over01")
+	db.RecordClickEvent(ok.ID, "", "", 1)
+	db.IncrementClicks("match1")
+	db.RecordClickEvent(sampled.ID, "", "", 5)
+	db.IncrementClicks("sample")
+	db.IncrementClicks("sample")
+
+	want := []ClickDiscrepancy{
+		{ShortHash: "under1", Clicks: 1, Events: 2},
+		{ShortHash: "over01", Clicks: 1, Events: 0},
+	}
+
+	found, err := db.ReconcileClicks(true)
+	if err != nil {
+		t.Fatalf("ReconcileClicks(dry run): %v", err)
+	}
+	if !reflect.DeepEqual(found, want) {
+		t.Fatalf("ReconcileClicks(dry run) = %+v, want %+v", found, want)
+	}
+	if got, _ := db.GetURLByHash("under1"); got.Clicks != 1 {
+		t.Errorf("dry run changed clicks to %d", got.Clicks)
+	}
+
+	if found, err = db.ReconcileClicks(false); err != nil || !reflect.DeepEqual(found, want) {
+		t.Fatalf("ReconcileClicks = %+v, %v; want %+v", found, err, want)
+	}
+	for hash, clicks := range map[string]int{"under1": 2, "over01": 0, "match1": 1} {
+		if got, _ := db.GetURLByHash(hash); got.Clicks != clicks {
+			t.Errorf("%s clicks = %d, want %d", hash, got.Clicks, clicks)
+		}
+	}
+
+	if found, _ = db.ReconcileClicks(true); len(found) != 0 {
+		t.Errorf("after reconciling, discrepancies = %+v, want none", found)
+	}
+}
+
+func TestGetURLsByHealth(t *testing.T) {
+	db := newTestDB(t)
+
+	for _, h := range []string{"up", "down", "gone", "new"} {
+		if _, err := db.CreateURL("https://example.com/"+h, h, "", 0); err != nil {
+			t.Fatalf("CreateURL(%s): %v", h, err)
+		}
+	}
+	for h, status := range map[string]int{"up": 301, "down": 500, "gone": 0} {
+		if err := db.RecordCheck(h, status); err != nil {
+			t.Fatalf("RecordCheck(%s): %v", h, err)
+		}
+	}
+	if err := db.RecordCheck("missing", 200); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("RecordCheck(missing) = %v, want sql.ErrNoRows", err)
+	}
+
+	want := map[string][]string{
+		HealthOK:        {"up"},
+		HealthBroken:    {"down", "gone"},
+		HealthUnchecked: {"new"},
+	}
+	for health, hashes := range want {
+		urls, err := db.GetURLsByHealth(health)
+		if err != nil {
+			t.Fatalf("GetURLsByHealth(%s): %v", health, err)
+		}
+		var got []string
+		for _, u := range urls {
+			if u.Health != health {
+				t.Errorf("%s: Health = %q, want %q", u.ShortHash, u.Health, health)
+			}
+			got = append(got, u.ShortHash)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, hashes) {
+			t.Errorf("GetURLsByHealth(%s) = %v, want %v", health, got, hashes)
+		}
+	}
+
+	if _, err := db.GetURLsByHealth("sick"); err == nil {
+		t.Error("GetURLsByHealth(sick) succeeded, want an error")
+	}
+}
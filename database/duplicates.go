@@ -0,0 +1,136 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// DuplicateDestination is a destination that more than one link points to.
+// URLs are ordered oldest first.
+type DuplicateDestination struct {
+	FullURL string
+	URLs    []URL
+}
+
+// FindDuplicateDestinations returns every destination with more than one
+// link, ordered by destination. Aliases aren't duplicates and are left out.
+func (db *DB) FindDuplicateDestinations() ([]DuplicateDestination, error) {
+	query := `
+		SELECT ` + urlColumns + `
+		FROM urls
+		WHERE alias_of IS NULL AND full_url IN (
+			SELECT full_url FROM urls WHERE alias_of IS NULL GROUP BY full_url HAVING COUNT(*) > 1
+		)
+		ORDER BY full_url, id
+	`
+
+	rows, err := db.conn.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var duplicates []DuplicateDestination
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(duplicates); n == 0 || duplicates[n-1].FullURL != url.FullURL {
+			duplicates = append(duplicates, DuplicateDestination{FullURL: url.FullURL})
+		}
+		last := &duplicates[len(duplicates)-1]
+		last.URLs = append(last.URLs, url)
+	}
+
+	return duplicates, rows.Err()
+}
+
+// MergeDuplicates folds the links in mergeHashes into keepHash, which must
+// all point to the same destination. Their clicks, QR views and click events
+// move to the kept link. With deleteMerged the merged links are deleted;
+// otherwise they become aliases of the kept link, with their counts reset so
+// nothing is counted twice. Their own aliases move to the kept link.
+// Everything happens in one transaction, and the kept link is returned with
+// its new totals.
+func (db *DB) MergeDuplicates(keepHash string, mergeHashes []string, deleteMerged bool) (*URL, error) {
+	var kept *URL
+	err := retryOnBusy(func() error {
+		var err error
+		kept, err = db.mergeDuplicates(keepHash, mergeHashes, deleteMerged)
+		return err
+	})
+	return kept, err
+}
+
+func (db *DB) mergeDuplicates(keepHash string, mergeHashes []string, deleteMerged bool) (*URL, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	selectURL := `SELECT ` + urlColumns + ` FROM urls WHERE short_hash = ?`
+
+	keep, err := scanURL(tx.QueryRow(selectURL, keepHash))
+	if err != nil {
+		return nil, err
+	}
+	lastClicked := keep.LastClickedAt
+
+	for _, hash := range mergeHashes {
+		if hash == keepHash {
+			return nil, fmt.Errorf("cannot merge %s into itself", hash)
+		}
+
+		url, err := scanURL(tx.QueryRow(selectURL, hash))
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("link %s not found", hash)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if url.FullURL != keep.FullURL {
+			return nil, fmt.Errorf("link %s points to %s, not %s", hash, url.FullURL, keep.FullURL)
+		}
+
+		_, err = tx.Exec(`UPDATE urls SET clicks = clicks + ?, qr_views = qr_views + ? WHERE id = ?`, url.Clicks, url.QRViews, keep.ID)
+		if err != nil {
+			return nil, err
+		}
+		if url.LastClickedAt != nil && (lastClicked == nil || url.LastClickedAt.After(*lastClicked)) {
+			lastClicked = url.LastClickedAt
+		}
+
+		if _, err := tx.Exec(`UPDATE click_events SET url_id = ? WHERE url_id = ?`, keep.ID, url.ID); err != nil {
+			return nil, err
+		}
+
+		if _, err := tx.Exec(`UPDATE urls SET alias_of = ? WHERE alias_of = ?`, keep.ID, url.ID); err != nil {
+			return nil, err
+		}
+
+		if deleteMerged {
+			_, err = tx.Exec(`DELETE FROM urls WHERE id = ?`, url.ID)
+		} else {
+			_, err = tx.Exec(`UPDATE urls SET clicks = 0, qr_views = 0, last_clicked_at = NULL, alias_of = ? WHERE id = ?`, keep.ID, url.ID)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE urls SET last_clicked_at = ? WHERE id = ?`, lastClicked, keep.ID); err != nil {
+		return nil, err
+	}
+
+	keep, err = scanURL(tx.QueryRow(selectURL, keepHash))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &keep, nil
+}
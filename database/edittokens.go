@@ -0,0 +1,31 @@
+package database
+
+import (
+	"database/sql"
+)
+
+// SetEditToken stores the hash of a link's edit token, replacing any previous
+// token. An empty hash revokes it. It returns sql.ErrNoRows if the link
+// doesn't exist.
+func (db *DB) SetEditToken(shortHash, tokenHash string) error {
+	result, err := db.exec(`UPDATE urls SET edit_token_hash = ? WHERE short_hash = ?`, tokenHash, shortHash)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetEditTokenHash returns the hash of a link's edit token, or "" if it has
+// none. It returns sql.ErrNoRows if the link doesn't exist.
+func (db *DB) GetEditTokenHash(shortHash string) (string, error) {
+	var tokenHash string
+	err := db.conn.QueryRow(`SELECT edit_token_hash FROM urls WHERE short_hash = ?`, shortHash).Scan(&tokenHash)
+	return tokenHash, err
+}
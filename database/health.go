@@ -0,0 +1,88 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Link health, computed from the result of the last destination check.
+const (
+	HealthOK        = "ok"
+	HealthBroken    = "broken"
+	HealthUnchecked = "unchecked"
+)
+
+// healthExpr computes a link's health in SQL, matching linkHealth.
+const healthExpr = `CASE
+	WHEN urls.last_checked IS NULL THEN 'unchecked'
+	WHEN urls.last_status BETWEEN 200 AND 399 THEN 'ok'
+	ELSE 'broken' END`
+
+// linkHealth returns the health of a link whose last check, if any, got
+// status. Success and redirect statuses are ok; error statuses and checks
+// that got no response (status 0) are broken.
+func linkHealth(status int, checked *time.Time) string {
+	switch {
+	case checked == nil:
+		return HealthUnchecked
+	case status >= 200 && status < 400:
+		return HealthOK
+	}
+	return HealthBroken
+}
+
+// RecordCheck stores the result of checking a link's destination: the HTTP
+// status it answered with, or 0 if the check failed without a response. It
+// returns sql.ErrNoRows if the link doesn't exist.
+func (db *DB) RecordCheck(shortHash string, status int) error {
+	result, err := db.exec(`UPDATE urls SET last_status = ?, last_checked = ? WHERE short_hash = ?`, status, time.Now(), shortHash)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetURLsByHealth returns the links with the given health (HealthOK,
+// HealthBroken or HealthUnchecked), most recently checked first, joined with
+// the username of their creator.
+func (db *DB) GetURLsByHealth(status string) ([]URLWithCreator, error) {
+	switch status {
+	case HealthOK, HealthBroken, HealthUnchecked:
+	default:
+		return nil, fmt.Errorf("unknown link health %q", status)
+	}
+
+	query := `
+		SELECT ` + prefixColumns("urls", urlColumns) + `, COALESCE(users.username, '')
+		FROM urls
+		LEFT JOIN users ON users.id = urls.user_id
+		WHERE ` + healthExpr + ` = ?
+		ORDER BY urls.last_checked DESC, urls.created_at DESC
+	`
+
+	rows, err := db.conn.Query(query, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []URLWithCreator
+	for rows.Next() {
+		var creator string
+		url, err := scanURL(rows, &creator)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, URLWithCreator{URL: url, CreatorUsername: creator})
+	}
+
+	return urls, rows.Err()
+}
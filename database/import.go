@@ -0,0 +1,144 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ImportResult records the hash an imported link was stored under.
+// ShortHash differs from OriginalHash when the original was missing or
+// already taken and a new one had to be generated. Skipped links were not
+// imported because their hash was taken.
+type ImportResult struct {
+	OriginalHash string `json:"original_hash"`
+	ShortHash    string `json:"short_hash"`
+	FullURL      string `json:"full_url"`
+	Skipped      bool   `json:"skipped,omitempty"`
+}
+
+// Remapped reports whether the link was stored under a new hash.
+func (r ImportResult) Remapped() bool {
+	return !r.Skipped && r.OriginalHash != r.ShortHash
+}
+
+// ImportURLs inserts links in a single transaction, so a failed import leaves
+// the database unchanged. Each link keeps its ShortHash unless it is empty or
+// collides (ignoring case) with an existing link, in which case
+// generateHash is called to pick a new one. With a nil generateHash,
+// colliding links are skipped instead, and links without a hash are an
+// error. userID records the importing user; pass 0 for none.
+//
+// CreatedAt, Clicks, QRViews, LastClickedAt, Domain, PublicStats,
+// ForwardQuery, QRPreview, ClickSampleRate and UpdatedAt are kept when set.
+// Links with an ID, as read from another database, can be aliases: AliasOf is
+// matched against the IDs of links earlier in urls, or of the existing links
+// they were skipped for, and links whose canonical link isn't found are
+// imported as ordinary links.
+func (db *DB) ImportURLs(urls []URL, userID int, generateHash func(exists func(string) (bool, error)) (string, error)) ([]ImportResult, error) {
+	var results []ImportResult
+	err := retryOnBusy(func() error {
+		var err error
+		results, err = db.importURLs(urls, userID, generateHash)
+		return err
+	})
+	return results, err
+}
+
+func (db *DB) importURLs(urls []URL, userID int, generateHash func(exists func(string) (bool, error)) (string, error)) ([]ImportResult, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	exists := func(hash string) (bool, error) {
+		var found bool
+		err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM urls WHERE short_hash_lower = ?)`, strings.ToLower(hash)).Scan(&found)
+		return found, err
+	}
+
+	var creator sql.NullInt64
+	if userID != 0 {
+		creator = sql.NullInt64{Int64: int64(userID), Valid: true}
+	}
+
+	// ids maps the IDs links had where they were exported to their IDs
+	// here, for resolving aliases.
+	ids := make(map[int]int)
+
+	results := make([]ImportResult, 0, len(urls))
+	for _, url := range urls {
+		shortHash := url.ShortHash
+		taken := shortHash == ""
+		if !taken {
+			if taken, err = exists(shortHash); err != nil {
+				return nil, err
+			}
+		}
+		if taken && generateHash == nil {
+			if shortHash == "" {
+				return nil, errors.New("link to " + url.FullURL + " has no short hash")
+			}
+			var existing int
+			if err := tx.QueryRow(`SELECT COALESCE(alias_of, id) FROM urls WHERE short_hash_lower = ?`, strings.ToLower(shortHash)).Scan(&existing); err != nil {
+				return nil, err
+			}
+			if url.ID != 0 {
+				ids[url.ID] = existing
+			}
+			results = append(results, ImportResult{
+				OriginalHash: url.ShortHash,
+				ShortHash:    shortHash,
+				FullURL:      url.FullURL,
+				Skipped:      true,
+			})
+			continue
+		}
+		if taken {
+			if shortHash, err = generateHash(exists); err != nil {
+				return nil, err
+			}
+		}
+
+		createdAt := url.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = time.Now()
+		}
+		var aliasOf sql.NullInt64
+		if id, ok := ids[url.AliasOf]; ok && url.AliasOf != 0 {
+			aliasOf = sql.NullInt64{Int64: int64(id), Valid: true}
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO urls (full_url, short_hash, short_hash_lower, title, user_id, created_at, clicks,
+				qr_views, last_clicked_at, domain, public_stats, updated_at, alias_of, forward_query, qr_preview,
+				click_sample_rate)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, url.FullURL, shortHash, strings.ToLower(shortHash), url.Title, creator, createdAt, url.Clicks,
+			url.QRViews, url.LastClickedAt, url.Domain, url.PublicStats, url.UpdatedAt, aliasOf, url.ForwardQuery, url.QRPreview,
+			sql.NullInt64{Int64: int64(url.ClickSampleRate), Valid: url.ClickSampleRate > 0})
+		if err != nil {
+			return nil, err
+		}
+		if url.ID != 0 {
+			id, err := result.LastInsertId()
+			if err != nil {
+				return nil, err
+			}
+			ids[url.ID] = int(id)
+		}
+
+		results = append(results, ImportResult{
+			OriginalHash: url.ShortHash,
+			ShortHash:    shortHash,
+			FullURL:      url.FullURL,
+		})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,75 @@
+package database
+
+// ClickDiscrepancy is a link whose clicks column doesn't match the number of
+// click events recorded for it.
+type ClickDiscrepancy struct {
+	ShortHash string `json:"short_hash"`
+	Clicks    int    `json:"clicks"`
+	Events    int    `json:"events"`
+}
+
+// ReconcileClicks finds links whose clicks count differs from their number
+// of click events and, unless dryRun, sets clicks to the event count. Both
+// happen in one transaction, so clicks recorded meanwhile can't be lost.
+// Links with sampled events are left out, since their events are only a
+// sample of their clicks.
+func (db *DB) ReconcileClicks(dryRun bool) ([]ClickDiscrepancy, error) {
+	var found []ClickDiscrepancy
+	err := retryOnBusy(func() error {
+		var err error
+		found, err = db.reconcileClicks(dryRun)
+		return err
+	})
+	return found, err
+}
+
+func (db *DB) reconcileClicks(dryRun bool) ([]ClickDiscrepancy, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT urls.short_hash, COALESCE(urls.clicks, 0), COUNT(click_events.id)
+		FROM urls
+		LEFT JOIN click_events ON click_events.url_id = urls.id
+		GROUP BY urls.id
+		HAVING COALESCE(urls.clicks, 0) != COUNT(click_events.id)
+			AND COALESCE(MAX(click_events.sample_rate), 1) = 1
+		ORDER BY urls.id
+	`
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []ClickDiscrepancy
+	for rows.Next() {
+		var d ClickDiscrepancy
+		if err := rows.Scan(&d.ShortHash, &d.Clicks, &d.Events); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		found = append(found, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return found, nil
+	}
+
+	for _, d := range found {
+		if _, err := tx.Exec(`UPDATE urls SET clicks = ? WHERE short_hash = ?`, d.Events, d.ShortHash); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
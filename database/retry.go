@@ -0,0 +1,52 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Retry settings for writes that fail because another connection holds the
+// database lock. Delays double after each attempt: 10ms, 20ms, 40ms, 80ms.
+const (
+	busyRetryAttempts = 5
+	busyRetryDelay    = 10 * time.Millisecond
+)
+
+// isBusy reports whether err is SQLite's "database is locked" or "database
+// table is locked" error.
+func isBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
+
+// retryOnBusy runs fn, retrying with backoff while it fails with a locked
+// database error. Other errors are returned immediately. fn must be safe to
+// repeat, e.g. a single statement or a whole transaction.
+func retryOnBusy(fn func() error) error {
+	delay := busyRetryDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); !isBusy(err) || attempt == busyRetryAttempts {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// exec runs a write statement, retrying while the database is locked.
+func (db *DB) exec(query string, args ...any) (sql.Result, error) {
+	var result sql.Result
+	err := retryOnBusy(func() error {
+		var err error
+		result, err = db.conn.Exec(query, args...)
+		return err
+	})
+	return result, err
+}
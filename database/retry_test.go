@@ -0,0 +1,70 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestRetryOnBusy(t *testing.T) {
+	calls := 0
+	err := retryOnBusy(func() error {
+		calls++
+		if calls < 3 {
+			return sqlite3.Error{Code: sqlite3.ErrBusy}
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("retryOnBusy = %v after %d calls, want success after 3", err, calls)
+	}
+
+	calls = 0
+	err = retryOnBusy(func() error {
+		calls++
+		return sqlite3.Error{Code: sqlite3.ErrBusy}
+	})
+	if !isBusy(err) || calls != busyRetryAttempts {
+		t.Errorf("retryOnBusy = %v after %d calls, want busy error after %d", err, calls, busyRetryAttempts)
+	}
+}
+
+// TestCreateURLWaitsForLock holds the write lock from another connection and
+// checks that a write made meanwhile succeeds once the lock is released.
+func TestCreateURLWaitsForLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locked.db")
+
+	// A zero busy timeout makes SQLite fail immediately instead of waiting,
+	// so only the retry helper can make the write succeed.
+	db, err := NewDB(path + "?_busy_timeout=0")
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	other, err := sql.Open("sqlite3", path+"?_busy_timeout=0")
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	t.Cleanup(func() { other.Close() })
+
+	tx, err := other.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO users (username, password_hash, created_at) VALUES ('holder', 'x', ?)`, time.Now()); err != nil {
+		t.Fatalf("locking insert: %v", err)
+	}
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		tx.Commit()
+	}()
+
+	if _, err := db.CreateURL("https://example.com", "abc123", "", 0); err != nil {
+		t.Fatalf("CreateURL while locked: %v", err)
+	}
+}
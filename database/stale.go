@@ -0,0 +1,33 @@
+package database
+
+import (
+	"time"
+)
+
+// GetStaleURLs returns links created more than olderThan ago that have never
+// been clicked, oldest first.
+func (db *DB) GetStaleURLs(olderThan time.Duration) ([]URL, error) {
+	query := `
+		SELECT ` + urlColumns + `
+		FROM urls
+		WHERE clicks = 0 AND created_at < ?
+		ORDER BY created_at ASC, id ASC
+	`
+
+	rows, err := db.conn.Query(query, time.Now().Add(-olderThan))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []URL
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+
+	return urls, rows.Err()
+}
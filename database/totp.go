@@ -0,0 +1,86 @@
+package database
+
+import (
+	"time"
+)
+
+// EnableTOTP turns on two-factor authentication for a user with the given
+// secret, replacing any previous recovery codes with codeHashes.
+func (db *DB) EnableTOTP(userID int, secret string, codeHashes []string) error {
+	return retryOnBusy(func() error {
+		return db.setTOTP(userID, secret, codeHashes)
+	})
+}
+
+// DisableTOTP turns off two-factor authentication for a user and deletes
+// their recovery codes.
+func (db *DB) DisableTOTP(userID int) error {
+	return retryOnBusy(func() error {
+		return db.setTOTP(userID, "", nil)
+	})
+}
+
+func (db *DB) setTOTP(userID int, secret string, codeHashes []string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE users SET totp_secret = ?, totp_last_step = 0 WHERE id = ?`, secret, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec(`INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)`, userID, hash); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records that the user has used the TOTP code of the given time
+// step. It reports false if a code from that step or a later one was already
+// used, so a code can't be replayed while it's still valid.
+func (db *DB) UseTOTPStep(userID int, step int64) (bool, error) {
+	result, err := db.exec(`UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?`, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// UseRecoveryCode marks the user's unused recovery code with the given hash
+// as used. It reports false if there is no such unused code.
+func (db *DB) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	query := `
+		UPDATE recovery_codes
+		SET used_at = ?
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+	`
+
+	result, err := db.exec(query, time.Now(), userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes a user has left.
+func (db *DB) CountRecoveryCodes(userID int) (int, error) {
+	var count int
+	err := db.conn.QueryRow(`SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL`, userID).Scan(&count)
+	return count, err
+}
@@ -163,9 +163,9 @@ deploy() {
     source .env
     
     if [[ "${DEPLOY_MODE:-}" == "local" ]]; then
-        HEALTH_URL="http://localhost:${PORT:-8080}/login"
+        HEALTH_URL="http://localhost:${PORT:-8080}/healthz"
     else
-        HEALTH_URL="https://${TRAEFIK_DOMAIN}/login"
+        HEALTH_URL="https://${TRAEFIK_DOMAIN}/healthz"
     fi
     
     for i in {1..30}; do
@@ -248,9 +248,9 @@ health_check() {
     source .env
     
     if [[ "${DEPLOY_MODE:-}" == "local" ]]; then
-        HEALTH_URL="http://localhost:${PORT:-8080}/login"
+        HEALTH_URL="http://localhost:${PORT:-8080}/healthz"
     else
-        HEALTH_URL="https://${TRAEFIK_DOMAIN}/login"
+        HEALTH_URL="https://${TRAEFIK_DOMAIN}/healthz"
     fi
     
     if curl -f -k "$HEALTH_URL" > /dev/null 2>&1; then
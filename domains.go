@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"qr-linker/database"
+)
+
+// vanityDomains is the allowlist of branded hosts links may be served from,
+// from VANITY_DOMAINS.
+var vanityDomains []string
+
+// parseVanityDomains reads a comma-separated list of hostnames. Entries are
+// lowercased and must be bare hosts, without a scheme, port or path.
+func parseVanityDomains(raw string) ([]string, error) {
+	var domains []string
+	for _, d := range strings.Split(raw, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d == "" {
+			continue
+		}
+		if strings.ContainsAny(d, ":/ ") {
+			return nil, fmt.Errorf("%q is not a bare hostname", d)
+		}
+		domains = append(domains, d)
+	}
+	return domains, nil
+}
+
+func isVanityDomain(host string) bool {
+	return host != "" && slices.Contains(vanityDomains, host)
+}
+
+// hostOf strips any port from a Host header and lowercases it.
+func hostOf(hostHeader string) string {
+	if host, _, err := net.SplitHostPort(hostHeader); err == nil {
+		hostHeader = host
+	}
+	return strings.ToLower(hostHeader)
+}
+
+// servedOnHost reports whether a link may be resolved on the request's host.
+// On a vanity domain only the links assigned to it resolve, so one brand's
+// domain can't be used to reach another's links. The default host serves
+// every link.
+func servedOnHost(url *database.URL, r *http.Request) bool {
+	host := hostOf(r.Host)
+	return !isVanityDomain(host) || url.Domain == host
+}
+
+// parseLinkDomain reads the shorten form's domain selector. An empty value
+// means the default host.
+func parseLinkDomain(raw string) (string, error) {
+	domain := strings.ToLower(strings.TrimSpace(raw))
+	if domain != "" && !isVanityDomain(domain) {
+		return "", fmt.Errorf("Domain %q is not an allowed vanity domain", raw)
+	}
+	return domain, nil
+}
+
+// shortURLFor returns a link's public short URL. Links with an allowed vanity
+// domain use it, with the scheme of BASE_URL; all others use BASE_URL.
+func shortURLFor(url *database.URL) string {
+	base := os.Getenv("_INTERNAL_BASE_URL")
+	if isVanityDomain(url.Domain) {
+		scheme, _, _ := strings.Cut(base, "://")
+		base = scheme + "://" + url.Domain
+	}
+	return base + "/" + url.ShortHash
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"qr-linker/database"
+	"qr-linker/qrgen"
+	"qr-linker/utils"
+)
+
+// Edit tokens let whoever holds a link's edit URL, typically printed as a
+// second QR code next to the link's own, change that one link's destination
+// at /edit/{hash} without logging in. Only a hash of the token is stored.
+// Each client address may make editTokenLimit requests to /edit/ per
+// editTokenWindow, which keeps tokens from being guessed.
+const (
+	editTokenLimit  = 20
+	editTokenWindow = 15 * time.Minute
+)
+
+var editTokenLimiter = newRateLimiter()
+
+type EditData struct {
+	Title       string
+	ShortHash   string
+	ShortURL    string
+	Token       string
+	Destination string
+	Saved       bool
+	Error       string
+}
+
+// newEditToken returns a random edit token and the hash to store for it.
+func newEditToken() (string, string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashEditToken(token), nil
+}
+
+func hashEditToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// editURLFor returns the edit page URL for a link and token. It's always on
+// the BASE_URL host, since vanity domains only serve redirects.
+func editURLFor(shortHash, token string) string {
+	return os.Getenv("_INTERNAL_BASE_URL") + "/edit/" + url.PathEscape(shortHash) + "?token=" + url.QueryEscape(token)
+}
+
+// editTokenHandler serves /api/v1/urls/{hash}/edit-token. POST creates a new
+// edit token for the link, replacing any previous one, and returns it with
+// its edit URL and a QR code of that URL; the token can't be retrieved
+// again. DELETE revokes the link's token.
+func editTokenHandler(w http.ResponseWriter, r *http.Request, shortHash string) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	link, err := db.GetURLByHash(shortHash)
+	if err != nil {
+		respondError(w, r, http.StatusNotFound, errCodeNotFound, "Short link not found")
+		return
+	}
+	if link.AliasOf != 0 {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Aliases follow their canonical link's destination; create the edit token for that link instead")
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := db.SetEditToken(link.ShortHash, ""); err != nil {
+			log.Printf("Error revoking edit token of %s: %v", link.ShortHash, err)
+			respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to revoke edit token")
+			return
+		}
+		recordAudit(r, database.AuditEditTokenRevoked, link.ShortHash)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"short_hash": link.ShortHash,
+			"revoked":    true,
+		})
+		return
+	}
+
+	token, tokenHash, err := newEditToken()
+	if err != nil {
+		log.Printf("Error generating edit token: %v", err)
+		respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to create edit token")
+		return
+	}
+	editURL := editURLFor(link.ShortHash, token)
+	img, err := qrgen.PNG(editURL, defaultQROptions())
+	if err != nil {
+		log.Printf("Error generating edit QR code: %v", err)
+		respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to create edit token")
+		return
+	}
+	if err := db.SetEditToken(link.ShortHash, tokenHash); err != nil {
+		log.Printf("Error storing edit token of %s: %v", link.ShortHash, err)
+		respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to create edit token")
+		return
+	}
+	recordAudit(r, database.AuditEditTokenCreated, link.ShortHash)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"short_hash": link.ShortHash,
+		"token":      token,
+		"edit_url":   editURL,
+		"qr_code":    "data:image/png;base64," + base64.StdEncoding.EncodeToString(img),
+	})
+}
+
+// editPageHandler serves /edit/{hash}?token=..., where the holder of a
+// link's edit token can see and change its destination. The token grants
+// nothing else: not the title, other settings or any other link.
+func editPageHandler(w http.ResponseWriter, r *http.Request) {
+	// The token is in the URL, so keep it out of caches and referrers.
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if ok, retryAfter := editTokenLimiter.allow(clientIP(r), editTokenLimit, editTokenWindow); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		respondError(w, r, http.StatusTooManyRequests, errCodeRateLimited, "Too many requests, try again later")
+		return
+	}
+
+	shortHash := strings.TrimPrefix(r.URL.Path, "/edit/")
+	token := r.FormValue("token")
+	link, err := db.GetURLByHash(shortHash)
+	if err == nil && !validEditToken(link.ShortHash, token) {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error looking up %s for editing: %v", shortHash, err)
+		}
+		respondError(w, r, http.StatusNotFound, errCodeNotFound, "This edit link is invalid or has been revoked.")
+		return
+	}
+
+	data := EditData{
+		Title:       "Edit " + link.ShortHash + " - QR Linker",
+		ShortHash:   link.ShortHash,
+		ShortURL:    shortURLFor(link),
+		Token:       token,
+		Destination: link.FullURL,
+	}
+
+	if r.Method == http.MethodPost {
+		newURL, err := utils.NormalizeURL(r.FormValue("new_url"), autoPrependScheme, allowedSchemes...)
+		if err != nil {
+			data.Destination = r.FormValue("new_url")
+			data.Error = err.Error()
+		} else if err := db.UpdateURL(link.ShortHash, newURL, link.Title, false); err != nil {
+			log.Printf("Error updating URL: %v", err)
+			data.Error = "Failed to update the destination, please try again"
+		} else {
+			invalidateCachedURL(link.ShortHash)
+			recordAudit(r, database.AuditURLUpdated, link.ShortHash+" -> "+loggedURL(newURL)+" (edit token)")
+			data.Destination = newURL
+			data.Saved = true
+		}
+	}
+
+	tmpl, err := template.ParseFS(templatesFS, "templates/edit.html")
+	if err != nil {
+		http.Error(w, "Error loading template", http.StatusInternalServerError)
+		log.Printf("Template error: %v", err)
+		return
+	}
+	if data.Error != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Render error: %v", err)
+	}
+}
+
+// validEditToken reports whether token is the current edit token of the link
+// with shortHash. Links without a token accept none.
+func validEditToken(shortHash, token string) bool {
+	stored, err := db.GetEditTokenHash(shortHash)
+	if err != nil {
+		log.Printf("Error reading edit token of %s: %v", shortHash, err)
+		return false
+	}
+	if stored == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(hashEditToken(token))) == 1
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Error codes returned in JSON error responses.
+const (
+	errCodeMethodNotAllowed = "method_not_allowed"
+	errCodeBodyTooLarge     = "body_too_large"
+	errCodeInvalidRequest   = "invalid_request"
+	errCodeInvalidURL       = "invalid_url"
+	errCodeNotFound         = "not_found"
+	errCodeLimitReached     = "limit_reached"
+	errCodeHashTaken        = "hash_taken"
+	errCodeRateLimited      = "rate_limited"
+	errCodeCaptchaFailed    = "captcha_failed"
+	errCodeInternal         = "internal_error"
+	errCodeFetchFailed      = "fetch_failed"
+)
+
+// errorResponse is the JSON body of an error response.
+type errorResponse struct {
+	Error errorDetail `json:"error"`
+}
+
+type errorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ErrorData is passed to the error page template.
+type ErrorData struct {
+	Title   string
+	Status  int
+	Message string
+}
+
+// respondError writes an error in the form the client expects: JSON for API
+// paths and clients asking for JSON, otherwise an HTML error page. code is a
+// stable machine-readable identifier; message is shown to people.
+func respondError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	if isAPIRequest(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(errorResponse{Error: errorDetail{Code: code, Message: message}})
+		return
+	}
+
+	tmpl, err := template.ParseFS(templatesFS, "templates/error.html")
+	if err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	data := ErrorData{
+		Title:   http.StatusText(status),
+		Status:  status,
+		Message: message,
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Render error: %v", err)
+	}
+}
+
+// isAPIRequest reports whether r should get JSON rather than HTML errors.
+func isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/") || wantsJSON(r)
+}
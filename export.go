@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"qr-linker/auth"
+	"qr-linker/database"
+	"qr-linker/importer"
+	"qr-linker/utils"
+)
+
+// exportJSONHandler serves /export/json, a download of every link as one
+// JSON document in the importer.JSONExport format. With users=1 the users
+// are included too, without password hashes or two-factor secrets. Links are
+// written as they're read, so the export isn't held in memory; if reading
+// fails partway the document is left unterminated rather than looking
+// complete.
+func exportJSONHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var users []database.User
+	if r.URL.Query().Get("users") == "1" {
+		var err error
+		if users, err = db.GetAllUsers(); err != nil {
+			log.Printf("Error fetching users for export: %v", err)
+			respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to export")
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="qr-linker-%s.json"`, now.Format("2006-01-02")))
+
+	exportedAt, _ := json.Marshal(now)
+	fmt.Fprintf(w, `{"version":%d,"exported_at":%s,"urls":[`, importer.JSONVersion, exportedAt)
+
+	count := 0
+	err := db.EachURL(func(url database.URL) error {
+		data, err := json.Marshal(trackedURLView(&url))
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			io.WriteString(w, ",")
+		}
+		count++
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		log.Printf("Error exporting links: %v", err)
+		return
+	}
+
+	io.WriteString(w, "]")
+	if users != nil {
+		data, err := json.Marshal(users)
+		if err != nil {
+			log.Printf("Error exporting users: %v", err)
+			return
+		}
+		io.WriteString(w, `,"users":`)
+		w.Write(data)
+	}
+	io.WriteString(w, "}\n")
+}
+
+// jsonImportResponse reports the outcome of a JSON import.
+type jsonImportResponse struct {
+	Imported int `json:"imported"`
+	// Remapped are links stored under a new hash with conflict=rename.
+	Remapped []database.ImportResult `json:"remapped"`
+	// Conflicts are the hashes of links not imported because the hash was
+	// taken, with conflict=skip.
+	Conflicts []string `json:"conflicts"`
+	// Skipped are entries that couldn't be imported at all.
+	Skipped []skippedEntry `json:"skipped"`
+}
+
+// importJSONHandler restores links from a JSON export, sent either as the
+// request body or as the "file" field of a multipart form. The conflict
+// parameter decides what happens to links whose hash is already taken:
+// skip (the default) leaves the existing link alone, so importing the same
+// export twice is harmless, and rename stores the imported link under a new
+// hash. Links are imported in one transaction and recorded as created by the
+// importing user. Users in the export are ignored.
+func importJSONHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Imports keep the hashes in the file, so they're only open to users
+	// without a hash prefix.
+	userPrefix, err := userHashPrefix(r)
+	if err != nil {
+		log.Printf("Error looking up hash prefix: %v", err)
+		respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Import failed, nothing was imported")
+		return
+	}
+	if userPrefix != "" {
+		respondError(w, r, http.StatusForbidden, errCodeInvalidRequest, "Importing isn't available to users limited to a hash prefix")
+		return
+	}
+
+	var generate func(exists func(string) (bool, error)) (string, error)
+	switch r.URL.Query().Get("conflict") {
+	case "", "skip":
+	case "rename":
+		generate = utils.GenerateUniqueHash
+		if checksumHashes {
+			generate = utils.GenerateUniqueChecksummedHash
+		}
+	default:
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "conflict must be skip or rename")
+		return
+	}
+
+	body := r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			if isBodyTooLarge(err) {
+				respondError(w, r, http.StatusRequestEntityTooLarge, errCodeBodyTooLarge, "Request body too large")
+				return
+			}
+			respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Missing JSON file")
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	urls, skipped, err := importer.ParseJSON(body)
+	if err != nil {
+		if isBodyTooLarge(err) {
+			respondError(w, r, http.StatusRequestEntityTooLarge, errCodeBodyTooLarge, "Request body too large")
+			return
+		}
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
+		return
+	}
+
+	userID, _, _ := auth.GetUserFromSession(r)
+	results, err := db.ImportURLs(urls, userID, generate)
+	if err != nil {
+		log.Printf("Error importing links: %v", err)
+		respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Import failed, nothing was imported")
+		return
+	}
+
+	resp := jsonImportResponse{
+		Remapped:  []database.ImportResult{},
+		Conflicts: []string{},
+		Skipped:   []skippedEntry{},
+	}
+	for _, result := range results {
+		switch {
+		case result.Skipped:
+			resp.Conflicts = append(resp.Conflicts, result.OriginalHash)
+		case result.Remapped():
+			resp.Imported++
+			resp.Remapped = append(resp.Remapped, result)
+		default:
+			resp.Imported++
+		}
+	}
+	for _, s := range skipped {
+		resp.Skipped = append(resp.Skipped, skippedEntry{Entry: s.Entry, Reason: s.Reason})
+	}
+
+	if resp.Imported > 0 {
+		recordAudit(r, database.AuditURLsImported, fmt.Sprintf("%d links from json", resp.Imported))
+		if checksumHashes {
+			if err := uncheckedHashes.load(); err != nil {
+				log.Printf("Error reloading unchecked hashes: %v", err)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding import result: %v", err)
+	}
+}
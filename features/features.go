@@ -0,0 +1,95 @@
+// Package features reads the app's feature flags from the environment, so
+// optional behaviour can be switched on per deployment.
+package features
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Flags are the feature flags, read once at startup.
+type Flags struct {
+	// PublicShorten lets visitors create links without logging in.
+	PublicShorten bool
+	// PublicHome serves a landing page at "/" and moves the management UI
+	// to "/admin".
+	PublicHome bool
+	// PublicStats shows click counts to anonymous visitors for links
+	// without their own setting.
+	PublicStats bool
+	// ScanRedirect encodes /s/{hash} in QR codes to deduplicate scans.
+	ScanRedirect bool
+	// QRBeacon serves the /beacon/{hash} view counter.
+	QRBeacon bool
+	// Analytics records each click's time, referrer and user agent for
+	// the stats pages. Click totals are kept either way.
+	Analytics bool
+	// ForwardQuery passes a short link's query string on to the
+	// destination, for links without their own setting.
+	ForwardQuery bool
+	// QRPreview makes QR codes open the link's preview page, which shows the
+	// destination before continuing, for links without their own setting.
+	QRPreview bool
+}
+
+// flag describes one field of Flags.
+type flag struct {
+	// Name is the flag's name in the /api/v1/features response. The
+	// environment variable is FEATURE_ followed by the name in upper case.
+	Name string
+	// Legacy is the variable the flag was read from before it became a
+	// feature flag, still read when the FEATURE_ variable isn't set.
+	Legacy  string
+	Default bool
+	// Public flags are exposed to the frontend.
+	Public bool
+	Value  func(*Flags) *bool
+}
+
+var flags = []flag{
+	{"public_shorten", "PUBLIC_SHORTEN", false, true, func(f *Flags) *bool { return &f.PublicShorten }},
+	{"public_home", "PUBLIC_HOME", false, true, func(f *Flags) *bool { return &f.PublicHome }},
+	{"public_stats", "PUBLIC_STATS", true, true, func(f *Flags) *bool { return &f.PublicStats }},
+	{"scan_redirect", "SCAN_REDIRECT", false, false, func(f *Flags) *bool { return &f.ScanRedirect }},
+	{"qr_beacon", "QR_BEACON", false, true, func(f *Flags) *bool { return &f.QRBeacon }},
+	{"analytics", "", true, true, func(f *Flags) *bool { return &f.Analytics }},
+	{"forward_query", "", false, false, func(f *Flags) *bool { return &f.ForwardQuery }},
+	{"qr_preview", "", false, false, func(f *Flags) *bool { return &f.QRPreview }},
+}
+
+// Load reads the flags using getenv, normally os.Getenv. Each flag is taken
+// from its FEATURE_ variable, then its legacy variable, then its default.
+// Values are parsed with strconv.ParseBool, so true, false, 1 and 0 are all
+// accepted.
+func Load(getenv func(string) string) (Flags, error) {
+	var f Flags
+	for _, fl := range flags {
+		key := "FEATURE_" + strings.ToUpper(fl.Name)
+		raw := getenv(key)
+		if raw == "" && fl.Legacy != "" {
+			key, raw = fl.Legacy, getenv(fl.Legacy)
+		}
+
+		value := fl.Default
+		if raw != "" {
+			var err error
+			if value, err = strconv.ParseBool(raw); err != nil {
+				return Flags{}, fmt.Errorf("%s must be true or false, got %q", key, raw)
+			}
+		}
+		*fl.Value(&f) = value
+	}
+	return f, nil
+}
+
+// Public returns the flags exposed to the frontend by name.
+func (f Flags) Public() map[string]bool {
+	public := make(map[string]bool)
+	for _, fl := range flags {
+		if fl.Public {
+			public[fl.Name] = *fl.Value(&f)
+		}
+	}
+	return public
+}
@@ -0,0 +1,48 @@
+package features
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	env := map[string]string{
+		"FEATURE_PUBLIC_SHORTEN": "true",
+		// The FEATURE_ variable wins over the legacy one.
+		"FEATURE_PUBLIC_HOME": "0",
+		"PUBLIC_HOME":         "true",
+		// Legacy variables still work on their own.
+		"SCAN_REDIRECT":     "true",
+		"FEATURE_ANALYTICS": "false",
+	}
+	f, err := Load(func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	want := Flags{PublicShorten: true, PublicStats: true, ScanRedirect: true}
+	if f != want {
+		t.Errorf("Load = %+v, want %+v", f, want)
+	}
+
+	wantPublic := map[string]bool{
+		"public_shorten": true,
+		"public_home":    false,
+		"public_stats":   true,
+		"qr_beacon":      false,
+		"analytics":      false,
+	}
+	if got := f.Public(); !reflect.DeepEqual(got, wantPublic) {
+		t.Errorf("Public = %v, want %v", got, wantPublic)
+	}
+
+	_, err = Load(func(key string) string {
+		if key == "PUBLIC_STATS" {
+			return "yes please"
+		}
+		return ""
+	})
+	if err == nil || err.Error() != `PUBLIC_STATS must be true or false, got "yes please"` {
+		t.Errorf("Load with an invalid value: err = %v", err)
+	}
+}
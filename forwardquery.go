@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"qr-linker/database"
+	"qr-linker/utils"
+)
+
+// forwardQueryPrecedence decides which value wins when a forwarded query
+// parameter is also in the destination (FORWARD_QUERY_PRECEDENCE): the
+// destination's, or the incoming request's.
+var forwardQueryPrecedence = forwardDestinationWins
+
+const (
+	forwardDestinationWins = "destination"
+	forwardIncomingWins    = "incoming"
+)
+
+// forwardExcludedParams are query parameters the app uses itself on short
+// links, which are never forwarded.
+var forwardExcludedParams = []string{"scan"}
+
+func parseForwardQueryPrecedence(raw string) (string, error) {
+	switch raw {
+	case forwardDestinationWins, forwardIncomingWins:
+		return raw, nil
+	}
+	return "", fmt.Errorf("must be %s or %s, got %q", forwardDestinationWins, forwardIncomingWins, raw)
+}
+
+// forwardsQuery reports whether a link passes its query string on to the
+// destination.
+func forwardsQuery(url *database.URL) bool {
+	if url.ForwardQuery != nil {
+		return *url.ForwardQuery
+	}
+	return featureFlags.ForwardQuery
+}
+
+// destinationFor returns the URL to redirect a request for url to: its
+// destination, with the request's query parameters merged in when the link
+// forwards them. Only http(s) destinations get parameters.
+func destinationFor(url *database.URL, r *http.Request) string {
+	if !forwardsQuery(url) || r.URL.RawQuery == "" || !utils.IsHTTPURL(url.FullURL) {
+		return url.FullURL
+	}
+	incoming := r.URL.Query()
+	for _, name := range forwardExcludedParams {
+		incoming.Del(name)
+	}
+	return mergeQuery(url.FullURL, incoming, forwardQueryPrecedence == forwardIncomingWins)
+}
+
+// mergeQuery adds params to the query of destination. A parameter already in
+// destination keeps its values there, unless incomingWins, in which case its
+// values in destination are dropped and replaced. The destination's own
+// query is otherwise kept as it was written, and the added parameters are
+// appended sorted by name so the result is deterministic.
+func mergeQuery(destination string, params url.Values, incomingWins bool) string {
+	if len(params) == 0 {
+		return destination
+	}
+	u, err := url.Parse(destination)
+	if err != nil {
+		return destination
+	}
+
+	existing := u.Query()
+	var kept []string
+	if u.RawQuery != "" {
+		for _, pair := range strings.Split(u.RawQuery, "&") {
+			name, _, _ := strings.Cut(pair, "=")
+			if unescaped, err := url.QueryUnescape(name); err == nil {
+				name = unescaped
+			}
+			if _, replaced := params[name]; incomingWins && replaced {
+				continue
+			}
+			kept = append(kept, pair)
+		}
+	}
+
+	added := url.Values{}
+	for name, values := range params {
+		if _, ok := existing[name]; ok && !incomingWins {
+			continue
+		}
+		added[name] = values
+	}
+	if encoded := added.Encode(); encoded != "" {
+		kept = append(kept, encoded)
+	}
+
+	u.RawQuery = strings.Join(kept, "&")
+	u.ForceQuery = false
+	return u.String()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"qr-linker/auth"
+	"qr-linker/utils"
+)
+
+// Users with a hash prefix, assigned with cmd/manageusers, can only create
+// links and aliases whose hashes start with it and utils.PrefixSeparator,
+// e.g. acme-x7k2p9. Users without one are unrestricted.
+
+// userHashPrefix returns the prefix the logged-in user is limited to, or ""
+// for unrestricted users and anonymous requests.
+func userHashPrefix(r *http.Request) (string, error) {
+	userID, _, ok := auth.GetUserFromSession(r)
+	if !ok {
+		return "", nil
+	}
+	user, err := db.GetUserByID(userID)
+	if err != nil {
+		return "", err
+	}
+	return user.HashPrefix, nil
+}
+
+// checkHashPrefix returns an error when a user limited to prefix may not
+// use hash.
+func checkHashPrefix(prefix, hash string) error {
+	if prefix == "" || strings.HasPrefix(hash, prefix+utils.PrefixSeparator) {
+		return nil
+	}
+	return fmt.Errorf("hash must start with %s%s", prefix, utils.PrefixSeparator)
+}
+
+// requireUnrestricted refuses users limited to a hash prefix with 403. There
+// are no admin accounts, so it guards the instance-wide pages under /admin/
+// and the audit log, leaving them to unrestricted users. It goes inside
+// auth.RequireAuth.
+func requireUnrestricted(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		prefix, err := userHashPrefix(r)
+		if err != nil {
+			log.Printf("Error looking up hash prefix: %v", err)
+			respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to check permissions")
+			return
+		}
+		if prefix != "" {
+			respondError(w, r, http.StatusForbidden, errCodeInvalidRequest, "This page isn't available to users limited to a hash prefix")
+			return
+		}
+		next(w, r)
+	}
+}
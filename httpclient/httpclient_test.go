@@ -0,0 +1,37 @@
+package httpclient
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsBlockedIP(t *testing.T) {
+	blocked := []string{
+		"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.0.1", "169.254.169.254",
+		"100.64.0.1", "0.1.2.3", "::1", "fe80::1", "fd00:ec2::254", "::ffff:127.0.0.1",
+	}
+	for _, addr := range blocked {
+		if !isBlockedIP(net.ParseIP(addr)) {
+			t.Errorf("%s not blocked", addr)
+		}
+	}
+
+	for _, addr := range []string{"93.184.216.34", "2606:2800:220:1::1"} {
+		if isBlockedIP(net.ParseIP(addr)) {
+			t.Errorf("public address %s blocked", addr)
+		}
+	}
+}
+
+func TestNewRefusesLoopback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	_, err := New(true).Get(srv.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Get(%s) = %v, want ErrBlockedAddress", srv.URL, err)
+	}
+}
@@ -0,0 +1,100 @@
+// Package importer reads link exports from other URL shorteners.
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"qr-linker/database"
+	"qr-linker/utils"
+)
+
+// bitlyTimeLayout is the timestamp format used in Bitly exports.
+const bitlyTimeLayout = "2006-01-02T15:04:05-0700"
+
+// bitlyLink is a single entry of a Bitly bitlinks export.
+type bitlyLink struct {
+	ID        string `json:"id"`
+	Link      string `json:"link"`
+	LongURL   string `json:"long_url"`
+	Title     string `json:"title"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Skipped describes an export entry that couldn't be imported.
+type Skipped struct {
+	Entry  string
+	Reason string
+}
+
+// ParseBitly reads a Bitly export: either the bitlinks API response
+// ({"links": [...]}) or a bare array of links. Original short codes are kept
+// when they are valid hashes here; otherwise ShortHash is left empty so a new
+// one is generated on import. Entries without a usable destination are
+// returned as skipped.
+func ParseBitly(r io.Reader) ([]database.URL, []Skipped, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var links []bitlyLink
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &links)
+	} else {
+		var export struct {
+			Links []bitlyLink `json:"links"`
+		}
+		err = json.Unmarshal(data, &export)
+		links = export.Links
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid Bitly export: %w", err)
+	}
+
+	var urls []database.URL
+	var skipped []Skipped
+	for _, link := range links {
+		fullURL, err := utils.NormalizeURL(link.LongURL, true)
+		if err != nil {
+			skipped = append(skipped, Skipped{Entry: link.ID, Reason: err.Error()})
+			continue
+		}
+
+		u := database.URL{
+			FullURL:   fullURL,
+			ShortHash: bitlyCode(link),
+			Title:     strings.TrimSpace(link.Title),
+		}
+		if utils.ValidateHash(u.ShortHash) != nil {
+			u.ShortHash = ""
+		}
+		if u.Title == "" {
+			if parsed, err := url.Parse(fullURL); err == nil {
+				u.Title = parsed.Hostname()
+			}
+		}
+		if t, err := time.Parse(bitlyTimeLayout, link.CreatedAt); err == nil {
+			u.CreatedAt = t
+		}
+
+		urls = append(urls, u)
+	}
+
+	return urls, skipped, nil
+}
+
+// bitlyCode extracts the short code from a link's id ("bit.ly/abc123"),
+// falling back to its full short link.
+func bitlyCode(link bitlyLink) string {
+	id := link.ID
+	if id == "" {
+		id = strings.TrimSuffix(link.Link, "/")
+	}
+	return id[strings.LastIndex(id, "/")+1:]
+}
@@ -0,0 +1,43 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseBitly(t *testing.T) {
+	export := `{"links": [
+		{"id": "bit.ly/abc123", "link": "https://bit.ly/abc123", "long_url": "https://example.com/a", "title": "Example", "created_at": "2021-03-04T05:06:07+0000"},
+		{"id": "bit.ly/login", "long_url": "https://example.com/b"},
+		{"id": "bit.ly/empty", "long_url": ""}
+	]}`
+
+	urls, skipped, err := ParseBitly(strings.NewReader(export))
+	if err != nil {
+		t.Fatalf("ParseBitly: %v", err)
+	}
+
+	if len(urls) != 2 {
+		t.Fatalf("got %d links, want 2", len(urls))
+	}
+	if urls[0].ShortHash != "abc123" || urls[0].Title != "Example" || urls[0].CreatedAt.Year() != 2021 {
+		t.Errorf("first link = %+v", urls[0])
+	}
+	// Reserved codes get a new hash on import; titles default to the host.
+	if urls[1].ShortHash != "" || urls[1].Title != "example.com" {
+		t.Errorf("second link = %+v", urls[1])
+	}
+	if len(skipped) != 1 || skipped[0].Entry != "bit.ly/empty" {
+		t.Errorf("skipped = %+v", skipped)
+	}
+}
+
+func TestParseBitlyArray(t *testing.T) {
+	urls, _, err := ParseBitly(strings.NewReader(`[{"link": "https://bit.ly/xyz/", "long_url": "example.com"}]`))
+	if err != nil {
+		t.Fatalf("ParseBitly: %v", err)
+	}
+	if len(urls) != 1 || urls[0].ShortHash != "xyz" || urls[0].FullURL != "https://example.com" {
+		t.Errorf("links = %+v", urls)
+	}
+}
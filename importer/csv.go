@@ -0,0 +1,166 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"qr-linker/database"
+	"qr-linker/utils"
+)
+
+// utf8BOM is the byte order mark spreadsheet applications put at the start
+// of CSV exports.
+const utf8BOM = "\ufeff"
+
+// newCSVReader returns a CSV reader that drops the byte order mark of
+// spreadsheet exports and accepts rows with any number of columns, so the
+// caller can report them individually.
+func newCSVReader(r io.Reader) *csv.Reader {
+	br := bufio.NewReader(r)
+	if bom, err := br.Peek(len(utf8BOM)); err == nil && string(bom) == utf8BOM {
+		br.Discard(len(utf8BOM))
+	}
+
+	reader := csv.NewReader(br)
+	reader.FieldsPerRecord = -1
+	return reader
+}
+
+// csvColumns are the columns a links CSV may have. Only url is required.
+var csvColumns = []string{"url", "short_hash", "title", "created_at", "clicks"}
+
+// ParseCSV reads links from a CSV file whose header row names its columns:
+// url, and optionally short_hash, title, created_at (RFC 3339 or
+// YYYY-MM-DD) and clicks, in any order. Other columns are ignored. Fields
+// are trimmed, stray quotes in unquoted fields are kept as text, and short
+// hashes that aren't valid here are left empty so a new one is generated on
+// import.
+//
+// Rows with an empty or invalid URL, unparseable values, or a different
+// number of columns than the header are returned as skipped with their line
+// number. Trailing empty columns, as left by spreadsheets, don't count. With
+// failFast the first such row is returned as an error instead.
+func ParseCSV(r io.Reader, failFast bool) ([]database.URL, []Skipped, error) {
+	reader := newCSVReader(r)
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil, errors.New("CSV is empty")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	index := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		for _, column := range csvColumns {
+			if name == column {
+				if _, dup := index[name]; dup {
+					return nil, nil, fmt.Errorf("CSV header has more than one %s column", name)
+				}
+				index[name] = i
+			}
+		}
+	}
+	if _, ok := index["url"]; !ok {
+		return nil, nil, fmt.Errorf("CSV header must include a url column (supported: %s)", strings.Join(csvColumns, ", "))
+	}
+
+	var urls []database.URL
+	var skipped []Skipped
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		u, reason := parseCSVRow(record, len(header), index)
+		if reason != "" {
+			if failFast {
+				return nil, nil, fmt.Errorf("line %d: %s", line, reason)
+			}
+			skipped = append(skipped, Skipped{Entry: fmt.Sprintf("line %d", line), Reason: reason})
+			continue
+		}
+		urls = append(urls, u)
+	}
+
+	return urls, skipped, nil
+}
+
+// parseCSVRow converts one CSV record to a link, or returns why it can't be
+// imported.
+func parseCSVRow(record []string, columns int, index map[string]int) (database.URL, string) {
+	for i := range record {
+		record[i] = strings.TrimSpace(record[i])
+	}
+	for len(record) > columns && record[len(record)-1] == "" {
+		record = record[:len(record)-1]
+	}
+	if len(record) != columns {
+		return database.URL{}, fmt.Sprintf("expected %d columns, got %d", columns, len(record))
+	}
+
+	field := func(name string) string {
+		if i, ok := index[name]; ok {
+			return record[i]
+		}
+		return ""
+	}
+
+	if field("url") == "" {
+		return database.URL{}, "url is empty"
+	}
+	fullURL, err := utils.NormalizeURL(field("url"), true)
+	if err != nil {
+		return database.URL{}, err.Error()
+	}
+
+	u := database.URL{
+		FullURL:   fullURL,
+		ShortHash: field("short_hash"),
+		Title:     field("title"),
+	}
+	if utils.ValidateHash(u.ShortHash) != nil {
+		u.ShortHash = ""
+	}
+	if u.Title == "" {
+		if parsed, err := url.Parse(fullURL); err == nil {
+			u.Title = parsed.Hostname()
+		}
+	}
+
+	if created := field("created_at"); created != "" {
+		t, err := time.Parse(time.RFC3339, created)
+		if err != nil {
+			t, err = time.Parse(time.DateOnly, created)
+		}
+		if err != nil {
+			return database.URL{}, fmt.Sprintf("invalid created_at %q (use RFC 3339 or YYYY-MM-DD)", created)
+		}
+		u.CreatedAt = t
+	}
+
+	if clicks := field("clicks"); clicks != "" {
+		n, err := strconv.Atoi(clicks)
+		if err != nil || n < 0 {
+			return database.URL{}, fmt.Sprintf("invalid clicks %q", clicks)
+		}
+		u.Clicks = n
+	}
+
+	return u, ""
+}
@@ -0,0 +1,88 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// messyCSV has a byte order mark, reordered and unknown columns, padding,
+// stray quotes, a spreadsheet's trailing empty column and rows that can't
+// be imported.
+const messyCSV = "\ufeff Title ,URL,notes,short_hash\n" +
+	"Spring Sale , example.com/sale ,,abc123\n" +
+	"The \"Best\" Menu,https://example.com/menu,x,\n" +
+	"Trailing,https://example.com/t,,login,\n" +
+	"No URL,   ,,def456\n" +
+	"Short row,https://example.com/s\n" +
+	"Too many,https://example.com/m,,ghi789,extra\n" +
+	" , ,\t,\n"
+
+func TestParseCSV(t *testing.T) {
+	urls, skipped, err := ParseCSV(strings.NewReader(messyCSV), false)
+	if err != nil {
+		t.Fatalf("ParseCSV: %v", err)
+	}
+
+	if len(urls) != 3 {
+		t.Fatalf("got %d links, want 3: %+v", len(urls), urls)
+	}
+	if urls[0].FullURL != "https://example.com/sale" || urls[0].ShortHash != "abc123" || urls[0].Title != "Spring Sale" {
+		t.Errorf("first link = %+v", urls[0])
+	}
+	if urls[1].Title != `The "Best" Menu` || urls[1].ShortHash != "" {
+		t.Errorf("second link = %+v", urls[1])
+	}
+	// Reserved hashes get a new one on import.
+	if urls[2].ShortHash != "" || urls[2].FullURL != "https://example.com/t" {
+		t.Errorf("third link = %+v", urls[2])
+	}
+
+	want := []Skipped{
+		{Entry: "line 5", Reason: "url is empty"},
+		{Entry: "line 6", Reason: "expected 4 columns, got 2"},
+		{Entry: "line 7", Reason: "expected 4 columns, got 5"},
+		{Entry: "line 8", Reason: "url is empty"},
+	}
+	if !reflect.DeepEqual(skipped, want) {
+		t.Errorf("skipped = %+v, want %+v", skipped, want)
+	}
+}
+
+func TestParseCSVFailFast(t *testing.T) {
+	_, _, err := ParseCSV(strings.NewReader(messyCSV), true)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 5: url is empty") {
+		t.Errorf("ParseCSV(failFast) error = %v, want the first bad row", err)
+	}
+}
+
+func TestParseCSVValues(t *testing.T) {
+	input := "url,created_at,clicks\n" +
+		"example.com/a,2021-03-04,7\n" +
+		"example.com/b,2021-03-04T05:06:07Z,\n" +
+		"example.com/c,yesterday,\n" +
+		"example.com/d,,-1\n"
+
+	urls, skipped, err := ParseCSV(strings.NewReader(input), false)
+	if err != nil {
+		t.Fatalf("ParseCSV: %v", err)
+	}
+	if len(urls) != 2 || urls[0].Clicks != 7 || urls[0].CreatedAt.Day() != 4 || urls[1].CreatedAt.Hour() != 5 {
+		t.Errorf("links = %+v", urls)
+	}
+	if len(skipped) != 2 {
+		t.Errorf("skipped = %+v, want the bad date and click count", skipped)
+	}
+}
+
+func TestParseCSVHeader(t *testing.T) {
+	for name, input := range map[string]string{
+		"empty":         "",
+		"no url column": "short_hash,title\nabc123,Example\n",
+		"duplicate url": "url,URL\nexample.com,example.org\n",
+	} {
+		if _, _, err := ParseCSV(strings.NewReader(input), false); err == nil {
+			t.Errorf("%s: ParseCSV succeeded, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"qr-linker/database"
+	"qr-linker/utils"
+)
+
+// JSONVersion is the version of the JSON export format, written in its
+// version field. It changes only if a field changes meaning.
+const JSONVersion = 1
+
+// JSONExport is a full export of the links, and optionally the users, of a
+// QR Linker database. Users never include password hashes or two-factor
+// secrets.
+type JSONExport struct {
+	Version    int             `json:"version"`
+	ExportedAt time.Time       `json:"exported_at"`
+	URLs       []database.URL  `json:"urls"`
+	Users      []database.User `json:"users,omitempty"`
+}
+
+// ParseJSON reads a JSON export written by QR Linker. Links keep their IDs so
+// aliases can be matched up on import. Links with an invalid destination,
+// a missing or invalid short hash, or negative counts are returned as
+// skipped, identified by their hash or position.
+func ParseJSON(r io.Reader) ([]database.URL, []Skipped, error) {
+	var export JSONExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, nil, fmt.Errorf("invalid JSON export: %w", err)
+	}
+	if export.Version != JSONVersion {
+		return nil, nil, fmt.Errorf("unsupported JSON export version %d (supported: %d)", export.Version, JSONVersion)
+	}
+
+	var urls []database.URL
+	var skipped []Skipped
+	for i, u := range export.URLs {
+		entry := u.ShortHash
+		if entry == "" {
+			entry = fmt.Sprintf("link %d", i+1)
+		}
+
+		reason := ""
+		fullURL, err := utils.NormalizeURL(u.FullURL, false)
+		hashErr := utils.ValidateHash(u.ShortHash)
+		switch {
+		case err != nil:
+			reason = err.Error()
+		case hashErr != nil:
+			reason = hashErr.Error()
+		case u.Clicks < 0 || u.QRViews < 0:
+			reason = "counts can't be negative"
+		}
+		if reason != "" {
+			skipped = append(skipped, Skipped{Entry: entry, Reason: reason})
+			continue
+		}
+
+		urls = append(urls, database.URL{
+			ID:              u.ID,
+			FullURL:         fullURL,
+			ShortHash:       u.ShortHash,
+			CreatedAt:       u.CreatedAt,
+			Clicks:          u.Clicks,
+			QRViews:         u.QRViews,
+			Title:           u.Title,
+			LastClickedAt:   u.LastClickedAt,
+			Domain:          u.Domain,
+			PublicStats:     u.PublicStats,
+			ForwardQuery:    u.ForwardQuery,
+			QRPreview:       u.QRPreview,
+			ClickSampleRate: u.ClickSampleRate,
+			UpdatedAt:       u.UpdatedAt,
+			AliasOf:         u.AliasOf,
+		})
+	}
+
+	return urls, skipped, nil
+}
@@ -0,0 +1,37 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseJSON(t *testing.T) {
+	export := `{"version": 1, "exported_at": "2026-01-02T03:04:05Z", "urls": [
+		{"id": 7, "full_url": "https://example.com/a", "short_hash": "abc123", "created_at": "2021-03-04T05:06:07Z", "clicks": 5, "qr_views": 2, "title": "Example", "last_clicked_at": null, "updated_at": null},
+		{"id": 8, "full_url": "https://example.com/a", "short_hash": "alias1", "created_at": "2022-01-01T00:00:00Z", "alias_of": 7},
+		{"id": 9, "full_url": "javascript:alert(1)", "short_hash": "bad123"},
+		{"id": 10, "full_url": "https://example.com/c", "short_hash": ""}
+	], "users": [{"id": 1, "username": "admin"}]}`
+
+	urls, skipped, err := ParseJSON(strings.NewReader(export))
+	if err != nil {
+		t.Fatalf("ParseJSON: %v", err)
+	}
+
+	if len(urls) != 2 {
+		t.Fatalf("got %d links, want 2", len(urls))
+	}
+	if u := urls[0]; u.ID != 7 || u.ShortHash != "abc123" || u.Clicks != 5 || u.QRViews != 2 || u.CreatedAt.Year() != 2021 {
+		t.Errorf("first link = %+v", u)
+	}
+	if urls[1].AliasOf != 7 {
+		t.Errorf("alias AliasOf = %d, want 7", urls[1].AliasOf)
+	}
+	if len(skipped) != 2 || skipped[0].Entry != "bad123" || skipped[1].Entry != "link 4" {
+		t.Errorf("skipped = %+v", skipped)
+	}
+
+	if _, _, err := ParseJSON(strings.NewReader(`{"version": 2, "urls": []}`)); err == nil {
+		t.Error("ParseJSON accepted an unknown version")
+	}
+}
@@ -0,0 +1,64 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// TitleRow is one row of a bulk title CSV.
+type TitleRow struct {
+	Line      int
+	ShortHash string
+	Title     string
+}
+
+// ParseTitlesCSV reads short_hash,title rows for a bulk title update. A
+// header row naming those columns is optional. Rows without a hash or title,
+// or with the wrong number of columns, are returned as skipped with their
+// line number.
+func ParseTitlesCSV(r io.Reader) ([]TitleRow, []Skipped, error) {
+	reader := newCSVReader(r)
+
+	var rows []TitleRow
+	var skipped []Skipped
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		entry := fmt.Sprintf("line %d", line)
+
+		if first && isTitlesHeader(record) {
+			continue
+		}
+		if len(record) != 2 {
+			skipped = append(skipped, Skipped{Entry: entry, Reason: fmt.Sprintf("expected 2 columns, got %d", len(record))})
+			continue
+		}
+
+		hash, title := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+		switch {
+		case hash == "":
+			skipped = append(skipped, Skipped{Entry: entry, Reason: "short_hash is empty"})
+		case title == "":
+			skipped = append(skipped, Skipped{Entry: entry, Reason: "title is empty"})
+		default:
+			rows = append(rows, TitleRow{Line: line, ShortHash: hash, Title: title})
+		}
+	}
+
+	return rows, skipped, nil
+}
+
+func isTitlesHeader(record []string) bool {
+	return len(record) == 2 &&
+		strings.EqualFold(strings.TrimSpace(record[0]), "short_hash") &&
+		strings.EqualFold(strings.TrimSpace(record[1]), "title")
+}
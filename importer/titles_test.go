@@ -0,0 +1,51 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTitlesCSV(t *testing.T) {
+	input := "short_hash,title\n" +
+		"abc123, Spring Sale \n" +
+		"\"def456\",\"Menu, Lunch\"\n" +
+		",No hash\n" +
+		"ghi789,\n" +
+		"jkl012,too,many\n"
+
+	rows, skipped, err := ParseTitlesCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseTitlesCSV: %v", err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2: %+v", len(rows), rows)
+	}
+	if rows[0] != (TitleRow{Line: 2, ShortHash: "abc123", Title: "Spring Sale"}) {
+		t.Errorf("first row = %+v", rows[0])
+	}
+	if rows[1].Title != "Menu, Lunch" {
+		t.Errorf("quoted title = %q", rows[1].Title)
+	}
+
+	if len(skipped) != 3 || skipped[0].Entry != "line 4" || skipped[2].Entry != "line 6" {
+		t.Errorf("skipped = %+v", skipped)
+	}
+}
+
+func TestParseTitlesCSVWithoutHeader(t *testing.T) {
+	rows, _, err := ParseTitlesCSV(strings.NewReader("abc123,Example\n"))
+	if err != nil || len(rows) != 1 || rows[0].Line != 1 {
+		t.Errorf("ParseTitlesCSV = %+v, %v", rows, err)
+	}
+
+	// Spreadsheet exports start with a byte order mark.
+	rows, _, err = ParseTitlesCSV(strings.NewReader("\ufeffshort_hash,title\nabc123,Example\n"))
+	if err != nil || len(rows) != 1 || rows[0].ShortHash != "abc123" {
+		t.Errorf("ParseTitlesCSV with BOM = %+v, %v", rows, err)
+	}
+
+	if _, _, err := ParseTitlesCSV(strings.NewReader("abc123,\"unterminated\n")); err == nil {
+		t.Error("malformed CSV parsed without error")
+	}
+}
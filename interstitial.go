@@ -0,0 +1,77 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"qr-linker/database"
+)
+
+// PreviewData is the data for the preview page, which shows where a link goes
+// before the visitor follows it.
+type PreviewData struct {
+	Title       string
+	Destination string
+	// Host is the destination's host, shown prominently since it's what
+	// visitors should check.
+	Host string
+	// Continue is the short link, with the preview's query string when the
+	// link forwards it.
+	Continue string
+}
+
+// qrOpensPreview reports whether a link's QR codes encode its preview page
+// rather than the short URL.
+func qrOpensPreview(url *database.URL) bool {
+	if url.QRPreview != nil {
+		return *url.QRPreview
+	}
+	return featureFlags.QRPreview
+}
+
+// previewPageHandler serves /preview/{hash}, which shows a link's
+// destination with a button to continue to it. Viewing it isn't counted;
+// continuing goes through the short link, which is.
+func previewPageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	setNoIndex(w)
+	shortHash := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/preview/"), "/")
+	url, ok := resolveLink(w, r, shortHash)
+	if !ok {
+		return
+	}
+
+	tmpl, err := template.ParseFS(templatesFS, "templates/preview.html")
+	if err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Error loading template", http.StatusInternalServerError)
+		return
+	}
+
+	data := PreviewData{
+		Title:       url.Title,
+		Destination: url.FullURL,
+		Host:        linkTitle("", url.FullURL),
+		Continue:    "/" + url.ShortHash,
+	}
+	if data.Title == "" {
+		data.Title = "Link preview"
+	}
+	if forwardsQuery(url) && r.URL.RawQuery != "" {
+		data.Destination = destinationFor(url, r)
+		data.Continue += "?" + r.URL.RawQuery
+	}
+
+	// The destination can be edited, so the page is never cached.
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Render error: %v", err)
+	}
+}
@@ -1,45 +1,196 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"embed"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
+	"image/png"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"qr-linker/auth"
+	"qr-linker/captcha"
+	"qr-linker/cache"
 	"qr-linker/database"
+	"qr-linker/features"
+	"qr-linker/qrgen"
 	"qr-linker/utils"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
-	"github.com/skip2/go-qrcode"
 )
 
 //go:embed templates/*.html
 var templatesFS embed.FS
 
-//go:embed static/*.css
+//go:embed static/*.css static/*.js
 var staticFS embed.FS
 
 type PageData struct {
 	Title     string
 	Message   string
-	URLs      []database.URL
-	ShortURL  string
-	Host      string
-	Error     string
-	Username  string
+	URLs      []database.URLWithCreator
+	Campaigns []database.Campaign
+	Domains   []string
+	// TotalLinks and TotalClicks are site-wide totals from the cached
+	// counters, which may lag the database by up to a minute.
+	TotalLinks  int
+	TotalClicks int
+	ShortURL    string
+	ShortHash   string
+	Host        string
+	Error       string
+	Username    string
+	// Health is the health the links are filtered by, empty for the most
+	// recent links.
+	Health string
+	// ClickTracking is false with DISABLE_CLICK_TRACKING, when click
+	// figures aren't shown.
+	ClickTracking bool
+	// Unrestricted is true for users without a hash prefix, who can open
+	// the dashboard and audit log.
+	Unrestricted bool
+}
+
+type LandingData struct {
+	Title         string
+	Authenticated bool
+	PublicShorten bool
+}
+
+type StatsData struct {
+	Title       string
+	URL         *database.URL
+	ShortURL    string
+	Username    string
+	PublicStats bool
+	// ForwardQuery reports whether the link passes its query string on.
+	ForwardQuery bool
+	// QRPreview reports whether the link's QR codes open its preview page.
+	QRPreview bool
+	// SampleRate is the rate the link's clicks are recorded as events at.
+	SampleRate int
+	// ClickTracking is false with DISABLE_CLICK_TRACKING, when click
+	// figures aren't shown.
+	ClickTracking bool
+	// Canonical is the link an alias stands for, nil for other links.
+	Canonical *database.URL
+	Aliases   []database.URL
+	// TotalClicks includes the aliases' clicks.
+	TotalClicks int
+	Events      []database.ClickEvent
+	Since       string
+	// TZ is the tz parameter as given; Zone the name of the zone times are
+	// shown in.
+	TZ          string
+	Zone        string
+	Page        int
+	PrevPage    int
+	NextPage    int
+	Error       string
+}
+
+// clickEventsPageSize is the number of click events per stats page.
+const clickEventsPageSize = 50
+
+// sinceDateLayout is the format of the stats page's "since" filter, as sent
+// by a date input.
+const sinceDateLayout = "2006-01-02"
+
+// statsLocation returns the time zone named by the tz query parameter of a
+// stats request (an IANA name such as Europe/London), or UTC when it's not
+// given. Dates in the request and the times and daily buckets in the
+// response are in that zone.
+func statsLocation(r *http.Request) (*time.Location, error) {
+	name := r.URL.Query().Get("tz")
+	if name == "" {
+		return time.UTC, nil
+	}
+	// LoadLocation also accepts "Local", the server's own zone, which
+	// isn't meaningful to clients.
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "Local" {
+		return nil, fmt.Errorf("Unknown time zone %q, use an IANA name such as Europe/London", name)
+	}
+	return loc, nil
+}
+
+type AuditData struct {
+	Title    string
+	Entries  []database.AuditEntry
+	Username string
 }
 
 type LoginData struct {
 	Title   string
 	Error   string
 	Message string
+	Next    string
+	// TwoFactor shows the code step instead of the password form.
+	TwoFactor bool
 }
 
+// Login input limits. bcrypt only uses the first 72 bytes of a password.
+const (
+	maxLoginBodyBytes = 4096
+	maxUsernameLength = auth.MaxUsernameLength
+	maxPasswordLength = 72
+)
+
 var db *database.DB
 
+// caseInsensitiveHashes makes /Abc and /abc resolve to the same link. Off by
+// default because the hash alphabet is case-sensitive.
+var caseInsensitiveHashes bool
+
+// urlCache holds recently redirected links to spare the database on popular
+// links. Entries must be invalidated whenever a link changes.
+var urlCache *cache.TTL[string, *database.URL]
+
+// featureFlags are the optional features enabled on this deployment.
+var featureFlags features.Flags
+
+// qrRevalidate makes browsers revalidate QR images on every view instead of
+// caching them for an hour, so QR view counts aren't undercounted.
+var qrRevalidate bool
+
+// autoPrependScheme adds https:// to destinations entered without http:// or
+// https://. When disabled, destinations must include a scheme.
+var autoPrependScheme bool
+
+// allowedSchemes lists the non-HTTP destination schemes accepted, from
+// ALLOWED_SCHEMES. When empty, AUTO_PREPEND_SCHEME=false accepts any scheme.
+var allowedSchemes []string
+
+// maxLinksPerUser caps how many links each user can create. Zero means
+// unlimited.
+var maxLinksPerUser int
+
+// qrCompression is the PNG compression level for generated QR images.
+var qrCompression = png.BestCompression
+
+// qrDefaultFormat and qrDefaultSize are used for QR images requested without
+// format or size parameters.
+var (
+	qrDefaultFormat = qrgen.FormatPNG
+	qrDefaultSize   = qrgen.DefaultOptions().Size
+)
+
+// fallbackURL, when set, receives visitors of unknown short links instead
+// of a 404.
+var fallbackURL string
+
 func main() {
 	// Load environment variables from .env file if it exists
 	if err := godotenv.Load(); err != nil {
@@ -54,32 +205,252 @@ func main() {
 	}
 	port := getEnv("PORT", "8080")
 	baseURL := getEnv("BASE_URL", "http://localhost:8080")
+	caseInsensitiveHashes = getEnv("HASH_CASE_INSENSITIVE", "false") == "true"
+	maintenanceEnabled.Store(getEnv("MAINTENANCE_MODE", "false") == "true")
+	maintenanceFile = getEnv("MAINTENANCE_FILE", "")
+	maintenanceKeepRedirects = getEnv("MAINTENANCE_KEEP_REDIRECTS", "false") == "true"
+	fallbackURL = getEnv("FALLBACK_URL", "")
+	qrRevalidate = getEnv("QR_REVALIDATE", "false") == "true"
+	autoPrependScheme = getEnv("AUTO_PREPEND_SCHEME", "true") == "true"
+	contentSecurityPolicy = getEnv("CONTENT_SECURITY_POLICY", defaultContentSecurityPolicy)
+	if contentSecurityPolicy == "off" {
+		contentSecurityPolicy = ""
+	}
+	referrerPolicy = getEnv("REFERRER_POLICY", referrerPolicy)
+
+	cacheTTL, err := time.ParseDuration(getEnv("REDIRECT_CACHE_TTL", "30s"))
+	if err != nil {
+		log.Fatal("Invalid REDIRECT_CACHE_TTL:", err)
+	}
+	cacheSize, err := strconv.Atoi(getEnv("REDIRECT_CACHE_SIZE", "1000"))
+	if err != nil {
+		log.Fatal("Invalid REDIRECT_CACHE_SIZE:", err)
+	}
+	urlCache = cache.New[string, *database.URL](cacheTTL, cacheSize)
+
+	if qrImageCacheSize, err = strconv.Atoi(getEnv("QR_CACHE_SIZE", strconv.Itoa(qrImageCacheSize))); err != nil || qrImageCacheSize < 0 {
+		log.Fatal("Invalid QR_CACHE_SIZE:", getEnv("QR_CACHE_SIZE", ""))
+	}
+	qrImageCache = cache.New[string, []byte](qrImageCacheTTL, qrImageCacheSize)
+	qrCacheVersion.Store(time.Now().Unix())
+
+	if featureFlags, err = features.Load(os.Getenv); err != nil {
+		log.Fatal("Invalid feature flag:", err)
+	}
+
+	if qrCompression, err = qrgen.ParseCompression(getEnv("QR_PNG_COMPRESSION", "best")); err != nil {
+		log.Fatal("Invalid QR_PNG_COMPRESSION:", err)
+	}
+	if qrDefaultFormat, err = qrgen.ParseFormat(getEnv("QR_DEFAULT_FORMAT", "png")); err != nil {
+		log.Fatal("Invalid QR_DEFAULT_FORMAT:", err)
+	}
+	if qrDefaultSize, err = strconv.Atoi(getEnv("QR_DEFAULT_SIZE", strconv.Itoa(qrDefaultSize))); err != nil {
+		log.Fatal("Invalid QR_DEFAULT_SIZE:", err)
+	}
+	if err := qrgen.ValidateSize(qrDefaultSize); err != nil {
+		log.Fatal("Invalid QR_DEFAULT_SIZE:", err)
+	}
+
+	if vanityDomains, err = parseVanityDomains(getEnv("VANITY_DOMAINS", "")); err != nil {
+		log.Fatal("Invalid VANITY_DOMAINS:", err)
+	}
+	if tlsDomains, err = parseVanityDomains(getEnv("TLS_DOMAIN", "")); err != nil {
+		log.Fatal("Invalid TLS_DOMAIN:", err)
+	}
+	if allowedSchemes, err = utils.ParseSchemes(getEnv("ALLOWED_SCHEMES", "")); err != nil {
+		log.Fatal("Invalid ALLOWED_SCHEMES:", err)
+	}
+	tlsCacheDir = getEnv("TLS_CACHE_DIR", "certs")
+
+	if scanRepeatWindow, err = time.ParseDuration(getEnv("SCAN_REPEAT_WINDOW", scanRepeatWindow.String())); err != nil || scanRepeatWindow <= 0 {
+		log.Fatal("Invalid SCAN_REPEAT_WINDOW:", getEnv("SCAN_REPEAT_WINDOW", ""))
+	}
+	if forwardQueryPrecedence, err = parseForwardQueryPrecedence(getEnv("FORWARD_QUERY_PRECEDENCE", forwardQueryPrecedence)); err != nil {
+		log.Fatal("Invalid FORWARD_QUERY_PRECEDENCE:", err)
+	}
+
+	if maxLinksPerUser, err = strconv.Atoi(getEnv("MAX_LINKS_PER_USER", "0")); err != nil || maxLinksPerUser < 0 {
+		log.Fatal("Invalid MAX_LINKS_PER_USER:", getEnv("MAX_LINKS_PER_USER", ""))
+	}
+
+	checksumHashes = getEnv("CHECKSUM_HASHES", "false") == "true"
+	trustProxy = getEnv("TRUST_PROXY", "false") == "true"
+	allowIndexing = getEnv("ALLOW_INDEXING", "false") == "true"
+	if publicShortenLimit, err = strconv.Atoi(getEnv("PUBLIC_SHORTEN_LIMIT", strconv.Itoa(publicShortenLimit))); err != nil || publicShortenLimit < 1 {
+		log.Fatal("Invalid PUBLIC_SHORTEN_LIMIT:", getEnv("PUBLIC_SHORTEN_LIMIT", ""))
+	}
+	if provider := getEnv("CAPTCHA_PROVIDER", ""); provider != "" {
+		if captchaVerifier, err = captcha.New(provider, getEnv("CAPTCHA_SITE_KEY", ""), getEnv("CAPTCHA_SECRET", "")); err != nil {
+			log.Fatal("Invalid captcha configuration:", err)
+		}
+		if contentSecurityPolicy == defaultContentSecurityPolicy {
+			contentSecurityPolicy = captchaContentSecurityPolicy(captchaVerifier)
+		}
+	}
+	if featureFlags.PublicShorten && captchaVerifier == nil {
+		log.Println("Warning: PUBLIC_SHORTEN is on without CAPTCHA_PROVIDER, anonymous links are only rate limited")
+	}
+
+	if clickRetentionDays, err = strconv.Atoi(getEnv("CLICK_RETENTION_DAYS", "0")); err != nil || clickRetentionDays < 0 {
+		log.Fatal("Invalid CLICK_RETENTION_DAYS:", getEnv("CLICK_RETENTION_DAYS", ""))
+	}
+	if clickSampleRate, err = parseClickSampleRate(getEnv("CLICK_SAMPLE_RATE", "1")); err != nil {
+		log.Fatal("Invalid CLICK_SAMPLE_RATE:", err)
+	}
+	clickTracking = getEnv("DISABLE_CLICK_TRACKING", "false") != "true"
+
+	excludedUserAgents = parseUserAgentList(getEnv("EXCLUDE_CLICK_USER_AGENTS", ""))
+	if excludedNetworks, err = parseNetworks(getEnv("EXCLUDE_CLICK_IPS", "")); err != nil {
+		log.Fatal("Invalid EXCLUDE_CLICK_IPS:", err)
+	}
+	debugLogging = getEnv("DEBUG", "false") == "true"
+	redactLoggedURLs = getEnv("REDACT_LOGGED_URLS", "false") == "true"
+
+	if maxBodyBytes, err = strconv.ParseInt(getEnv("MAX_BODY_BYTES", strconv.FormatInt(maxBodyBytes, 10)), 10, 64); err != nil {
+		log.Fatal("Invalid MAX_BODY_BYTES:", err)
+	}
+	if maxUploadBodyBytes, err = strconv.ParseInt(getEnv("MAX_UPLOAD_BODY_BYTES", strconv.FormatInt(maxUploadBodyBytes, 10)), 10, 64); err != nil {
+		log.Fatal("Invalid MAX_UPLOAD_BODY_BYTES:", err)
+	}
 
-	var err error
 	db, err = database.NewDB(dbPath)
 	if err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
 	defer db.Close()
 
+	if err := bootstrapAdmin(); err != nil {
+		log.Fatal("Failed to create initial admin user:", err)
+	}
+
+	if err := counters.reconcile(); err != nil {
+		log.Printf("Error loading link counters: %v", err)
+	}
+	if checksumHashes {
+		if err := uncheckedHashes.load(); err != nil {
+			log.Printf("Error loading unchecked hashes: %v", err)
+		}
+	}
+
+	if err := auth.InitSessionStore(); err != nil {
+		log.Fatal("Failed to initialize session store:", err)
+	}
+	defer auth.CloseSessionStore()
+	auth.SetSessionVersionLookup(db.GetSessionVersion)
+
 	// Store base URL globally for use in handlers
 	os.Setenv("_INTERNAL_BASE_URL", baseURL)
 
 	// Public routes
+	http.HandleFunc("/healthz", healthzHandler)
+	http.HandleFunc("/robots.txt", robotsHandler)
 	http.HandleFunc("/login", loginHandler)
+	http.HandleFunc("/login/2fa", loginTwoFactorHandler)
+	http.HandleFunc("/setup", setupHandler)
 	http.HandleFunc("/logout", logoutHandler)
 	http.Handle("/static/", http.FileServer(http.FS(staticFS)))
+	http.HandleFunc("/s/", scanHandler)
 	http.HandleFunc("/qr/", qrCodeHandler)
+	http.HandleFunc("/beacon/", beaconHandler)
+	http.HandleFunc("/preview/", previewPageHandler)
+	http.HandleFunc("/edit/", editPageHandler)
+	http.HandleFunc("/api/v1/urls/", apiURLsHandler)
+	http.HandleFunc("/api/v1/openapi.json", openAPIHandler)
+	http.HandleFunc("/api/v1/features", featuresHandler)
 	http.HandleFunc("/", publicRouteHandler)
+	if featureFlags.PublicShorten {
+		http.HandleFunc("/new", publicShortenPageHandler)
+	}
 
 	// Protected routes
-	http.HandleFunc("/shorten", auth.RequireAuth(shortenHandler))
+	http.HandleFunc("/admin", auth.RequireAuth(homeHandler))
+	http.HandleFunc("/shorten", shortenAccess(shortenHandler))
+	http.HandleFunc("/api/v1/shorten", shortenAccess(shortenHandler))
 	http.HandleFunc("/update", auth.RequireAuth(updateHandler))
+	http.HandleFunc("/audit", auth.RequireAuth(requireUnrestricted(auditHandler)))
+	http.HandleFunc("/export/json", auth.RequireAuth(exportJSONHandler))
+	http.HandleFunc("/import/json", auth.RequireAuth(importJSONHandler))
+	http.HandleFunc("/campaigns", auth.RequireAuth(campaignsHandler))
+	http.HandleFunc("/campaigns/", auth.RequireAuth(campaignsHandler))
+	http.HandleFunc("/stats/", auth.RequireAuth(statsHandler))
+	http.HandleFunc("/account/logout-all", auth.RequireAuth(logoutAllHandler))
+	http.HandleFunc("/account/2fa", auth.RequireAuth(twoFactorHandler))
+	http.HandleFunc("/admin/dashboard", auth.RequireAuth(requireUnrestricted(adminDashboardHandler)))
+	http.HandleFunc("/admin/maintenance", auth.RequireAuth(requireUnrestricted(maintenanceToggleHandler)))
+	http.HandleFunc("/admin/qr-cache", auth.RequireAuth(requireUnrestricted(qrCacheHandler)))
+	http.HandleFunc("/admin/users/", auth.RequireAuth(requireUnrestricted(adminUserLogoutHandler)))
+	http.HandleFunc("/api/v1/qr/batch", auth.RequireAuth(qrBatchHandler))
+	http.HandleFunc("/api/v1/qr/batch/pdf", auth.RequireAuth(qrBatchPDFHandler))
+	http.HandleFunc("/api/v1/qr/batch/stream", auth.RequireAuth(qrBatchStreamHandler))
+	http.HandleFunc("/api/v1/qr/batch/download/", auth.RequireAuth(qrBatchDownloadHandler))
+	http.HandleFunc("/api/v1/qr/", auth.RequireAuth(qrPayloadHandler))
+	http.HandleFunc("/api/v1/available", auth.RequireAuth(hashAvailableHandler))
+	http.HandleFunc("/api/v1/urls/bulk-update", auth.RequireAuth(bulkUpdateHandler))
+	http.HandleFunc("/api/v1/urls/bulk-titles", auth.RequireAuth(bulkTitlesHandler))
+	http.HandleFunc("/api/v1/urls/bulk-delete", auth.RequireAuth(bulkDeleteHandler))
+	http.HandleFunc("/reports/stale", auth.RequireAuth(staleHandler))
+	http.HandleFunc("/api/v1/dashboard", auth.RequireAuth(dashboardHandler))
+	http.HandleFunc("/api/v1/metrics", auth.RequireAuth(metricsHandler))
+	http.HandleFunc("/api/v1/preview-meta", auth.RequireAuth(previewMetaHandler))
+
+	// Cancelled on SIGINT/SIGTERM to stop background jobs and drain
+	// in-flight requests before exiting.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if clickRetentionDays > 0 {
+		go runClickPruner(ctx)
+	}
+	go runCountersReconciler(ctx)
+
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: securityHeadersMiddleware(gzipMiddleware(bodyLimitMiddleware(maintenanceMiddleware(http.DefaultServeMux)))),
+	}
+
+	// With TLS_DOMAIN set, serve HTTPS on 443 with Let's Encrypt
+	// certificates and redirect port 80 to it.
+	var redirectServer *http.Server
+	if len(tlsDomains) > 0 {
+		certManager := newCertManager()
+		server.Addr = ":https"
+		server.TLSConfig = certManager.TLSConfig()
+		redirectServer = newRedirectServer(certManager)
+		go func() {
+			if err := redirectServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+	}
 
-	log.Printf("Server starting on %s (port %s)", baseURL, port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		log.Println("Shutting down...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if redirectServer != nil {
+			if err := redirectServer.Shutdown(shutdownCtx); err != nil {
+				log.Printf("Error shutting down redirect server: %v", err)
+			}
+		}
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Error shutting down server: %v", err)
+		}
+	}()
+
+	if redirectServer != nil {
+		log.Printf("Server starting on %s (HTTPS for %s, certificates in %s)", baseURL, strings.Join(tlsDomains, ", "), tlsCacheDir)
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		log.Printf("Server starting on %s (port %s)", baseURL, port)
+		err = server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal(err)
 	}
+	<-shutdownDone
 }
 
 func getEnv(key, defaultValue string) string {
@@ -89,21 +460,55 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// debugLogging enables debugf output (DEBUG).
+var debugLogging bool
+
+// debugf logs a message only when DEBUG is on.
+func debugf(format string, args ...any) {
+	if debugLogging {
+		log.Printf(format, args...)
+	}
+}
+
+// redactLoggedURLs cuts destination and referrer URLs down to scheme, host
+// and path in logs, the audit log and stored click events
+// (REDACT_LOGGED_URLS), since query strings can hold tokens or personal data.
+var redactLoggedURLs bool
+
+// loggedURL returns raw as it should be logged or stored.
+func loggedURL(raw string) string {
+	if redactLoggedURLs {
+		return utils.RedactURL(raw)
+	}
+	return raw
+}
+
+// loggedError redacts the URL in a failed request's error, as loggedURL
+// does, before it's logged.
+func loggedError(err error) error {
+	var urlErr *url.Error
+	if redactLoggedURLs && errors.As(err, &urlErr) {
+		urlErr.URL = utils.RedactURL(urlErr.URL)
+	}
+	return err
+}
+
 func publicRouteHandler(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Path
 	
 	if path == "/" {
-		// Homepage requires authentication
-		if !auth.IsAuthenticated(r) {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+		if featureFlags.PublicHome {
+			landingHandler(w, r)
 			return
 		}
-		homeHandler(w, r)
+
+		// Homepage requires authentication
+		auth.RequireAuth(homeHandler)(w, r)
 		return
 	}
 	
-	// Short URL redirects are public
-	shortHash := strings.TrimPrefix(path, "/")
+	// Short URL redirects are public. A single trailing slash is ignored.
+	shortHash := utils.HashFromPath(path)
 	if shortHash != "" {
 		redirectHandler(w, r, shortHash)
 		return
@@ -112,6 +517,26 @@ func publicRouteHandler(w http.ResponseWriter, r *http.Request) {
 	http.NotFound(w, r)
 }
 
+// landingHandler serves the public splash page used when PUBLIC_HOME is set.
+func landingHandler(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := template.ParseFS(templatesFS, "templates/landing.html")
+	if err != nil {
+		http.Error(w, "Error loading template", http.StatusInternalServerError)
+		log.Printf("Template error: %v", err)
+		return
+	}
+
+	data := LandingData{
+		Title:         "QR Linker",
+		Authenticated: auth.IsAuthenticated(r),
+		PublicShorten: featureFlags.PublicShorten,
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Render error: %v", err)
+	}
+}
+
 func homeHandler(w http.ResponseWriter, r *http.Request) {
 	// Set cache-control headers to prevent caching of dynamic content
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
@@ -125,25 +550,58 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	urls, err := db.GetAllURLs()
+	health := r.URL.Query().Get("health")
+	var urls []database.URLWithCreator
+	switch health {
+	case "":
+		urls, err = db.GetAllURLsWithCreator()
+	case database.HealthOK, database.HealthBroken, database.HealthUnchecked:
+		urls, err = db.GetURLsByHealth(health)
+	default:
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "health must be ok, broken or unchecked")
+		return
+	}
 	if err != nil {
 		log.Printf("Error fetching URLs: %v", err)
-		urls = []database.URL{}
+		urls = []database.URLWithCreator{}
+	}
+
+	campaigns, err := db.GetCampaigns()
+	if err != nil {
+		log.Printf("Error fetching campaigns: %v", err)
 	}
 
 	// Get username from session
 	_, username, _ := auth.GetUserFromSession(r)
 
+	prefix, err := userHashPrefix(r)
+	if err != nil {
+		log.Printf("Error looking up hash prefix: %v", err)
+	}
+
+	totalLinks, totalClicks := counters.totals()
+
 	data := PageData{
-		Title:    "QR Linker - URL Shortener",
-		URLs:     urls,
-		Host:     os.Getenv("_INTERNAL_BASE_URL"),
-		Username: username,
+		Title:         "QR Linker - URL Shortener",
+		URLs:          urls,
+		Campaigns:     campaigns,
+		Domains:       vanityDomains,
+		TotalLinks:    totalLinks,
+		TotalClicks:   totalClicks,
+		Host:          os.Getenv("_INTERNAL_BASE_URL"),
+		Username:      username,
+		Health:        health,
+		ClickTracking: clickTracking,
+		Unrestricted:  err == nil && prefix == "",
 	}
 
 	// Check for success parameter
 	if success := r.URL.Query().Get("success"); success != "" {
-		data.ShortURL = "/" + success
+		data.ShortHash = success
+		data.ShortURL = data.Host + "/" + success
+		if url, err := lookupURL(success); err == nil {
+			data.ShortURL = shortURLFor(url)
+		}
 	}
 
 	// Check for error parameter
@@ -158,9 +616,17 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 
 func loginHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
+		next := r.URL.Query().Get("next")
+
 		// Check if already authenticated
 		if auth.IsAuthenticated(r) {
-			http.Redirect(w, r, "/", http.StatusSeeOther)
+			http.Redirect(w, r, loginRedirectTarget(next), http.StatusSeeOther)
+			return
+		}
+
+		// Nobody can log in on a fresh install, so offer setup instead.
+		if count, err := db.CountUsers(); err == nil && count == 0 {
+			http.Redirect(w, r, "/setup", http.StatusSeeOther)
 			return
 		}
 
@@ -173,15 +639,23 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		data := LoginData{
 			Title: "Login - QR Linker",
 		}
+		if target := loginRedirectTarget(next); target != managementHome() {
+			data.Next = target
+		}
 
 		tmpl.Execute(w, data)
 		return
 	}
 
 	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxLoginBodyBytes)
 		err := r.ParseForm()
 		if err != nil {
-			renderLoginError(w, "Invalid form data")
+			if isBodyTooLarge(err) {
+				renderLoginError(w, r, http.StatusRequestEntityTooLarge, "Login request is too large")
+			} else {
+				renderLoginError(w, r, http.StatusBadRequest, "Invalid form data")
+			}
 			return
 		}
 
@@ -189,7 +663,12 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		password := r.FormValue("password")
 
 		if username == "" || password == "" {
-			renderLoginError(w, "Username and password are required")
+			renderLoginError(w, r, http.StatusBadRequest, "Username and password are required")
+			return
+		}
+
+		if len(username) > maxUsernameLength || len(password) > maxPasswordLength {
+			renderLoginError(w, r, http.StatusBadRequest, "Username or password is too long")
 			return
 		}
 
@@ -197,30 +676,42 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		user, err := db.GetUserByUsername(username)
 		if err != nil {
 			if err == sql.ErrNoRows {
-				renderLoginError(w, "Invalid username or password")
+				renderLoginError(w, r, http.StatusUnauthorized, "Invalid username or password")
 			} else {
 				log.Printf("Database error: %v", err)
-				renderLoginError(w, "An error occurred. Please try again.")
+				renderLoginError(w, r, http.StatusInternalServerError, "An error occurred. Please try again.")
 			}
 			return
 		}
 
 		// Check password
 		if !auth.CheckPasswordHash(password, user.PasswordHash) {
-			renderLoginError(w, "Invalid username or password")
+			renderLoginError(w, r, http.StatusUnauthorized, "Invalid username or password")
+			return
+		}
+
+		// Users with two-factor authentication enabled still need to
+		// enter a code before the session is authenticated.
+		if user.TOTPSecret != "" {
+			if err := auth.SetPendingLogin(w, r, user.ID); err != nil {
+				log.Printf("Session error: %v", err)
+				renderLoginError(w, r, http.StatusInternalServerError, "Failed to create session")
+				return
+			}
+			renderTwoFactorPrompt(w, r, http.StatusOK, "")
 			return
 		}
 
 		// Set session
-		err = auth.SetUserSession(w, r, user.ID, user.Username)
+		err = auth.SetUserSession(w, r, user.ID, user.Username, user.SessionVersion)
 		if err != nil {
 			log.Printf("Session error: %v", err)
-			renderLoginError(w, "Failed to create session")
+			renderLoginError(w, r, http.StatusInternalServerError, "Failed to create session")
 			return
 		}
 
-		// Redirect to home
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		// Redirect to the requested page, or home
+		http.Redirect(w, r, loginRedirectTarget(r.FormValue("next")), http.StatusSeeOther)
 		return
 	}
 
@@ -236,7 +727,80 @@ func logoutHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/login", http.StatusSeeOther)
 }
 
-func renderLoginError(w http.ResponseWriter, errorMsg string) {
+// logoutAllHandler invalidates every session belonging to the current user,
+// including the one making the request.
+func logoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, username, ok := auth.GetUserFromSession(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := db.BumpSessionVersion(userID); err != nil {
+		log.Printf("Error invalidating sessions: %v", err)
+		http.Error(w, "Failed to log out other sessions", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, database.AuditSessionsRevoked, username)
+
+	if err := auth.ClearSession(w, r); err != nil {
+		log.Printf("Error clearing session: %v", err)
+	}
+
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// adminUserLogoutHandler serves POST /admin/users/{id}/logout, which
+// invalidates every session of another user, e.g. a compromised account.
+// Their sessions end on their next request.
+func adminUserLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/admin/users/")
+	idPart, action, _ := strings.Cut(rest, "/")
+	id, err := strconv.Atoi(idPart)
+	if err != nil || id <= 0 || action != "logout" {
+		respondError(w, r, http.StatusNotFound, errCodeNotFound, "Not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	user, err := db.GetUserByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondError(w, r, http.StatusNotFound, errCodeNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up user %d: %v", id, err)
+		respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to look up user")
+		return
+	}
+
+	if err := db.BumpSessionVersion(user.ID); err != nil {
+		log.Printf("Error invalidating sessions of %s: %v", user.Username, err)
+		respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to log out user")
+		return
+	}
+
+	recordAudit(r, database.AuditSessionsRevoked, user.Username)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]any{
+		"user_id":          user.ID,
+		"username":         user.Username,
+		"sessions_revoked": true,
+	})
+}
+
+func renderLoginError(w http.ResponseWriter, r *http.Request, status int, errorMsg string) {
 	tmpl, err := template.ParseFS(templatesFS, "templates/login.html")
 	if err != nil {
 		http.Error(w, "Error loading template", http.StatusInternalServerError)
@@ -247,150 +811,1154 @@ func renderLoginError(w http.ResponseWriter, errorMsg string) {
 		Title: "Login - QR Linker",
 		Error: errorMsg,
 	}
+	if target := loginRedirectTarget(r.FormValue("next")); target != managementHome() {
+		data.Next = target
+	}
 
+	w.WriteHeader(status)
 	tmpl.Execute(w, data)
 }
 
+// loginRedirectTarget returns next if it is a local path, otherwise the
+// management home page.
+func loginRedirectTarget(next string) string {
+	if target, ok := utils.SafeRedirectPath(next); ok {
+		return target
+	}
+	return managementHome()
+}
+
+// managementHome is the path of the link management page: "/" by default,
+// or "/admin" when PUBLIC_HOME serves a public landing page at the root.
+func managementHome() string {
+	if featureFlags.PublicHome {
+		return "/admin"
+	}
+	return "/"
+}
+
+// redirectHome sends the user back to the management page with the given
+// query string, following the POST-Redirect-GET pattern.
+func redirectHome(w http.ResponseWriter, r *http.Request, query string) {
+	http.Redirect(w, r, managementHome()+"?"+query, http.StatusSeeOther)
+}
+
 func shortenHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	err := r.ParseForm()
 	if err != nil {
-		http.Redirect(w, r, "/?error=Invalid+form+data", http.StatusSeeOther)
+		if isBodyTooLarge(err) {
+			respondError(w, r, http.StatusRequestEntityTooLarge, errCodeBodyTooLarge, "Request body too large")
+			return
+		}
+		shortenError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid form data")
+		return
+	}
+
+	fullURL, err := utils.NormalizeURL(r.FormValue("url"), autoPrependScheme, allowedSchemes...)
+	if err != nil {
+		shortenError(w, r, http.StatusBadRequest, errCodeInvalidURL, err.Error())
 		return
 	}
 
-	fullURL := r.FormValue("url")
-	if fullURL == "" {
-		http.Redirect(w, r, "/?error=URL+is+required", http.StatusSeeOther)
+	// Anonymous links, with PUBLIC_SHORTEN, are plain web links on the
+	// default host.
+	anonymous := !auth.IsAuthenticated(r)
+	if anonymous && !utils.IsHTTPURL(fullURL) {
+		shortenError(w, r, http.StatusBadRequest, errCodeInvalidURL, "Only http and https links can be created without logging in")
+		return
+	}
+	if anonymous && (r.FormValue("prefix") != "" || r.FormValue("campaign") != "" || r.FormValue("domain") != "") {
+		shortenError(w, r, http.StatusForbidden, errCodeInvalidRequest, "Log in to use prefixes, campaigns or domains")
 		return
 	}
 
-	if !strings.HasPrefix(fullURL, "http://") && !strings.HasPrefix(fullURL, "https://") {
-		fullURL = "https://" + fullURL
+	title := linkTitle(r.FormValue("title"), fullURL)
+
+	userID, _, _ := auth.GetUserFromSession(r)
+
+	if maxLinksPerUser > 0 {
+		count, err := db.CountURLsByUser(userID)
+		if err != nil {
+			log.Printf("Error counting links for user %d: %v", userID, err)
+			shortenError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to save URL")
+			return
+		}
+		if count >= maxLinksPerUser {
+			shortenError(w, r, http.StatusForbidden, errCodeLimitReached, fmt.Sprintf("Link limit reached: each account can create at most %d links", maxLinksPerUser))
+			return
+		}
 	}
 
-	shortHash, err := utils.GenerateUniqueHash(db.CheckHashExists)
+	campaignID, err := parseCampaignID(r.FormValue("campaign"))
 	if err != nil {
-		log.Printf("Error generating hash: %v", err)
-		http.Redirect(w, r, "/?error=Failed+to+generate+short+URL", http.StatusSeeOther)
+		shortenError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
 		return
 	}
 
-	_, err = db.CreateURL(fullURL, shortHash)
+	domain, err := parseLinkDomain(r.FormValue("domain"))
 	if err != nil {
-		log.Printf("Error saving URL: %v", err)
-		http.Redirect(w, r, "/?error=Failed+to+save+URL", http.StatusSeeOther)
+		shortenError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
 		return
 	}
 
-	http.Redirect(w, r, "/?success="+shortHash, http.StatusSeeOther)
-}
+	// respond=qr answers with the new link's QR code instead, so kiosk and
+	// print integrations need a single request. The QR options are checked
+	// up front so a bad option doesn't leave a link behind.
+	respond := r.URL.Query().Get("respond")
+	if respond != "" && respond != "qr" {
+		shortenError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid respond value (use qr)")
+		return
+	}
+	var qrOpts qrgen.Options
+	if respond == "qr" {
+		if qrOpts, err = parseQROptions(r); err != nil {
+			shortenError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
+			return
+		}
+	}
 
-func redirectHandler(w http.ResponseWriter, r *http.Request, shortHash string) {
-	// Set cache-control headers to prevent any caching of the redirect
-	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate, max-age=0")
-	w.Header().Set("Pragma", "no-cache")
-	w.Header().Set("Expires", "Thu, 01 Jan 1970 00:00:00 GMT")
-	
-	url, err := db.GetURLByHash(shortHash)
+	prefix, err := utils.ValidateHashPrefix(r.FormValue("prefix"))
 	if err != nil {
-		http.NotFound(w, r)
+		shortenError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
 		return
 	}
-
-	err = db.IncrementClicks(shortHash)
+	// Users limited to a prefix get theirs when they don't ask for one.
+	userPrefix, err := userHashPrefix(r)
 	if err != nil {
-		log.Printf("Error incrementing clicks: %v", err)
+		log.Printf("Error looking up hash prefix of user %d: %v", userID, err)
+		shortenError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to save URL")
+		return
 	}
-
-	http.Redirect(w, r, url.FullURL, http.StatusFound)
-}
-
-func qrCodeHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract the short hash from the URL path
-	shortHash := strings.TrimPrefix(r.URL.Path, "/qr/")
-	if shortHash == "" {
-		http.NotFound(w, r)
+	if userPrefix != "" && prefix != "" && prefix != userPrefix {
+		shortenError(w, r, http.StatusForbidden, errCodeInvalidRequest, fmt.Sprintf("Your links must use the prefix %s", userPrefix))
 		return
 	}
+	if userPrefix != "" {
+		prefix = userPrefix
+	}
+	if prefix != "" {
+		prefix += utils.PrefixSeparator
+	}
 
-	// Check if the short URL exists in the database
-	_, err := db.GetURLByHash(shortHash)
+	shortHash, err := generateHash(prefix)
 	if err != nil {
-		http.NotFound(w, r)
+		log.Printf("Error generating hash: %v", err)
+		shortenError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to generate short URL")
 		return
 	}
 
-	// Generate the full short URL
-	baseURL := os.Getenv("_INTERNAL_BASE_URL")
-	shortURL := baseURL + "/" + shortHash
-
-	// Generate QR code
-	qrCode, err := qrcode.New(shortURL, qrcode.Medium)
+	link, err := db.CreateURL(fullURL, shortHash, title, userID)
 	if err != nil {
-		http.Error(w, "Error generating QR code", http.StatusInternalServerError)
+		log.Printf("Error saving URL: %v", err)
+		shortenError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to save URL")
 		return
 	}
+	counters.addLink()
 
-	// Set response headers
-	w.Header().Set("Content-Type", "image/png")
-	w.Header().Set("Cache-Control", "public, max-age=3600") // Cache for 1 hour
+	if campaignID != 0 {
+		if err := db.AssignURLToCampaign(shortHash, campaignID); err != nil {
+			log.Printf("Error assigning %s to campaign %d: %v", shortHash, campaignID, err)
+		} else {
+			link.CampaignID = campaignID
+		}
+	}
 
-	// Write QR code as PNG
-	png, err := qrCode.PNG(256)
-	if err != nil {
-		http.Error(w, "Error generating QR code image", http.StatusInternalServerError)
-		return
+	if domain != "" {
+		if err := db.SetURLDomain(shortHash, domain); err != nil {
+			log.Printf("Error setting domain of %s to %s: %v", shortHash, domain, err)
+		} else {
+			link.Domain = domain
+		}
 	}
 
-	w.Write(png)
-}
+	if respond == "qr" {
+		png, err := qrgen.PNG(qrContentFor(link), qrOpts)
+		if err != nil {
+			respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Link created but generating its QR code failed")
+			return
+		}
 
-func updateHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("X-Short-Hash", link.ShortHash)
+		w.Header().Set("X-Short-URL", shortURLFor(link))
+		w.WriteHeader(http.StatusCreated)
+		w.Write(png)
 		return
 	}
 
-	err := r.ParseForm()
-	if err != nil {
-		http.Error(w, "Invalid form data", http.StatusBadRequest)
+	if isAPIRequest(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{
+			"short_url": shortURLFor(link),
+			"url":       link,
+		})
 		return
 	}
 
-	shortHash := r.FormValue("short_hash")
-	newURL := r.FormValue("new_url")
-
-	if shortHash == "" || newURL == "" {
-		http.Error(w, "Short hash and new URL are required", http.StatusBadRequest)
+	if anonymous {
+		http.Redirect(w, r, "/new?created="+url.QueryEscape(shortHash), http.StatusSeeOther)
 		return
 	}
+	redirectHome(w, r, "success="+shortHash)
+}
 
-	// Add protocol if missing
-	if !strings.HasPrefix(newURL, "http://") && !strings.HasPrefix(newURL, "https://") {
-		newURL = "https://" + newURL
-	}
-
-	// Check if URL exists
-	_, err = db.GetURLByHash(shortHash)
-	if err != nil {
-		http.Error(w, "URL not found", http.StatusNotFound)
+// shortenError reports a failed shorten request. The management UI's form
+// shows the message above the form, so browsers are sent back home with it,
+// or to /new when not logged in; API clients get a structured error.
+func shortenError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if isAPIRequest(r) {
+		respondError(w, r, status, code, message)
 		return
 	}
-
-	// Update the URL
-	err = db.UpdateURL(shortHash, newURL)
-	if err != nil {
-		log.Printf("Error updating URL: %v", err)
-		http.Error(w, "Failed to update URL", http.StatusInternalServerError)
+	if !auth.IsAuthenticated(r) {
+		http.Redirect(w, r, "/new?error="+url.QueryEscape(message), http.StatusSeeOther)
 		return
 	}
+	redirectHome(w, r, "error="+url.QueryEscape(message))
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"success": true}`))
+func redirectHandler(w http.ResponseWriter, r *http.Request, shortHash string) {
+	// Set cache-control headers to prevent any caching of the redirect
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate, max-age=0")
+	w.Header().Set("Pragma", "no-cache")
+	w.Header().Set("Expires", "Thu, 01 Jan 1970 00:00:00 GMT")
+	setNoIndex(w)
+	
+	w.Header().Set("Vary", "Accept")
+
+	// Tools asking for JSON get the link metadata instead of a redirect.
+	// This is a lookup, not a visit, so it doesn't count as a click.
+	if wantsJSON(r) {
+		url, err := lookupURL(shortHash)
+		if err == nil {
+			url, err = resolveAlias(url)
+		}
+		if err != nil || !servedOnHost(url, r) {
+			respondError(w, r, http.StatusNotFound, errCodeNotFound, "Short link not found")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(publicURLView(url, r)); err != nil {
+			log.Printf("Error encoding URL: %v", err)
+		}
+		return
+	}
+
+	url, ok := resolveLink(w, r, shortHash)
+	if !ok {
+		return
+	}
+
+	if clickTracking && !excludedClick(r) && countVisit(w, r, url) {
+		fullURL, err := db.ClickURL(url.ShortHash)
+		if err != nil {
+			log.Printf("Error incrementing clicks: %v", err)
+		} else {
+			counters.addClick()
+			// Redirect to the destination read with the increment, in
+			// case the link was edited since it was cached. Aliases
+			// take theirs from the canonical link instead.
+			if url.AliasOf == 0 && fullURL != url.FullURL {
+				current := *url
+				current.FullURL = fullURL
+				url = &current
+			}
+		}
+		if rate := sampleRateFor(url); featureFlags.Analytics && sampleClick(rate) {
+			if err := db.RecordClickEvent(url.ID, loggedURL(r.Referer()), r.UserAgent(), rate); err != nil {
+				log.Printf("Error recording click event: %v", err)
+			}
+		}
+	}
+
+	redirectToDestination(w, r, url)
+}
+
+// OpenData is passed to the page shown for non-HTTP destinations.
+type OpenData struct {
+	Title       string
+	Destination string
+	Href        template.URL
+}
+
+// redirectToDestination sends the visitor to a link's destination. Only
+// http(s) destinations are redirected to; others, such as mailto: or tel:
+// links allowed by ALLOWED_SCHEMES, get a page showing the value with a link
+// to open it, since browsers handle redirects to them inconsistently.
+func redirectToDestination(w http.ResponseWriter, r *http.Request, url *database.URL) {
+	if utils.IsHTTPURL(url.FullURL) {
+		http.Redirect(w, r, destinationFor(url, r), http.StatusFound)
+		return
+	}
+
+	tmpl, err := template.ParseFS(templatesFS, "templates/open.html")
+	if err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Error loading template", http.StatusInternalServerError)
+		return
+	}
+
+	data := OpenData{
+		Title:       url.Title,
+		Destination: url.FullURL,
+	}
+	if data.Title == "" {
+		data.Title = "Open link"
+	}
+	// Only link to values NormalizeURL still accepts, so a destination
+	// stored before script schemes were refused is shown but not linked.
+	if _, err := utils.NormalizeURL(url.FullURL, false); err == nil {
+		data.Href = template.URL(url.FullURL)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Render error: %v", err)
+	}
+}
+
+// resolveLink looks up a link for a redirect through the redirect cache,
+// resolving aliases to their canonical link's destination. If it doesn't
+// exist or isn't served on the request's host, the unknown link response is
+// written and false returned.
+func resolveLink(w http.ResponseWriter, r *http.Request, shortHash string) (*database.URL, bool) {
+	url, ok := urlCache.Get(shortHash)
+	if !ok {
+		if !hashMayExist(shortHash) {
+			unknownLinkHandler(w, r, shortHash, sql.ErrNoRows)
+			return nil, false
+		}
+		var err error
+		url, err = lookupURL(shortHash)
+		if err != nil {
+			unknownLinkHandler(w, r, shortHash, err)
+			return nil, false
+		}
+		urlCache.Set(shortHash, url)
+	}
+	url, err := resolveAlias(url)
+	if err != nil {
+		unknownLinkHandler(w, r, shortHash, err)
+		return nil, false
+	}
+	if !servedOnHost(url, r) {
+		unknownLinkHandler(w, r, shortHash, sql.ErrNoRows)
+		return nil, false
+	}
+	return url, true
+}
+
+// unknownLinkHandler responds to a short link that couldn't be resolved,
+// redirecting to FALLBACK_URL when configured and returning 404 otherwise.
+func unknownLinkHandler(w http.ResponseWriter, r *http.Request, shortHash string, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Unknown short link %q: no such hash", shortHash)
+	} else {
+		log.Printf("Unknown short link %q: lookup failed: %v", shortHash, err)
+	}
+
+	if fallbackURL != "" {
+		http.Redirect(w, r, fallbackURL, http.StatusFound)
+		return
+	}
+	respondError(w, r, http.StatusNotFound, errCodeNotFound, "This short link doesn't exist or has been removed.")
+}
+
+// lookupURL finds a link by hash, honouring HASH_CASE_INSENSITIVE.
+func lookupURL(shortHash string) (*database.URL, error) {
+	if caseInsensitiveHashes {
+		return db.GetURLByHashFold(shortHash)
+	}
+	return db.GetURLByHash(shortHash)
+}
+
+// invalidateCachedURL drops a changed link from the redirect cache. With
+// case-insensitive hashes the link may be cached under several spellings, so
+// the whole cache is cleared instead.
+func invalidateCachedURL(shortHash string) {
+	if caseInsensitiveHashes {
+		urlCache.Clear()
+		return
+	}
+	urlCache.Delete(shortHash)
+}
+
+// hashExists checks hash uniqueness the same way lookupURL resolves hashes, so
+// a new hash can never shadow an existing one that differs only by case.
+func hashExists(shortHash string) (bool, error) {
+	if caseInsensitiveHashes {
+		return db.CheckHashExistsFold(shortHash)
+	}
+	return db.CheckHashExists(shortHash)
+}
+
+// statsArePublic reports whether anonymous visitors may see a link's click
+// counts.
+func statsArePublic(url *database.URL) bool {
+	if url.PublicStats != nil {
+		return *url.PublicStats
+	}
+	return featureFlags.PublicStats
+}
+
+// privateStatsURL is a link as shown to anonymous visitors when its stats are
+// private. The nil shadowing fields hide the counters from JSON output.
+type privateStatsURL struct {
+	*database.URL
+	Clicks        *int       `json:"clicks,omitempty"`
+	QRViews       *int       `json:"qr_views,omitempty"`
+	LastClickedAt *time.Time `json:"last_clicked_at,omitempty"`
+}
+
+// publicURLView returns the link for serializing in a response, without its
+// click counts when they're private and the request isn't logged in, or when
+// click tracking is off.
+func publicURLView(url *database.URL, r *http.Request) any {
+	if statsArePublic(url) || auth.IsAuthenticated(r) {
+		return trackedURLView(url)
+	}
+	return privateStatsURL{URL: url}
+}
+
+// parseLinkOverride reads a per-link setting such as public_stats from the
+// form field name: 1 or 0 to override the default, empty to follow it.
+func parseLinkOverride(name, raw string) (*bool, error) {
+	switch raw {
+	case "":
+		return nil, nil
+	case "1", "true":
+		on := true
+		return &on, nil
+	case "0", "false":
+		on := false
+		return &on, nil
+	}
+	return nil, fmt.Errorf("%s must be 1, 0 or empty", name)
+}
+
+// wantsJSON reports whether the client explicitly asked for JSON. Browsers
+// (text/html) and clients sending only */*, such as crawlers, are treated as
+// wanting the normal redirect.
+func wantsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+func qrCodeHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the short hash, and optional variant, from the URL path
+	shortHash, variant, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/qr/"), "/")
+	if shortHash == "" || (variant != "" && variant != "card" && variant != "datauri" && variant != "srcset") {
+		respondError(w, r, http.StatusNotFound, errCodeNotFound, "Page not found")
+		return
+	}
+
+	// Check if the short URL exists in the database
+	url, err := lookupURL(shortHash)
+	if err != nil {
+		respondError(w, r, http.StatusNotFound, errCodeNotFound, "Short link not found")
+		return
+	}
+	shortHash = url.ShortHash
+
+	// By default the QR encodes the tracked short URL. direct=1 encodes the
+	// destination itself: no click stats, but it keeps working without us.
+	shortURL := shortURLFor(url)
+	content := qrContentFor(url)
+	if r.URL.Query().Get("direct") == "1" {
+		// An alias's own row keeps the destination it was created with.
+		target, err := resolveAlias(url)
+		if err != nil {
+			log.Printf("Error resolving alias %s: %v", shortHash, err)
+			respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Error generating QR code")
+			return
+		}
+		content = target.FullURL
+	}
+
+	if variant == "srcset" {
+		qrSrcset(w, r, shortHash, content)
+		return
+	}
+
+	opts, err := parseQROptions(r)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
+		return
+	}
+	format, err := parseQRFormat(r, variant)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
+		return
+	}
+	if variant != "card" && (r.URL.Query().Get("frame") != "" || r.URL.Query().Get("caption") != "") {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "frame and caption are only available on share cards (/qr/{hash}/card)")
+		return
+	}
+
+	// Generate QR code
+	var img []byte
+	if variant == "" && qrCacheable(r) {
+		img, err = canonicalQR(content)
+	} else if format == qrgen.FormatSVG {
+		img, err = qrgen.SVG(content, opts)
+	} else if variant == "card" {
+		var cardOpts qrgen.CardOptions
+		cardOpts, err = parseCardOptions(r, opts)
+		if err != nil {
+			respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
+			return
+		}
+
+		caption := strings.TrimPrefix(strings.TrimPrefix(shortURL, "https://"), "http://")
+		img, err = qrgen.CardPNG(content, caption, cardOpts)
+		var tooLarge *qrgen.ContentTooLargeError
+		if errors.Is(err, qrgen.ErrCardTooSmall) || errors.As(err, &tooLarge) {
+			respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
+			return
+		}
+	} else {
+		img, err = qrgen.PNG(content, opts)
+	}
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Error generating QR code")
+		return
+	}
+
+	// The data URI variant is for embedding the image in emails or pages
+	// without a second request. It's generated once per embed, so it isn't
+	// counted as a view.
+	if variant == "datauri" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if qrCacheable(r) {
+			w.Header().Set("Cache-Control", "public, max-age=3600")
+		} else {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		w.Write([]byte("data:" + format.ContentType() + ";base64," + base64.StdEncoding.EncodeToString(img)))
+		return
+	}
+
+	// Count the fetch as a QR view. Views from logged-in users (such as the
+	// management UI's own thumbnails) are excluded.
+	if !auth.IsAuthenticated(r) {
+		if err := db.IncrementQRViews(shortHash); err != nil {
+			log.Printf("Error incrementing QR views: %v", err)
+		}
+	}
+
+	// Set response headers
+	w.Header().Set("Content-Type", format.ContentType())
+	if qrRevalidate || !qrCacheable(r) {
+		// Browsers must check back on every view, so each one is counted
+		// with QR_REVALIDATE and parameterised codes never go stale.
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=3600") // Cache for 1 hour
+	}
+	// Unchanged images are answered with a bodyless 304, until the image
+	// or the QR cache version changes.
+	etag := qrETag(img)
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Write(img)
+}
+
+// qrCacheable reports whether a QR response may be cached for an hour. Only
+// the canonical code, the short URL with default options, is: codes with
+// request-time parameters such as colours or direct=1 can change without the
+// URL changing, e.g. when the destination is edited.
+func qrCacheable(r *http.Request) bool {
+	return r.URL.RawQuery == ""
+}
+
+// defaultQROptions returns qrgen's defaults with the configured size and
+// compression.
+func defaultQROptions() qrgen.Options {
+	opts := qrgen.DefaultOptions()
+	opts.Size = qrDefaultSize
+	opts.Compression = qrCompression
+	return opts
+}
+
+// parseQRFormat reads the format parameter, falling back to
+// QR_DEFAULT_FORMAT. Share cards and print sizing are PNG-only, so they use
+// PNG unless SVG is asked for explicitly, which is an error.
+func parseQRFormat(r *http.Request, variant string) (qrgen.Format, error) {
+	raw := r.URL.Query().Get("format")
+	printSized := r.URL.Query().Get("dpi") != ""
+	if raw == "" {
+		if variant == "card" || printSized {
+			return qrgen.FormatPNG, nil
+		}
+		return qrDefaultFormat, nil
+	}
+
+	format, err := qrgen.ParseFormat(raw)
+	if err != nil {
+		return "", err
+	}
+	if format == qrgen.FormatSVG && variant == "card" {
+		return "", errors.New("Share cards are only available as PNG")
+	}
+	if format == qrgen.FormatSVG && printSized {
+		return "", errors.New("dpi and physical_mm only apply to PNG")
+	}
+	return format, nil
+}
+
+// parseQROptions reads the QR rendering query parameters.
+func parseQROptions(r *http.Request) (qrgen.Options, error) {
+	opts := defaultQROptions()
+
+	// Quiet zone: border=1 (default) keeps the standard border, border=0 removes it.
+	// Disabling the border can make codes unscannable in some apps.
+	border := r.URL.Query().Get("border")
+	if border != "" && border != "0" && border != "1" {
+		return opts, errors.New("Invalid border value (use 0 or 1)")
+	}
+	opts.Border = border != "0"
+
+	if v := r.URL.Query().Get("size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, errors.New("Invalid size")
+		}
+		if err := qrgen.ValidateSize(size); err != nil {
+			return opts, err
+		}
+		opts.Size = size
+	}
+
+	// Print sizing: dpi and physical_mm together set the pixel size and
+	// record the resolution in the PNG.
+	dpi, physicalMM := r.URL.Query().Get("dpi"), r.URL.Query().Get("physical_mm")
+	if dpi != "" || physicalMM != "" {
+		if dpi == "" || physicalMM == "" {
+			return opts, errors.New("dpi and physical_mm must be given together")
+		}
+		if r.URL.Query().Get("size") != "" {
+			return opts, errors.New("size can't be combined with dpi and physical_mm")
+		}
+
+		dpiValue, err := strconv.Atoi(dpi)
+		if err != nil {
+			return opts, errors.New("Invalid dpi")
+		}
+		mm, err := strconv.ParseFloat(physicalMM, 64)
+		if err != nil {
+			return opts, errors.New("Invalid physical_mm")
+		}
+
+		size, err := qrgen.SizeForPrint(dpiValue, mm)
+		if err != nil {
+			return opts, err
+		}
+		opts.Size = size
+		opts.DPI = dpiValue
+	}
+
+	style, err := qrgen.ParseStyle(r.URL.Query().Get("style"))
+	if err != nil {
+		return opts, err
+	}
+	opts.Style = style
+
+	return opts, nil
+}
+
+// parseCardOptions reads the share card dimensions (width, height).
+func parseCardOptions(r *http.Request, qrOpts qrgen.Options) (qrgen.CardOptions, error) {
+	cardOpts := qrgen.CardOptions{QR: qrOpts, Width: 600}
+
+	if v := r.URL.Query().Get("width"); v != "" {
+		width, err := strconv.Atoi(v)
+		if err != nil {
+			return cardOpts, errors.New("Invalid width")
+		}
+		cardOpts.Width = width
+	}
+
+	if v := r.URL.Query().Get("height"); v != "" {
+		height, err := strconv.Atoi(v)
+		if err != nil {
+			return cardOpts, errors.New("Invalid height")
+		}
+		cardOpts.Height = height
+	}
+
+	if err := qrgen.ValidateCardSize(cardOpts.Width, cardOpts.Height); err != nil {
+		return cardOpts, err
+	}
+
+	frame, err := qrgen.ParseFrame(r.URL.Query().Get("frame"))
+	if err != nil {
+		return cardOpts, err
+	}
+	cardOpts.Frame = frame
+	if caption := r.URL.Query().Get("caption"); caption != "" {
+		if frame != qrgen.FrameScanMe {
+			return cardOpts, errors.New("caption is the text of a frame, use it with frame=scanme")
+		}
+		if cardOpts.FrameCaption, err = qrgen.CleanFrameCaption(caption); err != nil {
+			return cardOpts, err
+		}
+	}
+	return cardOpts, nil
+}
+
+func updateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		if isBodyTooLarge(err) {
+			respondError(w, r, http.StatusRequestEntityTooLarge, errCodeBodyTooLarge, "Request body too large")
+			return
+		}
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid form data")
+		return
+	}
+
+	shortHash := r.FormValue("short_hash")
+	newURL := r.FormValue("new_url")
+
+	if shortHash == "" || newURL == "" {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Short hash and new URL are required")
+		return
+	}
+
+	newURL, err = utils.NormalizeURL(newURL, autoPrependScheme, allowedSchemes...)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidURL, err.Error())
+		return
+	}
+
+	// Check if URL exists
+	existing, err := db.GetURLByHash(shortHash)
+	if err != nil {
+		respondError(w, r, http.StatusNotFound, errCodeNotFound, "URL not found")
+		return
+	}
+	if existing.AliasOf != 0 {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, errAliasDestination)
+		return
+	}
+
+	title := linkTitle(r.FormValue("title"), newURL)
+
+	// The domain is only changed when the field is sent, so older clients
+	// don't move links back to the default host.
+	_, setDomain := r.Form["domain"]
+	domain, err := parseLinkDomain(r.FormValue("domain"))
+	if setDomain && err != nil {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
+		return
+	}
+
+	_, setPublicStats := r.Form["public_stats"]
+	publicStats, err := parseLinkOverride("public_stats", r.FormValue("public_stats"))
+	if setPublicStats && err != nil {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
+		return
+	}
+
+	_, setForwardQuery := r.Form["forward_query"]
+	forwardQuery, err := parseLinkOverride("forward_query", r.FormValue("forward_query"))
+	if setForwardQuery && err != nil {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
+		return
+	}
+
+	// click_sample_rate=N records one in N clicks as events; empty follows
+	// CLICK_SAMPLE_RATE again.
+	_, setSampleRate := r.Form["click_sample_rate"]
+	sampleRate := 0
+	if raw := r.FormValue("click_sample_rate"); setSampleRate && raw != "" {
+		if sampleRate, err = parseClickSampleRate(raw); err != nil {
+			respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "click_sample_rate "+err.Error())
+			return
+		}
+	}
+
+	_, setQRPreview := r.Form["qr_preview"]
+	qrPreview, err := parseLinkOverride("qr_preview", r.FormValue("qr_preview"))
+	if setQRPreview && err != nil {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
+		return
+	}
+
+	// Clicks are kept by default since the link is the same row; reset_clicks=1
+	// starts the stats afresh for a repurposed link.
+	resetClicks := r.FormValue("reset_clicks") == "1"
+
+	// Update the URL
+	err = db.UpdateURL(shortHash, newURL, title, resetClicks)
+	if err != nil {
+		log.Printf("Error updating URL: %v", err)
+		respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to update URL")
+		return
+	}
+	if setDomain {
+		if err := db.SetURLDomain(shortHash, domain); err != nil {
+			log.Printf("Error setting domain of %s to %q: %v", shortHash, domain, err)
+			respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to update URL")
+			return
+		}
+	}
+	if setPublicStats {
+		if err := db.SetURLPublicStats(shortHash, publicStats); err != nil {
+			log.Printf("Error setting public stats of %s: %v", shortHash, err)
+			respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to update URL")
+			return
+		}
+	}
+	if setForwardQuery {
+		if err := db.SetURLForwardQuery(shortHash, forwardQuery); err != nil {
+			log.Printf("Error setting query forwarding of %s: %v", shortHash, err)
+			respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to update URL")
+			return
+		}
+	}
+	if setSampleRate {
+		if err := db.SetURLClickSampleRate(shortHash, sampleRate); err != nil {
+			log.Printf("Error setting click sample rate of %s: %v", shortHash, err)
+			respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to update URL")
+			return
+		}
+	}
+	if setQRPreview {
+		if err := db.SetURLQRPreview(shortHash, qrPreview); err != nil {
+			log.Printf("Error setting QR preview of %s: %v", shortHash, err)
+			respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to update URL")
+			return
+		}
+	}
+	invalidateCachedURL(shortHash)
+
+	if resetClicks {
+		// Rare enough that recounting beats tracking the removed clicks.
+		if err := counters.reconcile(); err != nil {
+			log.Printf("Error reconciling link counters: %v", err)
+		}
+	}
+
+	target := shortHash + " -> " + loggedURL(newURL)
+	if resetClicks {
+		target += " (clicks reset)"
+	}
+	recordAudit(r, database.AuditURLUpdated, target)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"success":      true,
+		"title":        title,
+		"clicks_reset": resetClicks,
+	})
+}
+
+// linkTitle returns the trimmed title, defaulting to the destination host.
+func linkTitle(title, fullURL string) string {
+	if title = strings.TrimSpace(title); title != "" {
+		return title
+	}
+	if u, err := url.Parse(fullURL); err == nil {
+		if u.Opaque != "" {
+			// mailto:, tel: and similar: use the address itself.
+			return u.Opaque
+		}
+		return u.Hostname()
+	}
+	return ""
+}
+
+// statsHandler shows the analytics for a single link.
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+
+	shortHash, export, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/stats/"), "/")
+	if export != "" && (!clickTracking || export != "clicks.csv" && export != "export.csv") {
+		http.NotFound(w, r)
+		return
+	}
+
+	url, err := lookupURL(shortHash)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var canonical *database.URL
+	if url.AliasOf != 0 {
+		if canonical, err = db.GetURLByID(url.AliasOf); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		url.FullURL = canonical.FullURL
+		url.Title = canonical.Title
+	}
+
+	loc, err := statsLocation(r)
+	if err != nil && export != "" {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if export == "export.csv" {
+		dailyClicksCSV(w, r, url, loc)
+		return
+	}
+
+	var filterError string
+	tzParam := r.URL.Query().Get("tz")
+	if err != nil {
+		filterError = err.Error()
+		loc, tzParam = time.UTC, ""
+	}
+
+	sinceParam := r.URL.Query().Get("since")
+	var since *time.Time
+	if sinceParam != "" {
+		t, err := time.ParseInLocation(sinceDateLayout, sinceParam, loc)
+		if err != nil {
+			filterError = "Invalid date, use YYYY-MM-DD"
+			sinceParam = ""
+		} else {
+			since = &t
+		}
+	}
+
+	if export == "clicks.csv" {
+		if filterError != "" {
+			http.Error(w, filterError, http.StatusBadRequest)
+			return
+		}
+		clickEventsCSV(w, url, since, loc)
+		return
+	}
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	// Fetch one extra event to tell whether there is a next page.
+	var events []database.ClickEvent
+	if clickTracking {
+		events, err = db.GetClickEvents(url.ShortHash, clickEventsPageSize+1, (page-1)*clickEventsPageSize, since)
+		if err != nil {
+			log.Printf("Error fetching click events: %v", err)
+			http.Error(w, "Error loading click events", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	nextPage := 0
+	if len(events) > clickEventsPageSize {
+		events = events[:clickEventsPageSize]
+		nextPage = page + 1
+	}
+
+	aliases, err := db.GetAliases(url.ID)
+	if err != nil {
+		log.Printf("Error fetching aliases of %s: %v", url.ShortHash, err)
+		http.Error(w, "Error loading aliases", http.StatusInternalServerError)
+		return
+	}
+	totalClicks := url.Clicks
+	for i := range aliases {
+		totalClicks += aliases[i].Clicks
+		aliases[i].CreatedAt = aliases[i].CreatedAt.In(loc)
+	}
+
+	for i := range events {
+		events[i].ClickedAt = events[i].ClickedAt.In(loc)
+	}
+	url.CreatedAt = url.CreatedAt.In(loc)
+	for _, t := range []*time.Time{url.UpdatedAt, url.LastClickedAt} {
+		if t != nil {
+			*t = t.In(loc)
+		}
+	}
+
+	tmpl, err := template.ParseFS(templatesFS, "templates/stats.html")
+	if err != nil {
+		http.Error(w, "Error loading template", http.StatusInternalServerError)
+		log.Printf("Template error: %v", err)
+		return
+	}
+
+	_, username, _ := auth.GetUserFromSession(r)
+
+	data := StatsData{
+		Title:         "Link Stats - QR Linker",
+		URL:           url,
+		ShortURL:      shortURLFor(url),
+		PublicStats:   statsArePublic(url),
+		ForwardQuery:  forwardsQuery(url),
+		QRPreview:     qrOpensPreview(url),
+		SampleRate:    sampleRateFor(url),
+		ClickTracking: clickTracking,
+		Canonical:     canonical,
+		Aliases:       aliases,
+		TotalClicks:   totalClicks,
+		Username:      username,
+		Events:        events,
+		Since:         sinceParam,
+		TZ:            tzParam,
+		Zone:          loc.String(),
+		Page:          page,
+		PrevPage:      page - 1,
+		NextPage:      nextPage,
+		Error:         filterError,
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Render error: %v", err)
+	}
+}
+
+// clickEventsCSV writes all of a link's click events since the given time
+// as a CSV download, with times in loc.
+func clickEventsCSV(w http.ResponseWriter, url *database.URL, since *time.Time, loc *time.Location) {
+	events, err := db.GetClickEvents(url.ShortHash, 0, 0, since)
+	if err != nil {
+		log.Printf("Error fetching click events: %v", err)
+		http.Error(w, "Error loading click events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-clicks.csv"`, url.ShortHash))
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"clicked_at", "referrer", "user_agent", "sample_rate"})
+	for _, e := range events {
+		cw.Write([]string{e.ClickedAt.In(loc).Format(time.RFC3339), csvSafe(e.Referrer), csvSafe(e.UserAgent), strconv.Itoa(e.SampleRate)})
+	}
+	cw.Flush()
+}
+
+// Daily click export range limits, in days.
+const (
+	defaultDailyClicksDays = 30
+	maxDailyClicksDays     = 366
+)
+
+// dailyClicksCSV writes a link's clicks per day in loc as a CSV download.
+// The range comes from the from and to query parameters (YYYY-MM-DD, both
+// inclusive) and defaults to the last 30 days.
+func dailyClicksCSV(w http.ResponseWriter, r *http.Request, url *database.URL, loc *time.Location) {
+	to := time.Now().In(loc)
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.ParseInLocation(sinceDateLayout, v, loc)
+		if err != nil {
+			http.Error(w, "Invalid to date, use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+
+	from := to.AddDate(0, 0, -(defaultDailyClicksDays - 1))
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.ParseInLocation(sinceDateLayout, v, loc)
+		if err != nil {
+			http.Error(w, "Invalid from date, use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+
+	if from.After(to) {
+		http.Error(w, "from must not be after to", http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from) >= maxDailyClicksDays*24*time.Hour {
+		http.Error(w, fmt.Sprintf("Date range is limited to %d days", maxDailyClicksDays), http.StatusBadRequest)
+		return
+	}
+
+	series, err := db.GetDailyClicks(url.ShortHash, from, to, loc)
+	if err != nil {
+		log.Printf("Error fetching daily clicks: %v", err)
+		http.Error(w, "Error loading click events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-daily-clicks.csv"`, url.ShortHash))
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"date", "clicks"})
+	for _, day := range series {
+		cw.Write([]string{day.Date, strconv.Itoa(day.Clicks)})
+	}
+	cw.Flush()
+}
+
+// csvSafe stops visitor-supplied values such as referrers from being
+// interpreted as formulas when the CSV is opened in a spreadsheet.
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// recordAudit logs an administrative action performed by the session user.
+// Failures are logged rather than surfaced so they never block the action.
+func recordAudit(r *http.Request, action, target string) {
+	userID, _, _ := auth.GetUserFromSession(r)
+
+	err := db.RecordAudit(database.AuditEntry{
+		ActorUserID: userID,
+		Action:      action,
+		Target:      target,
+	})
+	if err != nil {
+		log.Printf("Error recording audit entry: %v", err)
+	}
+}
+
+func auditHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+
+	tmpl, err := template.ParseFS(templatesFS, "templates/audit.html")
+	if err != nil {
+		http.Error(w, "Error loading template", http.StatusInternalServerError)
+		log.Printf("Template error: %v", err)
+		return
+	}
+
+	entries, err := db.GetAuditLog(200)
+	if err != nil {
+		log.Printf("Error fetching audit log: %v", err)
+		entries = []database.AuditEntry{}
+	}
+
+	_, username, _ := auth.GetUserFromSession(r)
+
+	data := AuditData{
+		Title:    "Audit Log - QR Linker",
+		Entries:  entries,
+		Username: username,
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Render error: %v", err)
+	}
 }
 
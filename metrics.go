@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync/atomic"
+
+	"qr-linker/utils"
+)
+
+// hashStats counts how hard finding unused hashes for new links has been
+// since startup. Links often needing longer hashes means the default length
+// is running out of free hashes.
+type hashStats struct {
+	// generated is the number of hashes handed out.
+	generated atomic.Int64
+	// retries is the number of taken hashes tried before a free one.
+	retries atomic.Int64
+	// longer is the number of hashes longer than the default length, used
+	// after MaxHashRetries default-length hashes were all taken.
+	longer atomic.Int64
+	// exhausted is the number of times no free hash was found at all.
+	exhausted atomic.Int64
+}
+
+var hashGeneration hashStats
+
+// record counts one hash generation that took attempts tries.
+func (s *hashStats) record(attempts int, found bool) {
+	if !found {
+		s.exhausted.Add(1)
+		s.retries.Add(int64(attempts))
+		log.Printf("Warning: no unused hash found after %d attempts", attempts)
+		return
+	}
+
+	s.generated.Add(1)
+	s.retries.Add(int64(attempts - 1))
+	if attempts > utils.MaxHashRetries {
+		s.longer.Add(1)
+		log.Printf("Warning: %d generated hashes were taken, used a longer one; the hash namespace is filling up", attempts-1)
+	} else if attempts > 1 {
+		debugf("Hash generation retried %d times", attempts-1)
+	}
+}
+
+type hashStatsView struct {
+	Generated int64 `json:"generated"`
+	Retries   int64 `json:"retries"`
+	Longer    int64 `json:"longer"`
+	Exhausted int64 `json:"exhausted"`
+}
+
+func (s *hashStats) view() hashStatsView {
+	return hashStatsView{
+		Generated: s.generated.Load(),
+		Retries:   s.retries.Load(),
+		Longer:    s.longer.Load(),
+		Exhausted: s.exhausted.Load(),
+	}
+}
+
+// metricsHandler serves /api/v1/metrics, counters of this process since it
+// started.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"hash_generation": hashGeneration.view(),
+	}); err != nil {
+		log.Printf("Error encoding metrics: %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"qr-linker/auth"
+	"strings"
+	"sync/atomic"
+)
+
+// maintenanceEnabled is the runtime maintenance toggle. Maintenance is also
+// active while the sentinel file named by maintenanceFile exists.
+var (
+	maintenanceEnabled       atomic.Bool
+	maintenanceFile          string
+	maintenanceKeepRedirects bool
+)
+
+// maintenanceExempt lists paths that stay available during maintenance so
+// health checks keep passing and admins can log in to turn it off again.
+var maintenanceExempt = []string{"/healthz", "/login", "/login/2fa", "/logout", "/static/"}
+
+func maintenanceActive() bool {
+	if maintenanceEnabled.Load() {
+		return true
+	}
+	if maintenanceFile != "" {
+		if _, err := os.Stat(maintenanceFile); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// maintenanceMiddleware serves a 503 maintenance page while maintenance mode
+// is active. Logged-in users bypass it, and short link redirects can be kept
+// alive with MAINTENANCE_KEEP_REDIRECTS.
+func maintenanceMiddleware(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !maintenanceActive() || auth.IsAuthenticated(r) {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		for _, path := range maintenanceExempt {
+			if r.URL.Path == path || (strings.HasSuffix(path, "/") && strings.HasPrefix(r.URL.Path, path)) {
+				mux.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		if maintenanceKeepRedirects && isShortLinkPath(mux, r) {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		renderMaintenance(w)
+	})
+}
+
+// isShortLinkPath reports whether the request falls through to the short
+// link catch-all route rather than a named route, or is a /s/ scan redirect.
+func isShortLinkPath(mux *http.ServeMux, r *http.Request) bool {
+	_, pattern := mux.Handler(r)
+	return (pattern == "/" && r.URL.Path != "/") || pattern == "/s/"
+}
+
+func renderMaintenance(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "300")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+
+	tmpl, err := template.ParseFS(templatesFS, "templates/maintenance.html")
+	if err != nil {
+		log.Printf("Template error: %v", err)
+		http.Error(w, "Service temporarily unavailable for maintenance", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	if err := tmpl.Execute(w, nil); err != nil {
+		log.Printf("Render error: %v", err)
+	}
+}
+
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("ok"))
+}
+
+// maintenanceToggleHandler reports (GET) or sets (POST enabled=1|0) the
+// runtime maintenance toggle.
+func maintenanceToggleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		switch r.FormValue("enabled") {
+		case "1", "true":
+			maintenanceEnabled.Store(true)
+		case "0", "false":
+			maintenanceEnabled.Store(false)
+		default:
+			http.Error(w, "enabled must be 1 or 0", http.StatusBadRequest)
+			return
+		}
+		log.Printf("Maintenance mode set to %v", maintenanceEnabled.Load())
+	} else if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{
+		"maintenance": maintenanceActive(),
+		"toggle":      maintenanceEnabled.Load(),
+	})
+}
+
+// Request body limits, in bytes. Upload endpoints get a higher limit.
+var (
+	maxBodyBytes       int64 = 1 << 20  // 1 MiB
+	maxUploadBodyBytes int64 = 10 << 20 // 10 MiB
+)
+
+// uploadPaths lists path prefixes that accept file uploads.
+var uploadPaths = []string{"/import", "/api/v1/urls/bulk-titles"}
+
+func bodyLimitFor(path string) int64 {
+	for _, prefix := range uploadPaths {
+		if strings.HasPrefix(path, prefix) {
+			return maxUploadBodyBytes
+		}
+	}
+	return maxBodyBytes
+}
+
+// bodyLimitMiddleware caps request body sizes. Requests declaring a larger
+// Content-Length are rejected up front; other oversized bodies fail when read,
+// which handlers detect with isBodyTooLarge.
+func bodyLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := bodyLimitFor(r.URL.Path)
+		if r.ContentLength > limit {
+			http.Error(w, fmt.Sprintf("Request body too large (limit %d bytes)", limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// defaultContentSecurityPolicy allows only same-origin scripts, styles and
+// images, plus data: images for the two-factor enrollment QR code. Templates
+// contain no inline scripts or styles.
+const defaultContentSecurityPolicy = "default-src 'self'; img-src 'self' data:; object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'"
+
+// Security header values. contentSecurityPolicy is empty when disabled with
+// CONTENT_SECURITY_POLICY=off.
+var (
+	contentSecurityPolicy = defaultContentSecurityPolicy
+	referrerPolicy        = "strict-origin-when-cross-origin"
+)
+
+// securityHeadersMiddleware sets X-Content-Type-Options and Referrer-Policy on
+// every response, and the Content-Security-Policy and X-Frame-Options on HTML
+// responses, where they apply. Headers a handler has already set are kept.
+func securityHeadersMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		if referrerPolicy != "" {
+			h.Set("Referrer-Policy", referrerPolicy)
+		}
+		next.ServeHTTP(&securityHeadersWriter{ResponseWriter: w}, r)
+	})
+}
+
+// frameOptions returns the X-Frame-Options value matching the CSP. Framing is
+// denied unless the policy's frame-ancestors directive allows some origins,
+// in which case the CSP alone decides.
+func frameOptions(csp string) string {
+	for _, directive := range strings.Split(csp, ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), " ")
+		if strings.EqualFold(name, "frame-ancestors") && strings.TrimSpace(value) != "'none'" {
+			return ""
+		}
+	}
+	return "DENY"
+}
+
+// securityHeadersWriter adds the HTML-only headers once the response's
+// content type is known.
+type securityHeadersWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *securityHeadersWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		h := w.Header()
+		if strings.HasPrefix(h.Get("Content-Type"), "text/html") {
+			if contentSecurityPolicy != "" && h.Get("Content-Security-Policy") == "" {
+				h.Set("Content-Security-Policy", contentSecurityPolicy)
+			}
+			if xfo := frameOptions(contentSecurityPolicy); xfo != "" && h.Get("X-Frame-Options") == "" {
+				h.Set("X-Frame-Options", xfo)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *securityHeadersWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		// Sniff as net/http would, so untyped HTML still gets the headers.
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *securityHeadersWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *securityHeadersWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
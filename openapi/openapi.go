@@ -0,0 +1,11 @@
+// Package openapi holds the OpenAPI 3 description of the JSON API, served at
+// /api/v1/openapi.json. The document is maintained by hand: update it along
+// with the endpoints it describes.
+package openapi
+
+import _ "embed"
+
+// Spec is the OpenAPI document as JSON.
+//
+//go:embed openapi.json
+var Spec []byte
@@ -0,0 +1,105 @@
+package openapi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSpecParses(t *testing.T) {
+	var doc map[string]any
+	if err := json.Unmarshal(Spec, &doc); err != nil {
+		t.Fatalf("spec is not valid JSON: %v", err)
+	}
+
+	if v, _ := doc["openapi"].(string); !strings.HasPrefix(v, "3.") {
+		t.Errorf("openapi = %q, want 3.x", v)
+	}
+	info, _ := doc["info"].(map[string]any)
+	if info["title"] == nil || info["version"] == nil {
+		t.Errorf("info = %v, want title and version", info)
+	}
+
+	paths, _ := doc["paths"].(map[string]any)
+	for _, p := range []string{"/api/v1/shorten", "/api/v1/urls/{hash}/resolve", "/api/v1/dashboard", "/qr/{hash}"} {
+		if paths[p] == nil {
+			t.Errorf("spec has no path %s", p)
+		}
+	}
+
+	operationIDs := map[string]bool{}
+	for path, item := range paths {
+		ops, _ := item.(map[string]any)
+		if len(ops) == 0 {
+			t.Errorf("%s has no operations", path)
+		}
+		for method, raw := range ops {
+			op, _ := raw.(map[string]any)
+			if responses, _ := op["responses"].(map[string]any); len(responses) == 0 {
+				t.Errorf("%s %s has no responses", method, path)
+			}
+			id, _ := op["operationId"].(string)
+			if id == "" || operationIDs[id] {
+				t.Errorf("%s %s has a missing or duplicate operationId %q", method, path, id)
+			}
+			operationIDs[id] = true
+
+			// The {hash} path parameter must be declared.
+			if strings.Contains(path, "{hash}") && !declaresHash(doc, op) {
+				t.Errorf("%s %s doesn't declare the hash parameter", method, path)
+			}
+		}
+	}
+
+	checkRefs(t, doc, doc, "")
+}
+
+func declaresHash(doc map[string]any, op map[string]any) bool {
+	params, _ := op["parameters"].([]any)
+	for _, p := range params {
+		param, _ := p.(map[string]any)
+		if ref, ok := param["$ref"].(string); ok {
+			param, _ = resolve(doc, ref).(map[string]any)
+		}
+		if param["name"] == "hash" && param["in"] == "path" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRefs fails for every $ref under node that doesn't point at an existing
+// part of the document.
+func checkRefs(t *testing.T, doc map[string]any, node any, at string) {
+	t.Helper()
+	switch v := node.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if key == "$ref" {
+				ref, _ := child.(string)
+				if resolve(doc, ref) == nil {
+					t.Errorf("%s: unresolved $ref %q", at, ref)
+				}
+				continue
+			}
+			checkRefs(t, doc, child, at+"/"+key)
+		}
+	case []any:
+		for _, child := range v {
+			checkRefs(t, doc, child, at)
+		}
+	}
+}
+
+func resolve(doc map[string]any, ref string) any {
+	pointer, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil
+	}
+	var node any = doc
+	for _, part := range strings.Split(pointer, "/") {
+		m, _ := node.(map[string]any)
+		node = m[part]
+	}
+	return node
+}
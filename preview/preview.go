@@ -0,0 +1,136 @@
+// Package preview fetches the title and Open Graph metadata of web pages,
+// used to prefill link titles.
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"qr-linker/httpclient"
+)
+
+// MaxBodyBytes caps how much of a page is read.
+const MaxBodyBytes = 512 << 10 // 512 KiB
+
+var (
+	// ErrNotHTML is returned when the destination isn't an HTML page.
+	ErrNotHTML = errors.New("destination is not an HTML page")
+	// ErrUnsupportedScheme is returned for URLs other than http and https.
+	ErrUnsupportedScheme = errors.New("only http and https pages can be previewed")
+)
+
+// Meta is the metadata read from a page. Fields are empty when the page
+// doesn't provide them.
+type Meta struct {
+	Title   string `json:"title"`
+	OGTitle string `json:"og_title,omitempty"`
+	OGImage string `json:"og_image,omitempty"`
+}
+
+// BestTitle returns the Open Graph title if present, else the page title.
+func (m Meta) BestTitle() string {
+	if m.OGTitle != "" {
+		return m.OGTitle
+	}
+	return m.Title
+}
+
+var client = httpclient.New(true)
+
+// Fetch downloads the page at rawURL and returns its metadata. Only the
+// first MaxBodyBytes of the page are read. Requests go through httpclient, so
+// non-public destinations fail with httpclient.ErrBlockedAddress.
+func Fetch(ctx context.Context, rawURL string) (*Meta, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, ErrUnsupportedScheme
+	}
+	req.Header.Set("User-Agent", "QR-Linker link preview")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, httpclient.ErrBlockedAddress) {
+			return nil, httpclient.ErrBlockedAddress
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("destination returned %s", resp.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, ErrNotHTML
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxBodyBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	meta := ParseMeta(body)
+	if meta.OGImage != "" {
+		// Relative image URLs are resolved against the final page URL.
+		if img, err := resp.Request.URL.Parse(meta.OGImage); err == nil {
+			meta.OGImage = img.String()
+		}
+	}
+	return &meta, nil
+}
+
+var (
+	titleRe = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	metaRe  = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	attrRe  = regexp.MustCompile(`(?is)([a-z:_-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// ParseMeta extracts the title and og:title/og:image from an HTML document.
+// It's a lenient scan rather than a full parse, which is enough for the head
+// of a page.
+func ParseMeta(body []byte) Meta {
+	var meta Meta
+	if m := titleRe.FindSubmatch(body); m != nil {
+		meta.Title = cleanText(string(m[1]))
+	}
+
+	for _, tag := range metaRe.FindAll(body, -1) {
+		attrs := map[string]string{}
+		for _, a := range attrRe.FindAllSubmatch(tag, -1) {
+			attrs[strings.ToLower(string(a[1]))] = string(a[2]) + string(a[3]) + string(a[4])
+		}
+
+		// og: tags belong in property, but name is common in the wild.
+		key := attrs["property"]
+		if key == "" {
+			key = attrs["name"]
+		}
+		switch strings.ToLower(key) {
+		case "og:title":
+			if meta.OGTitle == "" {
+				meta.OGTitle = cleanText(attrs["content"])
+			}
+		case "og:image":
+			if meta.OGImage == "" {
+				meta.OGImage = strings.TrimSpace(html.UnescapeString(attrs["content"]))
+			}
+		}
+	}
+	return meta
+}
+
+// cleanText unescapes entities and collapses whitespace.
+func cleanText(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+}
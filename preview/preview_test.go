@@ -0,0 +1,28 @@
+package preview
+
+import "testing"
+
+func TestParseMeta(t *testing.T) {
+	page := `<html><head>
+		<title>
+			Spring &amp; Summer Sale
+		</title>
+		<meta content='Big Sale' property="og:title">
+		<meta name="og:image" content="/img/sale.png" />
+		<meta property="og:title" content="Ignored duplicate">
+	</head><body></body></html>`
+
+	meta := ParseMeta([]byte(page))
+	if meta.Title != "Spring & Summer Sale" {
+		t.Errorf("Title = %q", meta.Title)
+	}
+	if meta.OGTitle != "Big Sale" {
+		t.Errorf("OGTitle = %q", meta.OGTitle)
+	}
+	if meta.OGImage != "/img/sale.png" {
+		t.Errorf("OGImage = %q", meta.OGImage)
+	}
+	if meta.BestTitle() != "Big Sale" {
+		t.Errorf("BestTitle = %q, want og:title", meta.BestTitle())
+	}
+}
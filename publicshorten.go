@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"qr-linker/auth"
+	"qr-linker/captcha"
+)
+
+// With PUBLIC_SHORTEN, visitors who aren't logged in can create links from
+// the /new page or the shorten API. Anonymous requests are limited to
+// publicShortenLimit per IP address per publicShortenWindow and, when
+// captchaVerifier is set, must pass a captcha.
+var (
+	publicShortenLimit  = 10
+	publicShortenWindow = time.Hour
+	captchaVerifier     *captcha.Verifier
+)
+
+// trustProxy takes the client address from the X-Forwarded-For header set by
+// a reverse proxy (TRUST_PROXY) instead of the connection. Only enable it
+// behind a proxy that sets the header, or clients can pick their own.
+var trustProxy bool
+
+var publicShortenLimiter = newRateLimiter()
+
+type PublicShortenData struct {
+	Title    string
+	Captcha  *captcha.Verifier
+	ShortURL string
+	QRCode   string
+	Error    string
+}
+
+// clientIP returns the address of the client that sent the request. With
+// TRUST_PROXY it's the last X-Forwarded-For entry, the one added by the
+// proxy in front of this server.
+func clientIP(r *http.Request) string {
+	if trustProxy {
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimiter counts requests per key in fixed windows.
+type rateLimiter struct {
+	mu      sync.Mutex
+	windows map[string]*rateWindow
+}
+
+type rateWindow struct {
+	count int
+	reset time.Time
+}
+
+// rateLimiterPruneSize is the number of tracked keys above which expired
+// windows are dropped, so the map doesn't grow with every address seen.
+const rateLimiterPruneSize = 10000
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{windows: make(map[string]*rateWindow)}
+}
+
+// allow counts a request for key and reports whether it's within limit per
+// window. When it isn't, the time until the window resets is returned.
+func (l *rateLimiter) allow(key string, limit int, window time.Duration) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if len(l.windows) > rateLimiterPruneSize {
+		for k, w := range l.windows {
+			if now.After(w.reset) {
+				delete(l.windows, k)
+			}
+		}
+	}
+
+	w, ok := l.windows[key]
+	if !ok || now.After(w.reset) {
+		w = &rateWindow{reset: now.Add(window)}
+		l.windows[key] = w
+	}
+	w.count++
+	if w.count > limit {
+		return false, w.reset.Sub(now)
+	}
+	return true, 0
+}
+
+// shortenAccess guards the shorten endpoints. Without PUBLIC_SHORTEN they
+// require login; with it, anonymous requests are rate limited per IP and
+// checked against the captcha before reaching the handler.
+func shortenAccess(next http.HandlerFunc) http.HandlerFunc {
+	requireAuth := auth.RequireAuth(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !featureFlags.PublicShorten || auth.IsAuthenticated(r) {
+			requireAuth(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		ip := clientIP(r)
+		// Every attempt counts, including failed captchas, so the limit
+		// also caps how often a client can ask the captcha provider.
+		if ok, retryAfter := publicShortenLimiter.allow(ip, publicShortenLimit, publicShortenWindow); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			shortenError(w, r, http.StatusTooManyRequests, errCodeRateLimited, "Too many links created, try again later")
+			return
+		}
+
+		if captchaVerifier != nil {
+			err := captchaVerifier.Verify(r.Context(), r.FormValue(captchaVerifier.FormField), ip)
+			if errors.Is(err, captcha.ErrFailed) {
+				shortenError(w, r, http.StatusForbidden, errCodeCaptchaFailed, "Captcha check failed, please try again")
+				return
+			}
+			if err != nil {
+				log.Printf("Error verifying captcha: %v", err)
+				shortenError(w, r, http.StatusServiceUnavailable, errCodeInternal, "Couldn't check the captcha, please try again later")
+				return
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+// publicShortenPageHandler serves /new, the form for creating links without
+// logging in. After creating a link the visitor is sent back here with it
+// in the created parameter.
+func publicShortenPageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+
+	tmpl, err := template.ParseFS(templatesFS, "templates/new.html")
+	if err != nil {
+		http.Error(w, "Error loading template", http.StatusInternalServerError)
+		log.Printf("Template error: %v", err)
+		return
+	}
+
+	data := PublicShortenData{
+		Title:   "Create a Short Link - QR Linker",
+		Captcha: captchaVerifier,
+		Error:   r.URL.Query().Get("error"),
+	}
+	if created := r.URL.Query().Get("created"); created != "" {
+		if link, err := lookupURL(created); err == nil {
+			data.ShortURL = shortURLFor(link)
+			data.QRCode = "/qr/" + url.PathEscape(link.ShortHash)
+		}
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Render error: %v", err)
+	}
+}
+
+// captchaContentSecurityPolicy extends the default policy so the captcha
+// widget can load its scripts, styles and frames.
+func captchaContentSecurityPolicy(v *captcha.Verifier) string {
+	sources := "'self' " + strings.Join(v.Origins, " ")
+	return defaultContentSecurityPolicy +
+		"; script-src " + sources +
+		"; style-src " + sources +
+		"; frame-src " + sources +
+		"; connect-src " + sources
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"qr-linker/cache"
+	"qr-linker/database"
+)
+
+// useTestDB points the handlers at a fresh in-memory database for the
+// duration of the test.
+func useTestDB(t *testing.T) *database.DB {
+	t.Helper()
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	testDB, err := database.NewDB(fmt.Sprintf("file:%s?mode=memory&cache=shared", name))
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+
+	prevDB, prevCache := db, qrImageCache
+	db = testDB
+	qrImageCache = cache.New[string, []byte](time.Minute, 10)
+	t.Cleanup(func() {
+		db, qrImageCache = prevDB, prevCache
+		testDB.Close()
+	})
+
+	return testDB
+}
+
+func TestQRCardTooSmall(t *testing.T) {
+	testDB := useTestDB(t)
+	if _, err := testDB.CreateURL("https://example.com", "abc123", "", 0); err != nil {
+		t.Fatalf("CreateURL: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	qrCodeHandler(rec, httptest.NewRequest(http.MethodGet, "/qr/abc123/card?width=2000&height=200", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec.Body.Len() == 0 {
+		t.Error("response body is empty, want an error")
+	}
+
+	url, err := testDB.GetURLByHash("abc123")
+	if err != nil {
+		t.Fatalf("GetURLByHash: %v", err)
+	}
+	if url.QRViews != 0 {
+		t.Errorf("QRViews = %d, want 0 after a failed card", url.QRViews)
+	}
+}
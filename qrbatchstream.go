@@ -0,0 +1,298 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"qr-linker/auth"
+	"qr-linker/database"
+	"qr-linker/qrgen"
+)
+
+// maxQRBatchStreamSize caps the number of hashes in one streamed batch. It's
+// higher than maxQRBatchSize since the client sees progress as codes are
+// rendered and the archive is written to disk rather than held in memory.
+const maxQRBatchStreamSize = 2000
+
+// qrBatchDownloadTTL is how long the ZIP of a streamed batch can be
+// downloaded before it's deleted.
+const qrBatchDownloadTTL = 15 * time.Minute
+
+// sseWriter writes server-sent events, flushing each one so it reaches the
+// client straight away.
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// newSSEWriter starts an event stream on w. It returns false, without
+// writing anything, when w can't be flushed.
+func newSSEWriter(w http.ResponseWriter) (*sseWriter, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	// Stops nginx from buffering the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &sseWriter{w: w, flusher: flusher}, true
+}
+
+// send writes one event with data encoded as JSON. An error means the client
+// has gone away.
+func (s *sseWriter) send(event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// qrBatchProgress is the data of a progress event.
+type qrBatchProgress struct {
+	Generated int `json:"generated"`
+	Total     int `json:"total"`
+}
+
+// qrBatchDone is the data of the final event of a successful batch.
+type qrBatchDone struct {
+	DownloadURL string    `json:"download_url"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// qrBatchDownload is a finished ZIP waiting to be downloaded by the user who
+// requested it.
+type qrBatchDownload struct {
+	path      string
+	userID    int
+	expiresAt time.Time
+}
+
+// qrBatchDownloadStore tracks finished ZIPs by download token and deletes
+// each one when it expires.
+type qrBatchDownloadStore struct {
+	mu    sync.Mutex
+	files map[string]qrBatchDownload
+}
+
+var qrBatchDownloads = &qrBatchDownloadStore{files: make(map[string]qrBatchDownload)}
+
+// add registers the ZIP at path and returns its download token.
+func (s *qrBatchDownloadStore) add(path string, userID int) (string, time.Time, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	expiresAt := time.Now().Add(qrBatchDownloadTTL)
+
+	s.mu.Lock()
+	s.files[token] = qrBatchDownload{path: path, userID: userID, expiresAt: expiresAt}
+	s.mu.Unlock()
+
+	time.AfterFunc(qrBatchDownloadTTL, func() { s.remove(token) })
+	return token, expiresAt, nil
+}
+
+// get returns the download for token, if it hasn't expired.
+func (s *qrBatchDownloadStore) get(token string) (qrBatchDownload, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.files[token]
+	if !ok || time.Now().After(d.expiresAt) {
+		return qrBatchDownload{}, false
+	}
+	return d, true
+}
+
+func (s *qrBatchDownloadStore) remove(token string) {
+	s.mu.Lock()
+	d, ok := s.files[token]
+	delete(s.files, token)
+	s.mu.Unlock()
+	if ok {
+		if err := os.Remove(d.path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error removing batch download %s: %v", d.path, err)
+		}
+	}
+}
+
+// qrBatchStreamHandler renders QR codes for a large batch of links into a
+// temporary ZIP, reporting progress as server-sent events. It takes the same
+// body as qrBatchHandler. Problems with the request are answered with a JSON
+// error as usual; once rendering starts, the stream has a progress event per
+// code, then either a done event with a download link valid for
+// qrBatchDownloadTTL or an error event. Rendering stops if the client
+// disconnects.
+func qrBatchStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req qrBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isBodyTooLarge(err) {
+			respondError(w, r, http.StatusRequestEntityTooLarge, errCodeBodyTooLarge, "Request body too large")
+			return
+		}
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid JSON body")
+		return
+	}
+
+	if len(req.Hashes) == 0 {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "No hashes given")
+		return
+	}
+	if len(req.Hashes) > maxQRBatchStreamSize {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, fmt.Sprintf("At most %d hashes per batch", maxQRBatchStreamSize))
+		return
+	}
+
+	opts, err := batchQROptions(req)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, err.Error())
+		return
+	}
+
+	var urls []*database.URL
+	var missing []string
+	for _, h := range req.Hashes {
+		url, err := lookupURL(h)
+		if err != nil {
+			missing = append(missing, h)
+			continue
+		}
+		urls = append(urls, url)
+	}
+	if len(missing) > 0 {
+		respondError(w, r, http.StatusNotFound, errCodeNotFound, "Unknown hashes: "+strings.Join(missing, ", "))
+		return
+	}
+
+	f, err := os.CreateTemp("", "qr-batch-*.zip")
+	if err != nil {
+		log.Printf("Error creating batch file: %v", err)
+		respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Error generating QR codes")
+		return
+	}
+	kept := false
+	defer func() {
+		if !kept {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	events, ok := newSSEWriter(w)
+	if !ok {
+		respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Streaming is not supported")
+		return
+	}
+	fail := func(message string) {
+		events.send("error", errorDetail{Code: errCodeInternal, Message: message})
+	}
+
+	zw := zip.NewWriter(f)
+	for i, url := range urls {
+		if r.Context().Err() != nil {
+			return
+		}
+
+		png, err := qrgen.PNG(qrContentFor(url), opts)
+		if err != nil {
+			fail("Error generating QR code for " + url.ShortHash)
+			return
+		}
+		entry, err := zw.Create(url.ShortHash + ".png")
+		if err == nil {
+			_, err = entry.Write(png)
+		}
+		if err != nil {
+			log.Printf("Error writing batch file %s: %v", f.Name(), err)
+			fail("Error writing the archive")
+			return
+		}
+
+		if err := events.send("progress", qrBatchProgress{Generated: i + 1, Total: len(urls)}); err != nil {
+			return
+		}
+	}
+
+	err = zw.Close()
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		log.Printf("Error writing batch file %s: %v", f.Name(), err)
+		fail("Error writing the archive")
+		return
+	}
+
+	userID, _, _ := auth.GetUserFromSession(r)
+	token, expiresAt, err := qrBatchDownloads.add(f.Name(), userID)
+	if err != nil {
+		log.Printf("Error creating download token: %v", err)
+		fail("Error storing the archive")
+		return
+	}
+	kept = true
+
+	events.send("done", qrBatchDone{
+		DownloadURL: "/api/v1/qr/batch/download/" + token,
+		ExpiresAt:   expiresAt,
+	})
+}
+
+// qrBatchDownloadHandler serves GET /api/v1/qr/batch/download/{token}, the
+// ZIP of a streamed batch. Only the user who requested the batch can
+// download it, any number of times until it expires.
+func qrBatchDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	token := strings.TrimPrefix(r.URL.Path, "/api/v1/qr/batch/download/")
+	userID, _, _ := auth.GetUserFromSession(r)
+	download, ok := qrBatchDownloads.get(token)
+	if !ok || download.userID != userID {
+		respondError(w, r, http.StatusNotFound, errCodeNotFound, "Download not found or expired")
+		return
+	}
+
+	f, err := os.Open(download.path)
+	if err != nil {
+		respondError(w, r, http.StatusNotFound, errCodeNotFound, "Download not found or expired")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		log.Printf("Error reading batch file %s: %v", download.path, err)
+		respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Error reading the archive")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="qr-codes.zip"`)
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeContent(w, r, "qr-codes.zip", info.ModTime(), f)
+}
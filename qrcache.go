@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"qr-linker/cache"
+	"qr-linker/database"
+	"qr-linker/qrgen"
+)
+
+// qrCacheVersion is part of every QR image's ETag and of the qrImageCache
+// keys. Bumping it at /admin/qr-cache makes clients holding an ETag download
+// the image again and renders every code afresh. It starts at the server's
+// start time, so a restart, e.g. after changing BASE_URL, bumps it too.
+var qrCacheVersion atomic.Int64
+
+// qrImageCache holds rendered canonical QR images, /qr/{hash} without
+// parameters, keyed by qrImageKey. The key includes the encoded content, so
+// edits that change it, such as moving a link to another domain, miss the
+// cache rather than needing to invalidate it.
+var qrImageCache *cache.TTL[string, []byte]
+
+// qrImageCacheSize is the maximum number of cached QR images
+// (QR_CACHE_SIZE). Entries expire after qrImageCacheTTL.
+var qrImageCacheSize = 1000
+
+const qrImageCacheTTL = time.Hour
+
+// qrPrewarming is set while a pre-warm started from /admin/qr-cache runs.
+var qrPrewarming atomic.Bool
+
+// errPrewarmFull stops a pre-warm once the cache is full.
+var errPrewarmFull = errors.New("QR cache is full")
+
+func qrImageKey(format qrgen.Format, content string) string {
+	return fmt.Sprintf("%d|%s|%s", qrCacheVersion.Load(), format, content)
+}
+
+// qrETag returns the ETag for a QR image under the current cache version.
+func qrETag(img []byte) string {
+	return fmt.Sprintf(`"v%d-%x"`, qrCacheVersion.Load(), sha256.Sum256(img))
+}
+
+// etagMatches reports whether an If-None-Match header matches etag. The
+// comparison is weak, as RFC 9110 requires for If-None-Match: gzipMiddleware
+// marks the ETags of compressed responses weak, and clients send them back
+// with the W/ prefix.
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// renderQR renders content as a QR image in format.
+func renderQR(content string, format qrgen.Format, opts qrgen.Options) ([]byte, error) {
+	if format == qrgen.FormatSVG {
+		return qrgen.SVG(content, opts)
+	}
+	return qrgen.PNG(content, opts)
+}
+
+// canonicalQR returns the canonical QR image for content, in the default
+// format with the default options, from qrImageCache when it's there.
+func canonicalQR(content string) ([]byte, error) {
+	key := qrImageKey(qrDefaultFormat, content)
+	if img, ok := qrImageCache.Get(key); ok {
+		return img, nil
+	}
+	img, err := renderQR(content, qrDefaultFormat, defaultQROptions())
+	if err != nil {
+		return nil, err
+	}
+	qrImageCache.Set(key, img)
+	return img, nil
+}
+
+// prewarmQRCache renders the canonical QR image of each link into
+// qrImageCache, up to its size, oldest links first.
+func prewarmQRCache() {
+	defer qrPrewarming.Store(false)
+
+	start := time.Now()
+	rendered := 0
+	err := db.EachURL(func(url database.URL) error {
+		if rendered >= qrImageCacheSize {
+			return errPrewarmFull
+		}
+		if _, err := canonicalQR(qrContentFor(&url)); err != nil {
+			log.Printf("Error pre-warming QR code of %s: %v", url.ShortHash, err)
+			return nil
+		}
+		rendered++
+		return nil
+	})
+	if err != nil && !errors.Is(err, errPrewarmFull) {
+		log.Printf("Error pre-warming QR cache: %v", err)
+	}
+	log.Printf("Pre-warmed %d QR codes in %s", rendered, time.Since(start).Round(time.Millisecond))
+}
+
+type qrCacheResponse struct {
+	Version    int64 `json:"version"`
+	Prewarming bool  `json:"prewarming"`
+}
+
+// qrCacheHandler serves /admin/qr-cache. GET reports the cache version;
+// POST bumps it, dropping every cached image, and with prewarm=1 renders the
+// links' codes again in the background.
+func qrCacheHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		prewarm := r.FormValue("prewarm")
+		if prewarm != "" && prewarm != "0" && prewarm != "1" {
+			respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "prewarm must be 1 or 0")
+			return
+		}
+
+		version := qrCacheVersion.Add(1)
+		qrImageCache.Clear()
+		log.Printf("QR cache version bumped to %d", version)
+		recordAudit(r, database.AuditQRCacheBumped, fmt.Sprintf("version %d", version))
+
+		if prewarm == "1" && qrPrewarming.CompareAndSwap(false, true) {
+			go prewarmQRCache()
+		}
+	default:
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(qrCacheResponse{
+		Version:    qrCacheVersion.Load(),
+		Prewarming: qrPrewarming.Load(),
+	})
+}
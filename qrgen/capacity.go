@@ -0,0 +1,142 @@
+package qrgen
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// recoveryLevel is the error correction level every code is rendered with.
+// Medium recovers from about 15% damage.
+const recoveryLevel = qrcode.Medium
+
+// capacity is how much content the largest QR code (version 40) holds in
+// each encoding mode.
+type capacity struct {
+	numeric      int
+	alphanumeric int
+	bytes        int
+}
+
+var capacities = map[qrcode.RecoveryLevel]capacity{
+	qrcode.Low:     {numeric: 7089, alphanumeric: 4296, bytes: 2953},
+	qrcode.Medium:  {numeric: 5596, alphanumeric: 3391, bytes: 2331},
+	qrcode.High:    {numeric: 3993, alphanumeric: 2420, bytes: 1663},
+	qrcode.Highest: {numeric: 3057, alphanumeric: 1852, bytes: 1273},
+}
+
+// alphanumericChars are the characters of the QR alphanumeric mode, which
+// packs two of them into 11 bits.
+const alphanumericChars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// ErrContentEmpty is returned for empty content, which can't be encoded.
+var ErrContentEmpty = errors.New("content is empty")
+
+// ContentTooLargeError reports content that doesn't fit in a QR code. Unit
+// names what Length and Limit count: digits, characters or bytes, depending
+// on how the content is encoded.
+type ContentTooLargeError struct {
+	Length int
+	Limit  int
+	Unit   string
+}
+
+func (e *ContentTooLargeError) Error() string {
+	return fmt.Sprintf("content is %d %s, more than the %d a QR code can hold", e.Length, e.Unit, e.Limit)
+}
+
+// ValidateContent checks content can be encoded at the error correction
+// level codes are rendered with. Content made only of digits, or only of
+// alphanumeric-mode characters, is checked against the larger limit of that
+// mode; other content against the byte limit.
+func ValidateContent(content string) error {
+	return validateContent(content, recoveryLevel)
+}
+
+func validateContent(content string, level qrcode.RecoveryLevel) error {
+	if content == "" {
+		return ErrContentEmpty
+	}
+
+	c := capacities[level]
+	switch {
+	case isNumeric(content):
+		if len(content) > c.numeric {
+			return &ContentTooLargeError{Length: len(content), Limit: c.numeric, Unit: "digits"}
+		}
+	case isAlphanumeric(content):
+		if len(content) > c.alphanumeric {
+			return &ContentTooLargeError{Length: len(content), Limit: c.alphanumeric, Unit: "characters"}
+		}
+	case len(content) > c.bytes:
+		// The encoder can pack runs of digits or capitals more tightly
+		// than bytes, so longer mixed content may still fit. Only reject
+		// it here when it couldn't even if every character were packed
+		// in its tightest mode; the encoder has the final say otherwise.
+		if minBits(content)+minSegmentHeader > float64(dataBits(c)) {
+			return &ContentTooLargeError{Length: len(content), Limit: c.bytes, Unit: "bytes"}
+		}
+	}
+	return nil
+}
+
+// newQRCode encodes content, reporting content that doesn't fit as a
+// ContentTooLargeError rather than the encoder's bare error.
+func newQRCode(content string) (*qrcode.QRCode, error) {
+	if err := ValidateContent(content); err != nil {
+		return nil, err
+	}
+	qrCode, err := qrcode.New(content, recoveryLevel)
+	if err != nil {
+		return nil, &ContentTooLargeError{Length: len(content), Limit: capacities[recoveryLevel].bytes, Unit: "bytes"}
+	}
+	return qrCode, nil
+}
+
+func isNumeric(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlphanumeric(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(alphanumericChars, s[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// minSegmentHeader is the smallest mode and length header a version 40
+// segment has: 4 mode bits and a 13-bit alphanumeric count.
+const minSegmentHeader = 17
+
+// dataBits is the number of data bits in a version 40 code. Each level holds
+// three codewords more than its byte limit, which go to the segment header.
+func dataBits(c capacity) int {
+	return (c.bytes + 3) * 8
+}
+
+// minBits is the fewest data bits content could take: each digit in
+// numeric mode, each other alphanumeric character in alphanumeric mode and
+// everything else as bytes, ignoring the headers of the segments.
+func minBits(content string) float64 {
+	var bits float64
+	for i := 0; i < len(content); i++ {
+		switch {
+		case content[i] >= '0' && content[i] <= '9':
+			bits += 10.0 / 3
+		case strings.IndexByte(alphanumericChars, content[i]) >= 0:
+			bits += 5.5
+		default:
+			bits += 8
+		}
+	}
+	return bits
+}
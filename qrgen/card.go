@@ -0,0 +1,214 @@
+package qrgen
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Card dimension limits, in pixels.
+const (
+	MinCardWidth = 200
+	MaxCardWidth = 2000
+)
+
+// Frame is a decoration drawn around the QR code of a card.
+type Frame string
+
+const (
+	FrameNone   Frame = "none"
+	FrameScanMe Frame = "scanme"
+)
+
+// ParseFrame validates a frame name, defaulting to none when empty.
+func ParseFrame(s string) (Frame, error) {
+	switch Frame(s) {
+	case "", FrameNone:
+		return FrameNone, nil
+	case FrameScanMe:
+		return FrameScanMe, nil
+	}
+	return "", fmt.Errorf("invalid frame %q (use scanme or none)", s)
+}
+
+// DefaultFrameCaption is the banner text of a scanme frame.
+const DefaultFrameCaption = "SCAN ME"
+
+// MaxFrameCaptionLength caps the banner text of a frame, in characters.
+const MaxFrameCaptionLength = 32
+
+// CleanFrameCaption prepares user-supplied banner text: control characters
+// are dropped, runs of spaces collapsed and the result trimmed. An empty
+// result gives DefaultFrameCaption.
+func CleanFrameCaption(s string) (string, error) {
+	if !utf8.ValidString(s) {
+		return "", errors.New("caption must be valid UTF-8")
+	}
+	s = strings.Join(strings.Fields(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s)), " ")
+
+	if s == "" {
+		return DefaultFrameCaption, nil
+	}
+	if utf8.RuneCountInString(s) > MaxFrameCaptionLength {
+		return "", fmt.Errorf("caption must be at most %d characters", MaxFrameCaptionLength)
+	}
+	return s, nil
+}
+
+// CardOptions describes a share card: a QR code with a caption underneath.
+// A zero Height sizes the card to fit the QR code and caption.
+type CardOptions struct {
+	QR     Options
+	Width  int
+	Height int
+	// Frame draws a border in the foreground colour around the code, joined
+	// to a banner showing FrameCaption above the caption.
+	Frame        Frame
+	FrameCaption string
+}
+
+// ErrCardTooSmall is returned by CardPNG when the card leaves no room for the
+// code once the caption and frame are laid out.
+var ErrCardTooSmall = errors.New("card is too small for a QR code and caption")
+
+// ValidateCardSize checks card dimensions against the supported limits.
+func ValidateCardSize(width, height int) error {
+	if width < MinCardWidth || width > MaxCardWidth {
+		return fmt.Errorf("width must be between %d and %d", MinCardWidth, MaxCardWidth)
+	}
+	if height != 0 && (height < MinCardWidth || height > MaxCardWidth) {
+		return fmt.Errorf("height must be between %d and %d", MinCardWidth, MaxCardWidth)
+	}
+	return nil
+}
+
+// CardPNG renders content as a QR code on a white card with caption drawn
+// centred below it, for printing on flyers.
+func CardPNG(content, caption string, opts CardOptions) ([]byte, error) {
+	if err := ValidateCardSize(opts.Width, opts.Height); err != nil {
+		return nil, err
+	}
+
+	padding := opts.Width / 20
+	fontSize := float64(opts.Width) / 16
+	captionHeight := int(fontSize*1.5) + padding
+
+	// A frame's border surrounds the code and its banner sits below it.
+	framed := opts.Frame == FrameScanMe
+	border, bannerHeight := 0, 0
+	if framed {
+		border = max(opts.Width/60, 2)
+		bannerHeight = int(fontSize * 1.8)
+		if opts.FrameCaption == "" {
+			opts.FrameCaption = DefaultFrameCaption
+		}
+	}
+
+	height := opts.Height
+	if height == 0 {
+		height = opts.Width + captionHeight + bannerHeight
+	}
+
+	qrSize := min(opts.Width, height-captionHeight-bannerHeight) - 2*padding - 2*border
+	if qrSize <= 0 {
+		return nil, ErrCardTooSmall
+	}
+
+	qrOpts := opts.QR
+	qrOpts.Size = qrSize
+	code, err := Image(content, qrOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, opts.Width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	qrX := (opts.Width - code.Bounds().Dx()) / 2
+	qrY := padding + border
+	codeRect := code.Bounds().Add(image.Pt(qrX, qrY))
+	bottom := codeRect.Max.Y
+
+	if framed {
+		fg, bg := opts.QR.colors()
+		frameRect := image.Rect(codeRect.Min.X-border, codeRect.Min.Y-border, codeRect.Max.X+border, codeRect.Max.Y+border+bannerHeight)
+		draw.Draw(img, frameRect, image.NewUniform(fg), image.Point{}, draw.Src)
+		bottom = frameRect.Max.Y
+
+		// The banner text is in the background colour, on the border.
+		bannerTop := codeRect.Max.Y + border
+		if err := drawCentred(img, opts.FrameCaption, gobold.TTF, fontSize, bg, frameRect.Min.X, frameRect.Max.X, bannerTop, bottom); err != nil {
+			return nil, err
+		}
+	}
+	draw.Draw(img, codeRect, code, code.Bounds().Min, draw.Src)
+
+	if err := drawCentred(img, caption, goregular.TTF, fontSize, color.Black, padding, opts.Width-padding, bottom, height); err != nil {
+		return nil, err
+	}
+
+	return encodePNG(img, opts.QR.Compression)
+}
+
+// drawCentred draws text centred in the box from left to right and top to
+// bottom, at size or smaller so it fits the width.
+func drawCentred(img draw.Image, text string, ttf []byte, size float64, c color.Color, left, right, top, bottom int) error {
+	face, err := captionFace(text, ttf, size, right-left)
+	if err != nil {
+		return err
+	}
+	defer face.Close()
+
+	drawer := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(c),
+		Face: face,
+	}
+	textWidth := drawer.MeasureString(text).Ceil()
+	baseline := top + (bottom-top+face.Metrics().Ascent.Ceil())/2
+	drawer.Dot = fixed.P(left+(right-left-textWidth)/2, baseline)
+	drawer.DrawString(text)
+	return nil
+}
+
+// captionFace returns a face of the TrueType font ttf at size, shrunk as
+// needed so the caption fits within maxWidth.
+func captionFace(caption string, ttf []byte, size float64, maxWidth int) (font.Face, error) {
+	parsed, err := opentype.Parse(ttf)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		face, err := opentype.NewFace(parsed, &opentype.FaceOptions{
+			Size:    size,
+			DPI:     72,
+			Hinting: font.HintingFull,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if font.MeasureString(face, caption).Ceil() <= maxWidth || size <= 8 {
+			return face, nil
+		}
+		face.Close()
+		size *= 0.9
+	}
+}
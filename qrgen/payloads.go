@@ -0,0 +1,168 @@
+package qrgen
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/mail"
+	"strconv"
+	"strings"
+)
+
+// maxPayloadField caps the length of each free-text payload field, keeping
+// the encoded content well within what a scannable code can hold.
+const maxPayloadField = 200
+
+// WiFi describes a network for a join-network QR code.
+type WiFi struct {
+	SSID     string `json:"ssid"`
+	Password string `json:"password"`
+	// Encryption is WPA, WEP or nopass. Empty means WPA when a password is
+	// given and nopass otherwise.
+	Encryption string `json:"encryption"`
+	Hidden     bool   `json:"hidden"`
+}
+
+// Payload validates the network and returns its WIFI: payload, e.g.
+// WIFI:T:WPA;S:office;P:secret123;;
+func (w WiFi) Payload() (string, error) {
+	if w.SSID == "" {
+		return "", errors.New("ssid is required")
+	}
+	if len(w.SSID) > 32 {
+		return "", errors.New("ssid must be at most 32 bytes")
+	}
+
+	encryption := strings.ToUpper(w.Encryption)
+	if encryption == "" {
+		encryption = "WPA"
+		if w.Password == "" {
+			encryption = "NOPASS"
+		}
+	}
+
+	switch encryption {
+	case "WPA":
+		if len(w.Password) < 8 || len(w.Password) > 63 {
+			return "", errors.New("WPA passwords must be 8 to 63 characters")
+		}
+	case "WEP":
+		if w.Password == "" {
+			return "", errors.New("password is required for WEP")
+		}
+	case "NOPASS":
+		if w.Password != "" {
+			return "", errors.New("password must be empty for an open network")
+		}
+		encryption = "nopass"
+	default:
+		return "", fmt.Errorf("invalid encryption %q (use WPA, WEP or nopass)", w.Encryption)
+	}
+
+	var b strings.Builder
+	b.WriteString("WIFI:T:" + encryption + ";S:" + escapeWiFi(w.SSID) + ";")
+	if w.Password != "" {
+		b.WriteString("P:" + escapeWiFi(w.Password) + ";")
+	}
+	if w.Hidden {
+		b.WriteString("H:true;")
+	}
+	b.WriteString(";")
+	return b.String(), nil
+}
+
+var wifiEscaper = strings.NewReplacer(`\`, `\\`, `;`, `\;`, `,`, `\,`, `:`, `\:`, `"`, `\"`)
+
+func escapeWiFi(s string) string {
+	return wifiEscaper.Replace(s)
+}
+
+// VCard describes a contact for a vCard 3.0 QR code.
+type VCard struct {
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name"`
+	Organization string `json:"organization"`
+	Title        string `json:"title"`
+	Phone        string `json:"phone"`
+	Email        string `json:"email"`
+	URL          string `json:"url"`
+	Note         string `json:"note"`
+}
+
+// Payload validates the contact and returns it as a vCard 3.0 document.
+func (v VCard) Payload() (string, error) {
+	if v.FirstName == "" && v.LastName == "" {
+		return "", errors.New("first_name or last_name is required")
+	}
+
+	fields := []struct{ name, value string }{
+		{"first_name", v.FirstName}, {"last_name", v.LastName}, {"organization", v.Organization},
+		{"title", v.Title}, {"phone", v.Phone}, {"email", v.Email}, {"url", v.URL}, {"note", v.Note},
+	}
+	for _, f := range fields {
+		if len(f.value) > maxPayloadField {
+			return "", fmt.Errorf("%s must be at most %d characters", f.name, maxPayloadField)
+		}
+	}
+	if strings.ContainsAny(v.Phone, "\r\n") || strings.ContainsAny(v.URL, "\r\n") {
+		return "", errors.New("phone and url must be a single line")
+	}
+	if v.Email != "" {
+		addr, err := mail.ParseAddress(v.Email)
+		if err != nil {
+			return "", fmt.Errorf("invalid email %q", v.Email)
+		}
+		v.Email = addr.Address
+	}
+
+	lines := []string{
+		"BEGIN:VCARD",
+		"VERSION:3.0",
+		"N:" + escapeVCard(v.LastName) + ";" + escapeVCard(v.FirstName) + ";;;",
+		"FN:" + escapeVCard(strings.TrimSpace(v.FirstName+" "+v.LastName)),
+	}
+	optional := []struct{ prop, value string }{
+		{"ORG", escapeVCard(v.Organization)},
+		{"TITLE", escapeVCard(v.Title)},
+		{"TEL", v.Phone},
+		{"EMAIL", v.Email},
+		{"URL", v.URL},
+		{"NOTE", escapeVCard(v.Note)},
+	}
+	for _, o := range optional {
+		if o.value != "" {
+			lines = append(lines, o.prop+":"+o.value)
+		}
+	}
+	lines = append(lines, "END:VCARD")
+
+	// vCard lines end in CRLF.
+	return strings.Join(lines, "\r\n") + "\r\n", nil
+}
+
+var vcardEscaper = strings.NewReplacer(`\`, `\\`, `;`, `\;`, `,`, `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escapeVCard(s string) string {
+	return vcardEscaper.Replace(s)
+}
+
+// Geo is a location for a geo: URI QR code.
+type Geo struct {
+	Lat *float64 `json:"lat"`
+	Lon *float64 `json:"lon"`
+}
+
+// Payload validates the coordinates and returns the geo: URI, e.g.
+// geo:51.5007,-0.1246
+func (g Geo) Payload() (string, error) {
+	if g.Lat == nil || g.Lon == nil {
+		return "", errors.New("lat and lon are required")
+	}
+	if math.IsNaN(*g.Lat) || *g.Lat < -90 || *g.Lat > 90 {
+		return "", errors.New("lat must be between -90 and 90")
+	}
+	if math.IsNaN(*g.Lon) || *g.Lon < -180 || *g.Lon > 180 {
+		return "", errors.New("lon must be between -180 and 180")
+	}
+	return "geo:" + strconv.FormatFloat(*g.Lat, 'f', -1, 64) + "," + strconv.FormatFloat(*g.Lon, 'f', -1, 64), nil
+}
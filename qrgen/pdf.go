@@ -0,0 +1,245 @@
+package qrgen
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// PageSize is the paper size of a PDF sheet.
+type PageSize string
+
+const (
+	PageA4     PageSize = "a4"
+	PageA5     PageSize = "a5"
+	PageLetter PageSize = "letter"
+)
+
+// pageSizes maps each page size to its fpdf name.
+var pageSizes = map[PageSize]string{
+	PageA4:     "A4",
+	PageA5:     "A5",
+	PageLetter: "Letter",
+}
+
+// ParsePageSize validates a page size name, defaulting to A4 when empty.
+func ParsePageSize(s string) (PageSize, error) {
+	if s == "" {
+		return PageA4, nil
+	}
+	if _, ok := pageSizes[PageSize(strings.ToLower(s))]; ok {
+		return PageSize(strings.ToLower(s)), nil
+	}
+	return "", fmt.Errorf("invalid page size %q (use a4, a5 or letter)", s)
+}
+
+// MaxSheetGrid bounds the columns and rows of cards on a sheet.
+const MaxSheetGrid = 8
+
+// Sheet layout, in millimetres. minSheetQR is the smallest code worth
+// printing; smaller ones are hard to scan from a distance.
+const (
+	sheetMargin  = 10.0
+	sheetPadding = 4.0
+	minSheetQR   = 15.0
+	mmPerPoint   = 25.4 / 72
+)
+
+// SheetCard is one card on a PDF sheet: a QR code for Content with an
+// optional Title above the Caption underneath it.
+type SheetCard struct {
+	Content string
+	Title   string
+	Caption string
+}
+
+// SheetOptions describes a PDF sheet of cards laid out in a grid of Columns
+// by Rows on each page. Size and Compression of QR don't apply, as codes
+// are drawn as vectors.
+type SheetOptions struct {
+	QR       Options
+	PageSize PageSize
+	Columns  int
+	Rows     int
+}
+
+// sheetLayout holds the dimensions, in millimetres, of a sheet's grid.
+type sheetLayout struct {
+	cellWidth, cellHeight float64
+	qrSide                float64
+	fontSize, lineHeight  float64
+}
+
+// layout works out the grid dimensions for opts on a page of the given size.
+func (opts SheetOptions) layout(pageWidth, pageHeight float64) (sheetLayout, error) {
+	if opts.Columns < 1 || opts.Columns > MaxSheetGrid || opts.Rows < 1 || opts.Rows > MaxSheetGrid {
+		return sheetLayout{}, fmt.Errorf("columns and rows must be between 1 and %d", MaxSheetGrid)
+	}
+
+	var l sheetLayout
+	l.cellWidth = (pageWidth - 2*sheetMargin) / float64(opts.Columns)
+	l.cellHeight = (pageHeight - 2*sheetMargin) / float64(opts.Rows)
+
+	// Text is sized to the cell; the caption gets a line and the title one
+	// more above the code.
+	l.fontSize = min(16, l.cellWidth/8/mmPerPoint)
+	l.lineHeight = l.fontSize * mmPerPoint * 1.4
+	l.qrSide = min(l.cellWidth, l.cellHeight-2*l.lineHeight) - 2*sheetPadding
+	if l.qrSide < minSheetQR {
+		return l, fmt.Errorf("a %dx%d grid leaves QR codes too small to scan on %s paper", opts.Columns, opts.Rows, opts.PageSize)
+	}
+	return l, nil
+}
+
+// newSheet returns an empty PDF with the page size of opts.
+func newSheet(opts SheetOptions) (*fpdf.Fpdf, error) {
+	pageName, ok := pageSizes[opts.PageSize]
+	if !ok {
+		return nil, fmt.Errorf("invalid page size %q", opts.PageSize)
+	}
+	return fpdf.New("P", "mm", pageName, ""), nil
+}
+
+// ValidateSheetLayout checks that the grid of opts fits its page with codes
+// large enough to scan.
+func ValidateSheetLayout(opts SheetOptions) error {
+	pdf, err := newSheet(opts)
+	if err != nil {
+		return err
+	}
+	_, err = opts.layout(pdf.GetPageSize())
+	return err
+}
+
+// SheetPDF renders cards as a PDF for printing, filling each page's grid
+// left to right, top to bottom. With more than one card per page, light
+// cut lines are drawn between them.
+func SheetPDF(cards []SheetCard, opts SheetOptions) ([]byte, error) {
+	pdf, err := newSheet(opts)
+	if err != nil {
+		return nil, err
+	}
+	l, err := opts.layout(pdf.GetPageSize())
+	if err != nil {
+		return nil, err
+	}
+
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.AddUTF8FontFromBytes("goregular", "", goregular.TTF)
+
+	cellWidth, cellHeight := l.cellWidth, l.cellHeight
+	qrSide, fontSize, lineHeight := l.qrSide, l.fontSize, l.lineHeight
+
+	perPage := opts.Columns * opts.Rows
+	for i, card := range cards {
+		if i%perPage == 0 {
+			pdf.AddPage()
+			if perPage > 1 {
+				drawCutLines(pdf, opts.Columns, opts.Rows, cellWidth, cellHeight)
+			}
+		}
+
+		slot := i % perPage
+		x := sheetMargin + float64(slot%opts.Columns)*cellWidth
+		y := sheetMargin + float64(slot/opts.Columns)*cellHeight
+
+		// Centre the code and its text lines vertically in the cell.
+		top := y + (cellHeight-qrSide-2*lineHeight)/2
+		if card.Title != "" {
+			drawCentredText(pdf, card.Title, x, top+lineHeight/2, cellWidth, fontSize)
+		}
+		if err := drawQR(pdf, card.Content, x+(cellWidth-qrSide)/2, top+lineHeight, qrSide, opts.QR); err != nil {
+			return nil, err
+		}
+		drawCentredText(pdf, card.Caption, x, top+lineHeight+qrSide+lineHeight/2, cellWidth, fontSize)
+	}
+
+	var b bytes.Buffer
+	if err := pdf.Output(&b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// drawQR draws content as a QR code side millimetres wide at (x, y).
+func drawQR(pdf *fpdf.Fpdf, content string, x, y, side float64, opts Options) error {
+	qrCode, err := newQRCode(content)
+	if err != nil {
+		return err
+	}
+	qrCode.DisableBorder = !opts.Border
+	bitmap := qrCode.Bitmap()
+	modules := len(bitmap)
+	module := side / float64(modules)
+
+	inFinder := finderTest(modules, opts.Border)
+	fg, bg := opts.colors()
+
+	setFill(pdf, bg)
+	pdf.Rect(x, y, side, side, "F")
+
+	setFill(pdf, fg)
+	for my, row := range bitmap {
+		for mx := 0; mx < len(row); mx++ {
+			if !row[mx] {
+				continue
+			}
+			mxPos, myPos := x+float64(mx)*module, y+float64(my)*module
+			if opts.Style == StyleDots && !inFinder(mx, my) {
+				pdf.Circle(mxPos+module/2, myPos+module/2, module*0.45, "F")
+				continue
+			}
+
+			// Draw horizontal runs of square modules as one rectangle.
+			run := 1
+			for mx+run < len(row) && row[mx+run] && (opts.Style != StyleDots || inFinder(mx+run, my)) {
+				run++
+			}
+			pdf.Rect(mxPos, myPos, float64(run)*module, module, "F")
+			mx += run - 1
+		}
+	}
+	return nil
+}
+
+// drawCentredText writes text centred in a cell width wide, with its
+// vertical middle at y, shrinking the font as needed so it fits.
+func drawCentredText(pdf *fpdf.Fpdf, text string, x, y, width, size float64) {
+	maxWidth := width - 2*sheetPadding
+	pdf.SetFont("goregular", "", size)
+	for pdf.GetStringWidth(text) > maxWidth && size > 6 {
+		size *= 0.9
+		pdf.SetFont("goregular", "", size)
+	}
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetXY(x+sheetPadding, y-size*mmPerPoint/2)
+	pdf.CellFormat(maxWidth, size*mmPerPoint, text, "", 0, "C", false, 0, "")
+}
+
+// drawCutLines draws light grey lines between the cells of a page.
+func drawCutLines(pdf *fpdf.Fpdf, columns, rows int, cellWidth, cellHeight float64) {
+	pdf.SetDrawColor(200, 200, 200)
+	pdf.SetLineWidth(0.2)
+	pdf.SetDashPattern([]float64{1, 1}, 0)
+	right := sheetMargin + float64(columns)*cellWidth
+	bottom := sheetMargin + float64(rows)*cellHeight
+	for c := 1; c < columns; c++ {
+		x := sheetMargin + float64(c)*cellWidth
+		pdf.Line(x, sheetMargin, x, bottom)
+	}
+	for r := 1; r < rows; r++ {
+		y := sheetMargin + float64(r)*cellHeight
+		pdf.Line(sheetMargin, y, right, y)
+	}
+	pdf.SetDashPattern([]float64{}, 0)
+}
+
+func setFill(pdf *fpdf.Fpdf, c color.Color) {
+	r, g, b, _ := c.RGBA()
+	pdf.SetFillColor(int(r>>8), int(g>>8), int(b>>8))
+}
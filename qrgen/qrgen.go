@@ -0,0 +1,259 @@
+// Package qrgen renders QR code images for short links.
+package qrgen
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Style controls how individual QR modules are drawn.
+type Style string
+
+const (
+	StyleSquare Style = "square"
+	StyleDots   Style = "dots"
+)
+
+// quietZone is the border width, in modules, that go-qrcode adds around
+// regular symbols.
+const quietZone = 4
+
+// finderSize is the width, in modules, of the three corner finder patterns.
+const finderSize = 7
+
+// MinSize and MaxSize bound the requested image width in pixels.
+const (
+	MinSize = 64
+	MaxSize = 2048
+)
+
+// Options controls QR rendering. Nil Foreground and Background colours
+// default to black on white.
+type Options struct {
+	Size       int
+	Border     bool
+	Style      Style
+	Foreground color.Color
+	Background color.Color
+	// Compression trades CPU for PNG size. Codes are 1-bit images, so the
+	// difference is small: BestCompression is typically 3-6% smaller than
+	// DefaultCompression and BestSpeed 15-25% larger.
+	Compression png.CompressionLevel
+	// DPI, when set, is recorded in the PNG so print software sizes the
+	// image correctly.
+	DPI int
+}
+
+// DefaultOptions returns the standard rendering: a 256px square-module code
+// with a quiet zone, compressed as tightly as possible.
+func DefaultOptions() Options {
+	return Options{
+		Size:        256,
+		Border:      true,
+		Style:       StyleSquare,
+		Compression: png.BestCompression,
+	}
+}
+
+// ParseStyle validates a style name, defaulting to square when empty.
+func ParseStyle(s string) (Style, error) {
+	switch Style(s) {
+	case "", StyleSquare:
+		return StyleSquare, nil
+	case StyleDots:
+		return StyleDots, nil
+	}
+	return "", fmt.Errorf("invalid style %q (use square or dots)", s)
+}
+
+// ValidateSize checks a requested image size is within bounds.
+func ValidateSize(size int) error {
+	if size < MinSize || size > MaxSize {
+		return fmt.Errorf("size must be between %d and %d", MinSize, MaxSize)
+	}
+	return nil
+}
+
+// ParseHexColor parses a colour written as RRGGBB or #RRGGBB.
+func ParseHexColor(s string) (color.Color, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 {
+		return nil, fmt.Errorf("invalid colour %q (use RRGGBB)", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid colour %q (use RRGGBB)", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+func (o Options) colors() (fg, bg color.Color) {
+	fg, bg = color.Black, color.White
+	if o.Foreground != nil {
+		fg = o.Foreground
+	}
+	if o.Background != nil {
+		bg = o.Background
+	}
+	return fg, bg
+}
+
+// Image renders content as a QR code image.
+func Image(content string, opts Options) (image.Image, error) {
+	qrCode, err := newQRCode(content)
+	if err != nil {
+		return nil, err
+	}
+	qrCode.DisableBorder = !opts.Border
+	qrCode.ForegroundColor, qrCode.BackgroundColor = opts.colors()
+
+	if opts.Style == StyleDots {
+		return renderDots(qrCode.Bitmap(), opts), nil
+	}
+	return qrCode.Image(opts.Size), nil
+}
+
+// PNG renders content as a QR code PNG.
+func PNG(content string, opts Options) ([]byte, error) {
+	img, err := Image(content, opts)
+	if err != nil {
+		return nil, err
+	}
+	b, err := encodePNG(img, opts.Compression)
+	if err != nil || opts.DPI <= 0 {
+		return b, err
+	}
+	return withDPI(b, opts.DPI), nil
+}
+
+// MinDPI and MaxDPI bound print resolutions accepted by SizeForPrint.
+const (
+	MinDPI = 72
+	MaxDPI = 1200
+)
+
+// SizeForPrint returns the pixel size needed to print a code physicalMM
+// millimetres wide at dpi, checking the result is within MaxSize.
+func SizeForPrint(dpi int, physicalMM float64) (int, error) {
+	if dpi < MinDPI || dpi > MaxDPI {
+		return 0, fmt.Errorf("dpi must be between %d and %d", MinDPI, MaxDPI)
+	}
+	if physicalMM <= 0 {
+		return 0, fmt.Errorf("physical_mm must be positive")
+	}
+
+	size := int(math.Round(physicalMM / 25.4 * float64(dpi)))
+	if err := ValidateSize(size); err != nil {
+		return 0, fmt.Errorf("%gmm at %d dpi needs %dpx: %w", physicalMM, dpi, size, err)
+	}
+	return size, nil
+}
+
+// withDPI inserts a pHYs chunk recording dpi right after the IHDR chunk of
+// an encoded PNG. Go's encoder doesn't write physical dimensions itself.
+func withDPI(b []byte, dpi int) []byte {
+	// 8-byte signature, then IHDR: length, type, 13 bytes of data, CRC.
+	const ihdrEnd = 8 + 4 + 4 + 13 + 4
+
+	pixelsPerMetre := uint32(math.Round(float64(dpi) / 0.0254))
+	chunk := make([]byte, 4+4+9+4)
+	binary.BigEndian.PutUint32(chunk[0:], 9)
+	copy(chunk[4:], "pHYs")
+	binary.BigEndian.PutUint32(chunk[8:], pixelsPerMetre)
+	binary.BigEndian.PutUint32(chunk[12:], pixelsPerMetre)
+	chunk[16] = 1 // unit: metre
+	binary.BigEndian.PutUint32(chunk[17:], crc32.ChecksumIEEE(chunk[4:17]))
+
+	out := make([]byte, 0, len(b)+len(chunk))
+	out = append(out, b[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, b[ihdrEnd:]...)
+}
+
+// ParseCompression maps a compression setting name to a PNG level.
+func ParseCompression(s string) (png.CompressionLevel, error) {
+	switch s {
+	case "best":
+		return png.BestCompression, nil
+	case "default":
+		return png.DefaultCompression, nil
+	case "speed":
+		return png.BestSpeed, nil
+	}
+	return 0, fmt.Errorf("invalid compression %q (use best, default or speed)", s)
+}
+
+func encodePNG(img image.Image, level png.CompressionLevel) ([]byte, error) {
+	var b bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: level}
+	if err := encoder.Encode(&b, img); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// finderTest returns a function reporting whether the module at (mx, my)
+// of a bitmap modules wide belongs to one of the three finder patterns.
+func finderTest(modules int, border bool) func(mx, my int) bool {
+	offset := 0
+	if border {
+		offset = quietZone
+	}
+	far := modules - 2*offset - finderSize
+
+	return func(mx, my int) bool {
+		x, y := mx-offset, my-offset
+		inX := func(start int) bool { return x >= start && x < start+finderSize }
+		inY := func(start int) bool { return y >= start && y < start+finderSize }
+		return (inX(0) && inY(0)) || (inX(far) && inY(0)) || (inX(0) && inY(far))
+	}
+}
+
+// renderDots draws each dark module as a circle. The finder patterns stay
+// square since many scanners rely on their exact shape.
+func renderDots(bitmap [][]bool, opts Options) image.Image {
+	modules := len(bitmap)
+	size := opts.Size
+	if size < modules {
+		size = modules
+	}
+
+	inFinder := finderTest(modules, opts.Border)
+
+	fg, bg := opts.colors()
+	palette := color.Palette{bg, fg}
+	img := image.NewPaletted(image.Rect(0, 0, size, size), palette)
+
+	scale := float64(size) / float64(modules)
+	radius := 0.45
+	for y := 0; y < size; y++ {
+		fy := float64(y) / scale
+		my := int(fy)
+		for x := 0; x < size; x++ {
+			fx := float64(x) / scale
+			mx := int(fx)
+			if !bitmap[my][mx] {
+				continue
+			}
+
+			if !inFinder(mx, my) {
+				dx := fx - float64(mx) - 0.5
+				dy := fy - float64(my) - 0.5
+				if dx*dx+dy*dy > radius*radius {
+					continue
+				}
+			}
+			img.SetColorIndex(x, y, 1)
+		}
+	}
+
+	return img
+}
@@ -0,0 +1,264 @@
+package qrgen
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/skip2/go-qrcode"
+)
+
+func TestSizeForPrint(t *testing.T) {
+	size, err := SizeForPrint(300, 40)
+	if err != nil || size != 472 {
+		t.Errorf("SizeForPrint(300, 40) = %d, %v, want 472", size, err)
+	}
+
+	for _, tt := range []struct {
+		dpi int
+		mm  float64
+	}{{50, 40}, {300, 0}, {1200, 100}} {
+		if _, err := SizeForPrint(tt.dpi, tt.mm); err == nil {
+			t.Errorf("SizeForPrint(%d, %g) succeeded, want error", tt.dpi, tt.mm)
+		}
+	}
+}
+
+func TestPNGWithDPI(t *testing.T) {
+	opts := DefaultOptions()
+	opts.DPI = 300
+
+	b, err := PNG("https://example.com/abc123", opts)
+	if err != nil {
+		t.Fatalf("PNG: %v", err)
+	}
+	if !bytes.Contains(b, []byte("pHYs")) {
+		t.Error("PNG has no pHYs chunk")
+	}
+	// The decoder verifies chunk CRCs, so this also checks the inserted chunk.
+	if _, err := png.Decode(bytes.NewReader(b)); err != nil {
+		t.Errorf("decoding PNG with DPI: %v", err)
+	}
+}
+
+func TestValidateContent(t *testing.T) {
+	if err := ValidateContent(""); !errors.Is(err, ErrContentEmpty) {
+		t.Errorf("ValidateContent(\"\") = %v, want ErrContentEmpty", err)
+	}
+
+	for level, c := range capacities {
+		for _, tt := range []struct {
+			char  string
+			limit int
+		}{{"7", c.numeric}, {"Q", c.alphanumeric}, {"q", c.bytes}} {
+			fits := strings.Repeat(tt.char, tt.limit)
+			if err := validateContent(fits, level); err != nil {
+				t.Errorf("level %d: %d x %q: %v, want nil", level, tt.limit, tt.char, err)
+			}
+			// The table must agree with the encoder.
+			if _, err := qrcode.New(fits, level); err != nil {
+				t.Errorf("level %d: encoder rejects %d x %q: %v", level, tt.limit, tt.char, err)
+			}
+
+			var tooLarge *ContentTooLargeError
+			err := validateContent(fits+tt.char, level)
+			if !errors.As(err, &tooLarge) || tooLarge.Limit != tt.limit || tooLarge.Length != tt.limit+1 {
+				t.Errorf("level %d: %d x %q: %v, want limit %d", level, tt.limit+1, tt.char, err, tt.limit)
+			}
+		}
+	}
+
+	// Mixed content longer than the byte limit can still fit when most of
+	// it packs tighter than bytes.
+	mixed := strings.Repeat("1", 4000) + "a"
+	if err := ValidateContent(mixed); err != nil {
+		t.Errorf("ValidateContent(mixed) = %v, want nil", err)
+	}
+	if _, err := PNG(mixed, DefaultOptions()); err != nil {
+		t.Errorf("PNG(mixed) = %v, want nil", err)
+	}
+}
+
+func TestPNGContentTooLarge(t *testing.T) {
+	_, err := PNG(strings.Repeat("q", 2332), DefaultOptions())
+	var tooLarge *ContentTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("PNG error = %v, want ContentTooLargeError", err)
+	}
+	if want := "content is 2332 bytes, more than the 2331 a QR code can hold"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+
+	// Mixed content the encoder can't fit either gets the same error.
+	_, err = PNG(strings.Repeat("1", 3000)+strings.Repeat("q", 2000), DefaultOptions())
+	if !errors.As(err, &tooLarge) {
+		t.Errorf("PNG(mixed) error = %v, want ContentTooLargeError", err)
+	}
+}
+
+func TestWiFiPayload(t *testing.T) {
+	got, err := WiFi{SSID: `Cafe;Guest`, Password: "p:ss,word"}.Payload()
+	if want := `WIFI:T:WPA;S:Cafe\;Guest;P:p\:ss\,word;;`; err != nil || got != want {
+		t.Errorf("Payload() = %q, %v, want %q", got, err, want)
+	}
+
+	got, err = WiFi{SSID: "Open", Hidden: true}.Payload()
+	if want := "WIFI:T:nopass;S:Open;H:true;;"; err != nil || got != want {
+		t.Errorf("Payload() = %q, %v, want %q", got, err, want)
+	}
+
+	for _, w := range []WiFi{{}, {SSID: "x", Password: "short"}, {SSID: "x", Encryption: "wpa3"}, {SSID: "x", Password: "secret", Encryption: "nopass"}} {
+		if _, err := w.Payload(); err == nil {
+			t.Errorf("%+v: expected error", w)
+		}
+	}
+}
+
+func TestVCardPayload(t *testing.T) {
+	got, err := VCard{FirstName: "Ada", LastName: "Lovelace", Organization: "Analytical, Ltd", Email: "ada@example.com"}.Payload()
+	want := "BEGIN:VCARD\r\nVERSION:3.0\r\nN:Lovelace;Ada;;;\r\nFN:Ada Lovelace\r\nORG:Analytical\\, Ltd\r\nEMAIL:ada@example.com\r\nEND:VCARD\r\n"
+	if err != nil || got != want {
+		t.Errorf("Payload() = %q, %v, want %q", got, err, want)
+	}
+
+	if _, err := (VCard{Email: "ada@example.com"}).Payload(); err == nil {
+		t.Error("expected error without a name")
+	}
+	if _, err := (VCard{FirstName: "Ada", Email: "not an email"}).Payload(); err == nil {
+		t.Error("expected error for invalid email")
+	}
+}
+
+func TestGeoPayload(t *testing.T) {
+	lat, lon := 51.5007, -0.1246
+	got, err := Geo{Lat: &lat, Lon: &lon}.Payload()
+	if want := "geo:51.5007,-0.1246"; err != nil || got != want {
+		t.Errorf("Payload() = %q, %v, want %q", got, err, want)
+	}
+
+	bad := 91.0
+	if _, err := (Geo{Lat: &bad, Lon: &lon}).Payload(); err == nil {
+		t.Error("expected error for out of range latitude")
+	}
+	if _, err := (Geo{Lat: &lat}).Payload(); err == nil {
+		t.Error("expected error without lon")
+	}
+}
+
+func TestSVG(t *testing.T) {
+	for _, style := range []Style{StyleSquare, StyleDots} {
+		opts := DefaultOptions()
+		opts.Style = style
+		opts.Size = 300
+
+		b, err := SVG("https://example.com/abc123", opts)
+		if err != nil {
+			t.Fatalf("SVG(%s): %v", style, err)
+		}
+
+		var doc struct {
+			Width   string `xml:"width,attr"`
+			ViewBox string `xml:"viewBox,attr"`
+			Path    struct {
+				D string `xml:"d,attr"`
+			} `xml:"path"`
+		}
+		if err := xml.Unmarshal(b, &doc); err != nil {
+			t.Fatalf("SVG(%s) is not valid XML: %v", style, err)
+		}
+		// A version 2 code is 25 modules plus a 4-module quiet zone each side.
+		if doc.Width != "300" || doc.ViewBox != "0 0 33 33" || doc.Path.D == "" {
+			t.Errorf("SVG(%s) = width %q, viewBox %q, path %d bytes", style, doc.Width, doc.ViewBox, len(doc.Path.D))
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if f, err := ParseFormat(""); err != nil || f != FormatPNG {
+		t.Errorf(`ParseFormat("") = %q, %v, want png`, f, err)
+	}
+	if f, err := ParseFormat("svg"); err != nil || f.ContentType() != "image/svg+xml" {
+		t.Errorf(`ParseFormat("svg") = %q, %v`, f, err)
+	}
+	if _, err := ParseFormat("gif"); err == nil {
+		t.Error(`ParseFormat("gif") succeeded, want error`)
+	}
+}
+
+func TestSheetPDF(t *testing.T) {
+	cards := []SheetCard{
+		{Content: "https://example.com/abc123", Title: "Spring Menü", Caption: "example.com/abc123"},
+		{Content: "https://example.com/def456", Caption: "example.com/def456"},
+		{Content: "https://example.com/ghi789", Caption: "example.com/ghi789"},
+	}
+	opts := SheetOptions{QR: DefaultOptions(), PageSize: PageA4, Columns: 2, Rows: 1}
+
+	b, err := SheetPDF(cards, opts)
+	if err != nil {
+		t.Fatalf("SheetPDF: %v", err)
+	}
+	if !bytes.HasPrefix(b, []byte("%PDF-")) {
+		t.Errorf("output doesn't start with a PDF header: %q", b[:min(len(b), 8)])
+	}
+	if pages := bytes.Count(b, []byte("/Type /Page\n")); pages != 2 {
+		t.Errorf("got %d pages, want 2", pages)
+	}
+
+	opts.PageSize, opts.Columns, opts.Rows = PageA5, 8, 8
+	if _, err := SheetPDF(cards, opts); err == nil {
+		t.Error("8x8 grid on A5 succeeded, want codes too small error")
+	}
+	opts.Columns = 0
+	if _, err := SheetPDF(cards, opts); err == nil {
+		t.Error("0 columns succeeded, want error")
+	}
+}
+
+func TestCardTooSmall(t *testing.T) {
+	opts := CardOptions{QR: DefaultOptions(), Width: 2000, Height: 200}
+	if _, err := CardPNG("https://example.com/abc123", "example.com/abc123", opts); !errors.Is(err, ErrCardTooSmall) {
+		t.Errorf("CardPNG(2000x200) error = %v, want ErrCardTooSmall", err)
+	}
+}
+
+func TestCardFrame(t *testing.T) {
+	opts := CardOptions{QR: DefaultOptions(), Width: 400}
+	plain, err := CardPNG("https://example.com/abc123", "example.com/abc123", opts)
+	if err != nil {
+		t.Fatalf("CardPNG: %v", err)
+	}
+
+	opts.Frame = FrameScanMe
+	b, err := CardPNG("https://example.com/abc123", "example.com/abc123", opts)
+	if err != nil {
+		t.Fatalf("CardPNG with frame: %v", err)
+	}
+	framed, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("decoding framed card: %v", err)
+	}
+	plainImg, _ := png.Decode(bytes.NewReader(plain))
+	if framed.Bounds().Dy() <= plainImg.Bounds().Dy() {
+		t.Errorf("framed card is %dpx high, want taller than the plain card's %dpx", framed.Bounds().Dy(), plainImg.Bounds().Dy())
+	}
+
+	for _, tt := range []struct{ raw, want string }{
+		{"", DefaultFrameCaption},
+		{"  Scan\tfor\n the  menu ", "Scan for the menu"},
+	} {
+		if got, err := CleanFrameCaption(tt.raw); err != nil || got != tt.want {
+			t.Errorf("CleanFrameCaption(%q) = %q, %v, want %q", tt.raw, got, err, tt.want)
+		}
+	}
+	for _, raw := range []string{strings.Repeat("x", MaxFrameCaptionLength+1), "bad \xff"} {
+		if _, err := CleanFrameCaption(raw); err == nil {
+			t.Errorf("CleanFrameCaption(%q) succeeded, want error", raw)
+		}
+	}
+	if _, err := ParseFrame("polaroid"); err == nil {
+		t.Error("ParseFrame(polaroid) succeeded, want error")
+	}
+}
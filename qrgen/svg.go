@@ -0,0 +1,93 @@
+package qrgen
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+)
+
+// Format is an output image format.
+type Format string
+
+const (
+	FormatPNG Format = "png"
+	FormatSVG Format = "svg"
+)
+
+// ParseFormat validates a format name, defaulting to PNG when empty.
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case "", FormatPNG:
+		return FormatPNG, nil
+	case FormatSVG:
+		return FormatSVG, nil
+	}
+	return "", fmt.Errorf("invalid format %q (use png or svg)", s)
+}
+
+// ContentType returns the MIME type of images in the format.
+func (f Format) ContentType() string {
+	if f == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// SVG renders content as a QR code SVG, opts.Size pixels wide. Modules are
+// drawn in a viewBox one unit per module, so the image scales without
+// blurring. Compression and DPI don't apply.
+func SVG(content string, opts Options) ([]byte, error) {
+	qrCode, err := newQRCode(content)
+	if err != nil {
+		return nil, err
+	}
+	qrCode.DisableBorder = !opts.Border
+	bitmap := qrCode.Bitmap()
+	modules := len(bitmap)
+
+	inFinder := finderTest(modules, opts.Border)
+
+	fg, bg := opts.colors()
+	dots := opts.Style == StyleDots
+
+	// Square modules are kept sharp; dots need anti-aliasing.
+	rendering := "crispEdges"
+	if dots {
+		rendering = "auto"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="%s">`,
+		opts.Size, opts.Size, modules, modules, rendering)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="%s"/>`, modules, modules, hexColor(bg))
+	fmt.Fprintf(&b, `<path fill="%s" d="`, hexColor(fg))
+
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			if dots && !inFinder(x, y) {
+				// A circle of radius 0.45 centred in the module.
+				fmt.Fprintf(&b, "M%d.05 %d.5a.45 .45 0 1 0 .9 0a.45 .45 0 1 0-.9 0", x, y)
+				continue
+			}
+
+			// Draw horizontal runs of square modules as one rectangle.
+			run := 1
+			for x+run < len(row) && row[x+run] && (!dots || inFinder(x+run, y)) {
+				run++
+			}
+			fmt.Fprintf(&b, "M%d %dh%dv1h-%dz", x, y, run, run)
+			x += run - 1
+		}
+	}
+
+	b.WriteString(`"/></svg>`)
+	return []byte(b.String()), nil
+}
+
+func hexColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
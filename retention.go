@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// clickRetentionDays is how long individual click events are kept. Zero keeps
+// them forever.
+var clickRetentionDays int
+
+// pruneInterval is how often old click events are pruned.
+const pruneInterval = time.Hour
+
+// runClickPruner deletes click events older than the retention period once at
+// startup and then every pruneInterval, until ctx is cancelled.
+func runClickPruner(ctx context.Context) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		pruneClickEvents()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func pruneClickEvents() {
+	before := time.Now().AddDate(0, 0, -clickRetentionDays)
+	n, err := db.PruneClickEvents(before)
+	if err != nil {
+		log.Printf("Error pruning click events: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("Pruned %d click events older than %d days", n, clickRetentionDays)
+	}
+}
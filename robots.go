@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// allowIndexing lets search engines crawl and index short links and the
+// landing page (ALLOW_INDEXING). By default robots.txt disallows everything
+// but the landing page and short link responses are sent with
+// X-Robots-Tag: noindex.
+var allowIndexing bool
+
+// privatePaths are the management UI and API paths robots.txt always
+// disallows, even when indexing is allowed.
+var privatePaths = []string{
+	"/account/", "/admin", "/api/", "/audit", "/beacon/", "/campaigns",
+	"/edit/", "/export/", "/import/", "/login", "/logout", "/qr/",
+	"/reports/", "/setup", "/shorten", "/stats/", "/update",
+}
+
+// robotsTxt returns the robots.txt for the current settings.
+func robotsTxt() string {
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	if allowIndexing {
+		for _, path := range privatePaths {
+			b.WriteString("Disallow: " + path + "\n")
+		}
+		return b.String()
+	}
+	if featureFlags.PublicHome {
+		b.WriteString("Allow: /$\n")
+	}
+	b.WriteString("Disallow: /\n")
+	return b.String()
+}
+
+// robotsHandler serves /robots.txt.
+func robotsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write([]byte(robotsTxt()))
+}
+
+// setNoIndex asks search engines not to index a short link response, unless
+// ALLOW_INDEXING is set.
+func setNoIndex(w http.ResponseWriter) {
+	if !allowIndexing {
+		w.Header().Set("X-Robots-Tag", "noindex")
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+
+	"qr-linker/database"
+)
+
+// clickSampleRate records one in this many clicks as a click event
+// (CLICK_SAMPLE_RATE), for links without their own rate. Every click still
+// increments the link's click count; events carry the rate so the stats can
+// estimate the clicks they stand for.
+var clickSampleRate = 1
+
+// maxClickSampleRate bounds sampling rates, global or per link.
+const maxClickSampleRate = 1000000
+
+// parseClickSampleRate reads a sampling rate, 1 (every click) or more.
+func parseClickSampleRate(raw string) (int, error) {
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 || n > maxClickSampleRate {
+		return 0, fmt.Errorf("must be a whole number from 1 to %d, got %q", maxClickSampleRate, raw)
+	}
+	return n, nil
+}
+
+// sampleRateFor returns the rate at which a link's clicks are recorded as
+// events.
+func sampleRateFor(url *database.URL) int {
+	if url.ClickSampleRate > 0 {
+		return url.ClickSampleRate
+	}
+	return clickSampleRate
+}
+
+// sampleClick reports whether a click should be recorded as an event at one
+// in rate clicks.
+func sampleClick(rate int) bool {
+	return rate <= 1 || rand.IntN(rate) == 0
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"qr-linker/database"
+)
+
+// SCAN_REDIRECT enables two-hop QR redirects: QR codes encode
+// /s/{hash}, which sets a cookie and redirects to /{hash}. A click arriving
+// from that hop without the cookie is a client that doesn't keep cookies,
+// such as a link preview fetcher, and isn't counted. Once counted, repeat
+// visits from the same browser within scanRepeatWindow aren't counted again.
+var scanRepeatWindow = 30 * time.Minute
+
+// scanPendingTTL is how long the cookie set by the first hop lasts. The
+// second hop follows immediately.
+const scanPendingTTL = time.Minute
+
+const (
+	scanPending = "pending"
+	scanCounted = "counted"
+)
+
+// qrContentFor returns the URL a link's QR codes encode: the short URL, its
+// /preview/ page for links that use one, or its /s/ scan URL with
+// SCAN_REDIRECT.
+func qrContentFor(url *database.URL) string {
+	shortURL := shortURLFor(url)
+	switch {
+	case qrOpensPreview(url):
+		return strings.TrimSuffix(shortURL, url.ShortHash) + "preview/" + url.ShortHash
+	case featureFlags.ScanRedirect:
+		return strings.TrimSuffix(shortURL, url.ShortHash) + "s/" + url.ShortHash
+	}
+	return shortURL
+}
+
+func scanCookieName(shortHash string) string {
+	return "qrl_scan_" + shortHash
+}
+
+func setScanCookie(w http.ResponseWriter, shortHash, value string, ttl time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     scanCookieName(shortHash),
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// scanHandler serves /s/{hash}, the first hop of a QR scan. Codes printed
+// while SCAN_REDIRECT was on keep working after it's turned off, as plain
+// redirects.
+func scanHandler(w http.ResponseWriter, r *http.Request) {
+	shortHash := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/s/"), "/")
+	if shortHash == "" {
+		// The mux redirects /s to /s/; treat it as the link with hash "s".
+		redirectHandler(w, r, "s")
+		return
+	}
+	if !featureFlags.ScanRedirect || !clickTracking || wantsJSON(r) {
+		redirectHandler(w, r, shortHash)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate, max-age=0")
+	setNoIndex(w)
+
+	url, ok := resolveLink(w, r, shortHash)
+	if !ok {
+		return
+	}
+
+	// Already counted recently: skip the second hop.
+	if c, err := r.Cookie(scanCookieName(url.ShortHash)); err == nil && c.Value == scanCounted {
+		redirectToDestination(w, r, url)
+		return
+	}
+
+	// The scan's own query string goes along for links that forward it.
+	query := r.URL.Query()
+	if !forwardsQuery(url) {
+		clear(query)
+	}
+	query.Set("scan", "1")
+	setScanCookie(w, url.ShortHash, scanPending, scanPendingTTL)
+	http.Redirect(w, r, "/"+url.ShortHash+"?"+query.Encode(), http.StatusFound)
+}
+
+// countVisit reports whether a redirect should count as a click. Without
+// SCAN_REDIRECT every visit counts; with it, visits are deduplicated per
+// browser as described on scanRepeatWindow.
+func countVisit(w http.ResponseWriter, r *http.Request, url *database.URL) bool {
+	if !featureFlags.ScanRedirect {
+		return true
+	}
+
+	state := ""
+	if c, err := r.Cookie(scanCookieName(url.ShortHash)); err == nil {
+		state = c.Value
+	}
+	if state == scanCounted {
+		return false
+	}
+	if r.URL.Query().Get("scan") == "1" && state != scanPending {
+		return false
+	}
+
+	setScanCookie(w, url.ShortHash, scanCounted, scanRepeatWindow)
+	return true
+}
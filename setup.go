@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"qr-linker/auth"
+	"qr-linker/database"
+)
+
+// minPasswordLength matches the CLI tools' password rule.
+const minPasswordLength = 6
+
+// setupMu serialises first-admin creation so two concurrent setup requests
+// can't both see zero users.
+var setupMu sync.Mutex
+
+// SetupData is passed to the first-run setup template.
+type SetupData struct {
+	Title    string
+	Error    string
+	Username string
+}
+
+// bootstrapAdmin creates the first user from ADMIN_USERNAME and
+// ADMIN_PASSWORD when the database has no users yet. Without them, the
+// /setup page is available until a user exists.
+func bootstrapAdmin() error {
+	count, err := db.CountUsers()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	username, password := strings.TrimSpace(os.Getenv("ADMIN_USERNAME")), os.Getenv("ADMIN_PASSWORD")
+	if username == "" || password == "" {
+		log.Println("No users exist yet: visit /setup to create the first admin")
+		return nil
+	}
+
+	if err := validateNewCredentials(username, password); err != nil {
+		return err
+	}
+	if _, err := createFirstAdmin(username, password); err != nil {
+		return err
+	}
+	log.Printf("Created initial admin user %q from ADMIN_USERNAME", username)
+	return nil
+}
+
+// validateNewCredentials applies the same rules as the CLI tools.
+func validateNewCredentials(username, password string) error {
+	if err := auth.ValidateUsername(username); err != nil {
+		return fmt.Errorf("Invalid username: %w", err)
+	}
+	if len(password) < minPasswordLength {
+		return errors.New("Password must be at least 6 characters long")
+	}
+	if len(password) > maxPasswordLength {
+		return errors.New("Password must be at most 72 characters long")
+	}
+	return nil
+}
+
+func createFirstAdmin(username, password string) (*database.User, error) {
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := db.CreateUser(username, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.RecordAudit(database.AuditEntry{
+		Action: database.AuditUserCreated,
+		Target: user.Username,
+	})
+	if err != nil {
+		log.Printf("Error recording audit entry: %v", err)
+	}
+	return user, nil
+}
+
+// setupHandler serves the one-time form for creating the first admin. It
+// 404s as soon as any user exists.
+func setupHandler(w http.ResponseWriter, r *http.Request) {
+	setupMu.Lock()
+	defer setupMu.Unlock()
+
+	count, err := db.CountUsers()
+	if err != nil {
+		log.Printf("Error counting users: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if count > 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		renderSetup(w, http.StatusOK, SetupData{})
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, maxLoginBodyBytes)
+		if err := r.ParseForm(); err != nil {
+			renderSetup(w, http.StatusBadRequest, SetupData{Error: "Invalid form data"})
+			return
+		}
+
+		username := strings.TrimSpace(r.FormValue("username"))
+		password := r.FormValue("password")
+		data := SetupData{Username: username}
+
+		if err := validateNewCredentials(username, password); err != nil {
+			data.Error = err.Error()
+			renderSetup(w, http.StatusBadRequest, data)
+			return
+		}
+		if password != r.FormValue("confirm_password") {
+			data.Error = "Passwords do not match"
+			renderSetup(w, http.StatusBadRequest, data)
+			return
+		}
+
+		user, err := createFirstAdmin(username, password)
+		if err != nil {
+			log.Printf("Error creating first admin: %v", err)
+			data.Error = "Failed to create user"
+			renderSetup(w, http.StatusInternalServerError, data)
+			return
+		}
+
+		if err := auth.SetUserSession(w, r, user.ID, user.Username, user.SessionVersion); err != nil {
+			log.Printf("Error creating session: %v", err)
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, managementHome(), http.StatusSeeOther)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func renderSetup(w http.ResponseWriter, status int, data SetupData) {
+	tmpl, err := template.ParseFS(templatesFS, "templates/setup.html")
+	if err != nil {
+		http.Error(w, "Error loading template", http.StatusInternalServerError)
+		return
+	}
+
+	data.Title = "Setup - QR Linker"
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Render error: %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"qr-linker/auth"
+	"qr-linker/database"
+)
+
+// defaultStaleDays is how old a never-clicked link must be to be listed on
+// the stale links report when no days parameter is given.
+const defaultStaleDays = 30
+
+// maxBulkDeleteSize caps the number of links deleted in one request.
+const maxBulkDeleteSize = 1000
+
+// StaleData is passed to the stale links template.
+type StaleData struct {
+	Title    string
+	Days     int
+	URLs     []database.URL
+	Deleted  int
+	Error    string
+	Username string
+}
+
+// staleHandler serves /reports/stale, listing links created more than
+// ?days= days ago that have never been clicked, as a page or as JSON. POSTing
+// selected hashes deletes them.
+func staleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+
+	// Without click tracking every new link looks unclicked, so the report
+	// would offer links in use for deletion.
+	if !clickTracking {
+		respondError(w, r, http.StatusNotFound, errCodeNotFound, "The stale links report needs click tracking, which is turned off")
+		return
+	}
+
+	days := defaultStaleDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "days must be a non-negative number")
+			return
+		}
+		days = n
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+		if r.PostFormValue("confirm") == "" {
+			http.Error(w, "Deletion must be confirmed", http.StatusBadRequest)
+			return
+		}
+		hashes := r.PostForm["hash"]
+		if len(hashes) > maxBulkDeleteSize {
+			http.Error(w, fmt.Sprintf("At most %d links can be deleted at once", maxBulkDeleteSize), http.StatusBadRequest)
+			return
+		}
+
+		deleted, err := deleteLinks(r, hashes)
+		if err != nil {
+			log.Printf("Error deleting stale links: %v", err)
+			http.Error(w, "Failed to delete links", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/reports/stale?days=%d&deleted=%d", days, deleted), http.StatusSeeOther)
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	urls, err := db.GetStaleURLs(time.Duration(days) * 24 * time.Hour)
+	if err != nil {
+		log.Printf("Error fetching stale links: %v", err)
+		respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to load stale links")
+		return
+	}
+	if urls == nil {
+		urls = []database.URL{}
+	}
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"days": days,
+			"urls": urls,
+		})
+		return
+	}
+
+	tmpl, err := template.ParseFS(templatesFS, "templates/stale.html")
+	if err != nil {
+		http.Error(w, "Error loading template", http.StatusInternalServerError)
+		log.Printf("Template error: %v", err)
+		return
+	}
+
+	_, username, _ := auth.GetUserFromSession(r)
+	deleted, _ := strconv.Atoi(r.URL.Query().Get("deleted"))
+
+	data := StaleData{
+		Title:    "Stale Links - QR Linker",
+		Days:     days,
+		URLs:     urls,
+		Deleted:  deleted,
+		Username: username,
+	}
+	if len(urls) > maxBulkDeleteSize {
+		data.URLs = urls[:maxBulkDeleteSize]
+		data.Error = fmt.Sprintf("Showing the oldest %d of %d stale links.", maxBulkDeleteSize, len(urls))
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Render error: %v", err)
+	}
+}
+
+// bulkDeleteHandler deletes the links whose hashes are given as a JSON array.
+func bulkDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, r, http.StatusMethodNotAllowed, errCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var hashes []string
+	if err := json.NewDecoder(r.Body).Decode(&hashes); err != nil {
+		if isBodyTooLarge(err) {
+			respondError(w, r, http.StatusRequestEntityTooLarge, errCodeBodyTooLarge, "Request body too large")
+			return
+		}
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "Invalid JSON body")
+		return
+	}
+
+	if len(hashes) == 0 {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, "No hashes given")
+		return
+	}
+	if len(hashes) > maxBulkDeleteSize {
+		respondError(w, r, http.StatusBadRequest, errCodeInvalidRequest, fmt.Sprintf("At most %d links per request", maxBulkDeleteSize))
+		return
+	}
+
+	deleted, err := deleteLinks(r, hashes)
+	if err != nil {
+		log.Printf("Error applying bulk delete: %v", err)
+		respondError(w, r, http.StatusInternalServerError, errCodeInternal, "Failed to delete URLs")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"deleted": deleted})
+}
+
+// deleteLinks deletes the given links in one transaction and returns how
+// many existed.
+func deleteLinks(r *http.Request, hashes []string) (int, error) {
+	if len(hashes) == 0 {
+		return 0, nil
+	}
+
+	deleted, err := db.DeleteURLs(hashes)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i, ok := range deleted {
+		if !ok {
+			continue
+		}
+		count++
+		invalidateCachedURL(hashes[i])
+		recordAudit(r, database.AuditURLDeleted, hashes[i])
+	}
+
+	if count > 0 {
+		if err := counters.reconcile(); err != nil {
+			log.Printf("Error reconciling link counters: %v", err)
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,229 @@
+function copyToClipboard(text, button) {
+  navigator.clipboard
+    .writeText(text)
+    .then(function () {
+      const originalText = button.textContent;
+      button.textContent = "Copied!";
+      setTimeout(() => {
+        button.textContent = originalText;
+      }, 3000);
+    })
+    .catch(function (err) {
+      console.error("Failed to copy text: ", err);
+      button.textContent = "Failed";
+      setTimeout(() => {
+        button.textContent = "Copy";
+      }, 2000);
+    });
+}
+
+// Modal functionality
+const modal = document.getElementById("urlModal");
+const closeBtn = document.getElementsByClassName("close")[0];
+
+let currentShortHash = "";
+let currentOriginalUrl = "";
+let currentTitle = "";
+
+function showModal(shortHash, originalUrl, title, clicks, qrViews, created, lastClicked, updated, baseUrl) {
+  const shortUrl = baseUrl + "/" + shortHash;
+
+  // Store current values
+  currentShortHash = shortHash;
+  currentOriginalUrl = originalUrl;
+  currentTitle = title;
+
+  const modalShortUrlElement = document.getElementById("modalShortUrl");
+  modalShortUrlElement.textContent = shortUrl;
+  modalShortUrlElement.href = shortUrl;
+
+  document.getElementById("modalOriginalUrl").textContent = originalUrl;
+  document.getElementById("modalTitle").textContent = title;
+  document.getElementById("modalClicks").textContent = clicks;
+  document.getElementById("modalQRViews").textContent = qrViews;
+  document.getElementById("modalCreated").textContent = created;
+  document.getElementById("modalLastClicked").textContent = lastClicked;
+  document.getElementById("modalUpdated").textContent = updated;
+  document.getElementById("modalQrCode").src = "/qr/" + shortHash;
+  document.getElementById("modalStatsLink").href = "/stats/" + shortHash;
+
+  // Reset to display mode
+  document.getElementById("urlDisplayMode").style.display = "flex";
+  document.getElementById("urlEditMode").style.display = "none";
+
+  // Disable background scrolling
+  document.body.style.overflow = "hidden";
+
+  modal.style.display = "block";
+}
+
+function closeModal() {
+  // Re-enable background scrolling
+  document.body.style.overflow = "";
+  modal.style.display = "none";
+}
+
+closeBtn.onclick = function () {
+  closeModal();
+};
+
+window.onclick = function (event) {
+  if (event.target === modal) {
+    closeModal();
+  }
+};
+
+// Close modal with Escape key
+document.addEventListener("keydown", function (event) {
+  if (event.key === "Escape" && modal.style.display === "block") {
+    closeModal();
+  }
+});
+
+function closeSuccess() {
+  const successCard = document.getElementById("successCard");
+  if (successCard) {
+    successCard.style.display = "none";
+  }
+}
+
+function enableEditMode() {
+  document.getElementById("urlDisplayMode").style.display = "none";
+  document.getElementById("urlEditMode").style.display = "flex";
+  document.getElementById("editShortHash").value = currentShortHash;
+  document.getElementById("editUrlInput").value = currentOriginalUrl;
+  document.getElementById("editTitleInput").value = currentTitle;
+  document.getElementById("editResetClicks").checked = false;
+  const inputField = document.getElementById("editUrlInput");
+  inputField.focus();
+  inputField.select();
+}
+
+function cancelEdit() {
+  document.getElementById("urlDisplayMode").style.display = "flex";
+  document.getElementById("urlEditMode").style.display = "none";
+  document.getElementById("updateSuccess").style.display = "none";
+}
+
+function updateUrl(event) {
+  event.preventDefault();
+
+  const formData = new FormData(event.target);
+  const saveButton = event.target.querySelector(".btn-save");
+  const cancelButton = event.target.querySelector(".btn-cancel");
+  const originalSaveText = saveButton.textContent;
+
+  // Disable both buttons during request
+  saveButton.textContent = "Saving...";
+  saveButton.disabled = true;
+  cancelButton.disabled = true;
+
+  // Convert FormData to URLSearchParams for proper form encoding
+  const params = new URLSearchParams();
+  for (const [key, value] of formData.entries()) {
+    params.append(key, value);
+  }
+
+  fetch("/update", {
+    method: "POST",
+    headers: {
+      'Content-Type': 'application/x-www-form-urlencoded',
+      'Accept': 'application/json',
+    },
+    body: params
+  })
+  .then(response => {
+    return response.json().then(data => {
+      if (!response.ok) {
+        throw new Error(data.error ? data.error.message : "Failed to update URL");
+      }
+      return data;
+    });
+  })
+  .then(data => {
+    if (data.success) {
+      // Update the display with the new URL
+      const newUrl = params.get("new_url");
+      currentOriginalUrl = newUrl;
+      document.getElementById("modalOriginalUrl").textContent = newUrl;
+      currentTitle = data.title;
+      document.getElementById("modalTitle").textContent = data.title;
+      document.getElementById("modalUpdated").textContent = "Just now";
+      if (data.clicks_reset) {
+        document.getElementById("modalClicks").textContent = "0";
+        document.getElementById("modalLastClicked").textContent = "Never";
+      }
+
+      // Switch back to display mode immediately
+      document.getElementById("urlDisplayMode").style.display = "flex";
+      document.getElementById("urlEditMode").style.display = "none";
+
+      // Show success message
+      const successDiv = document.getElementById("updateSuccess");
+      successDiv.style.display = "flex";
+
+      // Hide success message after 2 seconds
+      setTimeout(() => {
+        successDiv.style.display = "none";
+      }, 2000);
+    } else {
+      throw new Error("Update failed");
+    }
+  })
+  .catch(error => {
+    console.error("Error updating URL:", error);
+    alert(error.message || "Failed to update URL. Please try again.");
+    // Re-enable buttons on error
+    saveButton.textContent = originalSaveText;
+    saveButton.disabled = false;
+    cancelButton.disabled = false;
+  });
+}
+
+// Handlers are attached here rather than inline so the page works under the
+// default Content-Security-Policy, which blocks inline scripts.
+document.addEventListener("click", function (event) {
+  const copyButton = event.target.closest("[data-copy], [data-copy-from]");
+  if (copyButton) {
+    const text = copyButton.dataset.copyFrom
+      ? document.getElementById(copyButton.dataset.copyFrom).textContent
+      : copyButton.dataset.copy;
+    copyToClipboard(text, copyButton);
+    return;
+  }
+
+  // Links inside a row open normally instead of showing the modal.
+  const row = event.target.closest(".clickable-row");
+  if (row && !event.target.closest("a")) {
+    const d = row.dataset;
+    const baseUrl = row.closest("table").dataset.base;
+    showModal(d.hash, d.destination, d.title, d.clicks, d.qrViews, d.created, d.lastClicked, d.updated, baseUrl);
+  }
+});
+
+const closeSuccessButton = document.querySelector(".close-success");
+if (closeSuccessButton) {
+  closeSuccessButton.addEventListener("click", closeSuccess);
+}
+document.querySelector("#urlDisplayMode .btn-edit").addEventListener("click", enableEditMode);
+document.querySelector("#urlEditMode .btn-cancel").addEventListener("click", cancelEdit);
+document.getElementById("updateUrlForm").addEventListener("submit", updateUrl);
+
+// Prefill the title from the destination page unless one was typed.
+document.getElementById("url-input").addEventListener("change", function () {
+  const titleInput = document.getElementById("title-input");
+  const url = this.value.trim();
+  if (!url || titleInput.value.trim() !== "") {
+    return;
+  }
+
+  fetch("/api/v1/preview-meta?url=" + encodeURIComponent(url))
+    .then(response => (response.ok ? response.json() : null))
+    .then(meta => {
+      const title = meta && (meta.og_title || meta.title);
+      if (title && titleInput.value.trim() === "") {
+        titleInput.value = title.slice(0, 200);
+      }
+    })
+    .catch(error => console.error("Error fetching link preview:", error));
+});
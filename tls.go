@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsDomains are the hosts to obtain Let's Encrypt certificates for, from
+// TLS_DOMAIN. When empty the server speaks plain HTTP on PORT.
+var (
+	tlsDomains  []string
+	tlsCacheDir string
+)
+
+// newCertManager returns an autocert manager that obtains certificates for
+// tlsDomains and the vanity domains, caching them in tlsCacheDir so restarts
+// don't hit Let's Encrypt rate limits.
+func newCertManager() *autocert.Manager {
+	hosts := append(append([]string{}, tlsDomains...), vanityDomains...)
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(hosts...),
+		Cache:      autocert.DirCache(tlsCacheDir),
+	}
+}
+
+// newRedirectServer serves port 80 in TLS mode: it answers ACME HTTP-01
+// challenges and redirects everything else to HTTPS.
+func newRedirectServer(m *autocert.Manager) *http.Server {
+	return &http.Server{
+		Addr:              ":http",
+		Handler:           m.HTTPHandler(nil),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
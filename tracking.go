@@ -0,0 +1,49 @@
+package main
+
+import (
+	"time"
+
+	"qr-linker/database"
+)
+
+// clickTracking is turned off by DISABLE_CLICK_TRACKING, for deployments
+// that don't want any record of visits. Redirects then don't count clicks,
+// update the last-clicked time, record click events or set scan cookies,
+// and click figures are left out of pages, exports and API responses.
+// Counts from before it was turned off stay in the database and show again
+// if it's turned back on.
+var clickTracking = true
+
+// untrackedURL is a link as shown with click tracking off. The nil shadowing
+// fields hide its click figures from JSON output.
+type untrackedURL struct {
+	*database.URL
+	Clicks        *int       `json:"clicks,omitempty"`
+	LastClickedAt *time.Time `json:"last_clicked_at,omitempty"`
+}
+
+// trackedURLView returns url for serializing, without its click figures when
+// click tracking is off.
+func trackedURLView(url *database.URL) any {
+	if !clickTracking {
+		return untrackedURL{URL: url}
+	}
+	return url
+}
+
+// dashboardView is the dashboard response with click tracking off: the
+// click total and the most clicked link are left out.
+type dashboardView struct {
+	*database.DashboardStats
+	TotalClicks *int          `json:"total_clicks,omitempty"`
+	TopLink     *database.URL `json:"top_link,omitempty"`
+}
+
+// trackedDashboardView returns stats for serializing, without click figures
+// when click tracking is off.
+func trackedDashboardView(stats *database.DashboardStats) any {
+	if !clickTracking {
+		return dashboardView{DashboardStats: stats}
+	}
+	return stats
+}
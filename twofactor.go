@@ -0,0 +1,374 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"qr-linker/auth"
+	"qr-linker/database"
+	"qr-linker/qrgen"
+)
+
+// totpIssuer names the account in authenticator apps.
+const totpIssuer = "QR Linker"
+
+// Two-factor attempt limits. The session cookie can be replayed, so failures
+// are counted here rather than in the session.
+const (
+	maxTwoFactorFailures = 5
+	twoFactorLockout     = 15 * time.Minute
+)
+
+// enrollSecretKey is the session key holding the secret being enrolled until
+// the user confirms it with a code.
+const enrollSecretKey = "totp_enroll_secret"
+
+type TwoFactorData struct {
+	Title          string
+	Username       string
+	Enabled        bool
+	QRCode         template.URL
+	Secret         string
+	RecoveryCodes  []string
+	RemainingCodes int
+	Error          string
+	Message        string
+}
+
+// twoFactorFailures counts failed two-factor codes per user and locks the
+// second step after too many in a row.
+type twoFactorFailures struct {
+	mu      sync.Mutex
+	entries map[int]*twoFactorFailure
+}
+
+type twoFactorFailure struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+var twoFactorAttempts = twoFactorFailures{entries: make(map[int]*twoFactorFailure)}
+
+// locked reports whether userID has to wait before trying another code.
+func (f *twoFactorFailures) locked(userID int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry, ok := f.entries[userID]
+	return ok && time.Now().Before(entry.lockedUntil)
+}
+
+// fail records a failed code, starting a lockout once the limit is reached.
+// The count starts again after a lockout ends, or when the previous failure
+// is more than twoFactorLockout old, so occasional typos don't add up.
+func (f *twoFactorFailures) fail(userID int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := f.entries[userID]
+	if !ok || (!entry.lockedUntil.IsZero() && now.After(entry.lockedUntil)) || now.Sub(entry.lastFailure) > twoFactorLockout {
+		entry = &twoFactorFailure{}
+		f.entries[userID] = entry
+	}
+	entry.count++
+	entry.lastFailure = now
+	if entry.count >= maxTwoFactorFailures {
+		entry.lockedUntil = now.Add(twoFactorLockout)
+	}
+}
+
+func (f *twoFactorFailures) reset(userID int) {
+	f.mu.Lock()
+	delete(f.entries, userID)
+	f.mu.Unlock()
+}
+
+// checkSecondFactor reports whether code is a current TOTP code or an unused
+// recovery code for user. A matching recovery code is used up, and a TOTP
+// code is refused if it, or a later one, has already been accepted.
+func checkSecondFactor(user *database.User, code string) (bool, error) {
+	if step, ok := auth.MatchTOTP(user.TOTPSecret, code, time.Now()); ok {
+		return db.UseTOTPStep(user.ID, step)
+	}
+	if strings.TrimSpace(code) == "" {
+		return false, nil
+	}
+	return db.UseRecoveryCode(user.ID, auth.HashRecoveryCode(code))
+}
+
+// renderTwoFactorPrompt shows the code step of the login page.
+func renderTwoFactorPrompt(w http.ResponseWriter, r *http.Request, status int, errorMsg string) {
+	tmpl, err := template.ParseFS(templatesFS, "templates/login.html")
+	if err != nil {
+		http.Error(w, "Error loading template", http.StatusInternalServerError)
+		return
+	}
+
+	data := LoginData{
+		Title:     "Two-Factor Authentication - QR Linker",
+		Error:     errorMsg,
+		TwoFactor: true,
+	}
+	if target := loginRedirectTarget(r.FormValue("next")); target != managementHome() {
+		data.Next = target
+	}
+
+	w.WriteHeader(status)
+	tmpl.Execute(w, data)
+}
+
+// loginTwoFactorHandler completes a login for users with two-factor
+// authentication enabled, after loginHandler has checked their password.
+func loginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxLoginBodyBytes)
+	if err := r.ParseForm(); err != nil {
+		renderTwoFactorPrompt(w, r, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	userID, ok := auth.PendingLogin(r)
+	if !ok {
+		renderLoginError(w, r, http.StatusUnauthorized, "Your login has expired. Please enter your password again.")
+		return
+	}
+
+	if twoFactorAttempts.locked(userID) {
+		renderTwoFactorPrompt(w, r, http.StatusTooManyRequests, "Too many incorrect codes. Please try again later.")
+		return
+	}
+
+	user, err := db.GetUserByID(userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			renderLoginError(w, r, http.StatusUnauthorized, "Invalid username or password")
+		} else {
+			log.Printf("Database error: %v", err)
+			renderTwoFactorPrompt(w, r, http.StatusInternalServerError, "An error occurred. Please try again.")
+		}
+		return
+	}
+
+	valid, err := checkSecondFactor(user, r.FormValue("code"))
+	if err != nil {
+		log.Printf("Error checking two-factor code: %v", err)
+		renderTwoFactorPrompt(w, r, http.StatusInternalServerError, "An error occurred. Please try again.")
+		return
+	}
+	if !valid {
+		twoFactorAttempts.fail(userID)
+		renderTwoFactorPrompt(w, r, http.StatusUnauthorized, "Invalid authentication code")
+		return
+	}
+	twoFactorAttempts.reset(userID)
+
+	if err := auth.SetUserSession(w, r, user.ID, user.Username, user.SessionVersion); err != nil {
+		log.Printf("Session error: %v", err)
+		renderTwoFactorPrompt(w, r, http.StatusInternalServerError, "Failed to create session")
+		return
+	}
+
+	http.Redirect(w, r, loginRedirectTarget(r.FormValue("next")), http.StatusSeeOther)
+}
+
+// twoFactorHandler serves /account/2fa, where users enable or disable
+// two-factor authentication for their own account.
+func twoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+
+	userID, _, ok := auth.GetUserFromSession(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	user, err := db.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Error loading user: %v", err)
+		http.Error(w, "Error loading account", http.StatusInternalServerError)
+		return
+	}
+
+	data := TwoFactorData{
+		Title:    "Two-Factor Authentication - QR Linker",
+		Username: user.Username,
+		Enabled:  user.TOTPSecret != "",
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		switch r.FormValue("action") {
+		case "enable":
+			codes, msg := enableTwoFactor(w, r, user)
+			if codes == nil {
+				data.Error = msg
+				break
+			}
+			data.Enabled = true
+			data.RecoveryCodes = codes
+			data.Message = msg
+		case "disable":
+			if msg := disableTwoFactor(r, user); msg != "" {
+				data.Error = msg
+				break
+			}
+			data.Enabled = false
+			data.Message = "Two-factor authentication is now disabled."
+		default:
+			data.Error = "Unknown action"
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if data.Enabled {
+		remaining, err := db.CountRecoveryCodes(user.ID)
+		if err != nil {
+			log.Printf("Error counting recovery codes: %v", err)
+		}
+		data.RemainingCodes = remaining
+	} else if err := prepareEnrollment(w, r, user, &data); err != nil {
+		log.Printf("Error preparing two-factor enrollment: %v", err)
+		http.Error(w, "Error preparing two-factor setup", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := template.ParseFS(templatesFS, "templates/twofactor.html")
+	if err != nil {
+		http.Error(w, "Error loading template", http.StatusInternalServerError)
+		log.Printf("Template error: %v", err)
+		return
+	}
+
+	if data.Error != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Render error: %v", err)
+	}
+}
+
+// prepareEnrollment fills in the QR code and secret for a user setting up
+// two-factor authentication. The pending secret is kept in the session so
+// reloading the page doesn't invalidate a code that was already scanned.
+func prepareEnrollment(w http.ResponseWriter, r *http.Request, user *database.User, data *TwoFactorData) error {
+	session, err := auth.GetSession(r)
+	if err != nil {
+		return err
+	}
+
+	secret, _ := session.Values[enrollSecretKey].(string)
+	if secret == "" {
+		secret, err = auth.GenerateTOTPSecret()
+		if err != nil {
+			return err
+		}
+		session.Values[enrollSecretKey] = secret
+		if err := auth.SaveSession(w, r, session); err != nil {
+			return err
+		}
+	}
+
+	png, err := qrgen.PNG(auth.TOTPURI(totpIssuer, user.Username, secret), defaultQROptions())
+	if err != nil {
+		return err
+	}
+
+	data.Secret = secret
+	data.QRCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+	return nil
+}
+
+// enableTwoFactor confirms the pending secret with a code and turns on
+// two-factor authentication. It returns the new recovery codes, or nil and
+// an error message.
+func enableTwoFactor(w http.ResponseWriter, r *http.Request, user *database.User) ([]string, string) {
+	if user.TOTPSecret != "" {
+		return nil, "Two-factor authentication is already enabled"
+	}
+
+	session, err := auth.GetSession(r)
+	if err != nil {
+		return nil, "Failed to read session"
+	}
+	secret, _ := session.Values[enrollSecretKey].(string)
+	if secret == "" {
+		return nil, "Your setup has expired. Please scan the new code."
+	}
+
+	step, ok := auth.MatchTOTP(secret, r.FormValue("code"), time.Now())
+	if !ok {
+		return nil, "Invalid authentication code"
+	}
+
+	codes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v", err)
+		return nil, "Failed to generate recovery codes"
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+
+	if err := db.EnableTOTP(user.ID, secret, hashes); err != nil {
+		log.Printf("Error enabling two-factor authentication: %v", err)
+		return nil, "Failed to enable two-factor authentication"
+	}
+	// The confirmation code can't then be replayed to log in.
+	if _, err := db.UseTOTPStep(user.ID, step); err != nil {
+		log.Printf("Error recording two-factor code: %v", err)
+	}
+
+	delete(session.Values, enrollSecretKey)
+	if err := auth.SaveSession(w, r, session); err != nil {
+		log.Printf("Error saving session: %v", err)
+	}
+
+	recordAudit(r, database.AuditTOTPEnabled, user.Username)
+	return codes, "Two-factor authentication is now enabled. Save these recovery codes somewhere safe; they won't be shown again."
+}
+
+// disableTwoFactor turns off two-factor authentication after checking a
+// current code or recovery code. It returns an error message on failure.
+func disableTwoFactor(r *http.Request, user *database.User) string {
+	if user.TOTPSecret == "" {
+		return "Two-factor authentication is not enabled"
+	}
+	if twoFactorAttempts.locked(user.ID) {
+		return "Too many incorrect codes. Please try again later."
+	}
+
+	valid, err := checkSecondFactor(user, r.FormValue("code"))
+	if err != nil {
+		log.Printf("Error checking two-factor code: %v", err)
+		return "An error occurred. Please try again."
+	}
+	if !valid {
+		twoFactorAttempts.fail(user.ID)
+		return "Invalid authentication code"
+	}
+	twoFactorAttempts.reset(user.ID)
+
+	if err := db.DisableTOTP(user.ID); err != nil {
+		log.Printf("Error disabling two-factor authentication: %v", err)
+		return "Failed to disable two-factor authentication"
+	}
+
+	recordAudit(r, database.AuditTOTPDisabled, user.Username)
+	return ""
+}
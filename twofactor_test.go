@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTwoFactorFailuresExpire(t *testing.T) {
+	f := twoFactorFailures{entries: make(map[int]*twoFactorFailure)}
+
+	for i := 0; i < maxTwoFactorFailures-1; i++ {
+		f.fail(1)
+	}
+	if f.locked(1) {
+		t.Fatal("locked before reaching the limit")
+	}
+
+	// Failures older than the window are forgotten.
+	f.entries[1].lastFailure = time.Now().Add(-twoFactorLockout - time.Minute)
+	f.fail(1)
+	if f.locked(1) || f.entries[1].count != 1 {
+		t.Errorf("after a stale failure: locked = %v, count = %d, want unlocked with count 1", f.locked(1), f.entries[1].count)
+	}
+
+	for i := 1; i < maxTwoFactorFailures; i++ {
+		f.fail(1)
+	}
+	if !f.locked(1) {
+		t.Error("not locked after reaching the limit within the window")
+	}
+}
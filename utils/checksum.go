@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"hash/crc32"
+	"strings"
+)
+
+// checksumAlphabet holds the characters a checksum can be. It has no upper
+// case letters, so checksums still validate when hashes are matched
+// case-insensitively.
+const checksumAlphabet = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// checksumChar returns the checksum character of hash, computed from a CRC
+// of its lowercased form.
+func checksumChar(hash string) string {
+	sum := crc32.ChecksumIEEE([]byte(strings.ToLower(hash)))
+	return string(checksumAlphabet[sum%uint32(len(checksumAlphabet))])
+}
+
+// AddChecksum appends the checksum character of hash to it.
+func AddChecksum(hash string) string {
+	return hash + checksumChar(hash)
+}
+
+// ValidateChecksum reports whether hash ends in the checksum character of
+// the rest of it, ignoring case. A mistyped or guessed hash fails the check
+// with a probability of 35 in 36.
+func ValidateChecksum(hash string) bool {
+	if len(hash) < 2 {
+		return false
+	}
+	body, check := hash[:len(hash)-1], hash[len(hash)-1:]
+	return strings.EqualFold(check, checksumChar(body))
+}
+
+// GenerateChecksummedHash returns a random hash followed by its checksum
+// character.
+func GenerateChecksummedHash() (string, error) {
+	hash, err := GenerateShortHash()
+	if err != nil {
+		return "", err
+	}
+	return AddChecksum(hash), nil
+}
+
+// GenerateUniqueChecksummedHash is GenerateUniqueHash for hashes ending in a
+// checksum character. checkExists is called with the checksummed hash.
+func GenerateUniqueChecksummedHash(checkExists func(string) (bool, error)) (string, error) {
+	hash, err := GenerateUniqueHash(func(hash string) (bool, error) {
+		return checkExists(AddChecksum(hash))
+	})
+	if err != nil || hash == "" {
+		return hash, err
+	}
+	return AddChecksum(hash), nil
+}
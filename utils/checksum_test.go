@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		hash, err := GenerateChecksummedHash()
+		if err != nil {
+			t.Fatalf("GenerateChecksummedHash: %v", err)
+		}
+		if !ValidateChecksum(hash) {
+			t.Errorf("ValidateChecksum(%q) = false for a generated hash", hash)
+		}
+		if !ValidateChecksum(strings.ToUpper(hash)) {
+			t.Errorf("ValidateChecksum(%q) = false, want case to be ignored", strings.ToUpper(hash))
+		}
+	}
+
+	hash := AddChecksum("abc123")
+	if !ValidateChecksum(hash) {
+		t.Fatalf("ValidateChecksum(%q) = false", hash)
+	}
+	tampered := []string{"", "a", "abc123", "abc124" + hash[6:], "xbc123" + hash[6:]}
+	for _, c := range checksumAlphabet {
+		if string(c) != hash[6:] {
+			tampered = append(tampered, "abc123"+string(c))
+		}
+	}
+	for _, h := range tampered {
+		if ValidateChecksum(h) {
+			t.Errorf("ValidateChecksum(%q) = true, want false", h)
+		}
+	}
+}
+
+func TestGenerateUniqueChecksummedHash(t *testing.T) {
+	var checked []string
+	hash, err := GenerateUniqueChecksummedHash(func(h string) (bool, error) {
+		checked = append(checked, h)
+		return len(checked) == 1, nil
+	})
+	if err != nil {
+		t.Fatalf("GenerateUniqueChecksummedHash: %v", err)
+	}
+	if len(checked) != 2 || hash != checked[1] {
+		t.Errorf("got %q after checking %q, want the second checked hash", hash, checked)
+	}
+	for _, h := range checked {
+		if !ValidateChecksum(h) {
+			t.Errorf("checkExists got %q without a valid checksum", h)
+		}
+	}
+}
@@ -8,7 +8,9 @@ import (
 
 const (
 	hashLength = 6
-	maxRetries = 5
+	// MaxHashRetries is how many default-length hashes GenerateUniqueHash
+	// tries before falling back to longer ones.
+	MaxHashRetries = 5
 )
 
 func GenerateShortHash() (string, error) {
@@ -30,19 +32,31 @@ func GenerateShortHash() (string, error) {
 }
 
 func GenerateUniqueHash(checkExists func(string) (bool, error)) (string, error) {
-	for i := 0; i < maxRetries; i++ {
+	hash, _, err := GenerateUniqueHashAttempts(checkExists)
+	return hash, err
+}
+
+// GenerateUniqueHashAttempts is GenerateUniqueHash that also returns how many
+// hashes were tried, including the one returned. More than MaxHashRetries
+// means every default-length try was taken and a longer hash was used, a
+// sign the namespace is filling up. An empty hash with a nil error means
+// none of the tries was free.
+func GenerateUniqueHashAttempts(checkExists func(string) (bool, error)) (string, int, error) {
+	attempts := 0
+	for i := 0; i < MaxHashRetries; i++ {
 		hash, err := GenerateShortHash()
 		if err != nil {
-			return "", err
+			return "", attempts, err
 		}
 		
+		attempts++
 		exists, err := checkExists(hash)
 		if err != nil {
-			return "", err
+			return "", attempts, err
 		}
 		
 		if !exists {
-			return hash, nil
+			return hash, attempts, nil
 		}
 	}
 	
@@ -50,7 +64,7 @@ func GenerateUniqueHash(checkExists func(string) (bool, error)) (string, error)
 		bytes := make([]byte, length)
 		_, err := rand.Read(bytes)
 		if err != nil {
-			return "", err
+			return "", attempts, err
 		}
 		
 		hash := base64.URLEncoding.EncodeToString(bytes)
@@ -59,15 +73,22 @@ func GenerateUniqueHash(checkExists func(string) (bool, error)) (string, error)
 			hash = hash[:length]
 		}
 		
+		attempts++
 		exists, err := checkExists(hash)
 		if err != nil {
-			return "", err
+			return "", attempts, err
 		}
 		
 		if !exists {
-			return hash, nil
+			return hash, attempts, nil
 		}
 	}
 	
-	return "", nil
-}
\ No newline at end of file
+	return "", attempts, nil
+}
+
+// HashFromPath returns the short hash a request path refers to. A single
+// trailing slash is ignored, so "/abc/" resolves to "abc".
+func HashFromPath(path string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(path, "/"), "/")
+}
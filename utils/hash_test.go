@@ -0,0 +1,40 @@
+package utils
+
+import "testing"
+
+func TestHashFromPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/abc", "abc"},
+		{"/abc/", "abc"},
+		{"/ABC", "ABC"},
+		{"/abc//", "abc/"},
+		{"/", ""},
+	}
+
+	for _, tt := range tests {
+		if got := HashFromPath(tt.path); got != tt.want {
+			t.Errorf("HashFromPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateUniqueHashAttempts(t *testing.T) {
+	hash, attempts, err := GenerateUniqueHashAttempts(func(string) (bool, error) { return false, nil })
+	if err != nil || len(hash) != hashLength || attempts != 1 {
+		t.Errorf("with no collisions = %q, %d, %v, want a %d character hash on the first attempt", hash, attempts, err, hashLength)
+	}
+
+	// Every default-length hash is taken, so the first longer one is used.
+	hash, attempts, err = GenerateUniqueHashAttempts(func(h string) (bool, error) { return len(h) == hashLength, nil })
+	if err != nil || len(hash) != hashLength+1 || attempts != MaxHashRetries+1 {
+		t.Errorf("with default lengths taken = %q, %d, %v, want a longer hash after %d attempts", hash, attempts, err, MaxHashRetries+1)
+	}
+
+	hash, attempts, err = GenerateUniqueHashAttempts(func(string) (bool, error) { return true, nil })
+	if err != nil || hash != "" || attempts != MaxHashRetries+4 {
+		t.Errorf("with everything taken = %q, %d, %v, want no hash after %d attempts", hash, attempts, err, MaxHashRetries+4)
+	}
+}
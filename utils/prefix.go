@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+)
+
+// MaxPrefixLength is the longest hash prefix accepted by ValidateHashPrefix.
+const MaxPrefixLength = 16
+
+// MaxHashLength is the longest hash accepted by ValidateHash.
+const MaxHashLength = 64
+
+// PrefixSeparator joins a hash prefix to the generated hash.
+const PrefixSeparator = "-"
+
+var (
+	ErrPrefixTooLong  = errors.New("prefix must be at most 16 characters")
+	ErrPrefixInvalid  = errors.New("prefix may only contain letters, digits and underscores")
+	ErrPrefixReserved = errors.New("prefix is reserved")
+
+	ErrHashEmpty    = errors.New("hash is required")
+	ErrHashTooLong  = errors.New("hash must be at most 64 characters")
+	ErrHashInvalid  = errors.New("hash may only contain letters, digits, hyphens and underscores")
+	ErrHashReserved = errors.New("hash is reserved")
+)
+
+// reservedPrefixes are top-level route names that a prefix may not use, so
+// prefixed links can't be confused with the app's own pages.
+var reservedPrefixes = []string{
+	"account", "admin", "api", "audit", "beacon", "campaigns", "edit",
+	"export", "healthz", "import", "login", "logout", "new", "preview", "qr",
+	"reports", "s", "setup", "shorten", "static", "stats", "update",
+}
+
+// ValidateHashPrefix trims raw and checks it is usable as a short-hash
+// namespace. An empty prefix is valid and means no namespace.
+func ValidateHashPrefix(raw string) (string, error) {
+	prefix := strings.TrimSpace(raw)
+	if prefix == "" {
+		return "", nil
+	}
+
+	if len(prefix) > MaxPrefixLength {
+		return "", ErrPrefixTooLong
+	}
+
+	for _, c := range prefix {
+		isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isAlnum && c != '_' {
+			return "", ErrPrefixInvalid
+		}
+	}
+
+	for _, reserved := range reservedPrefixes {
+		if strings.EqualFold(prefix, reserved) {
+			return "", ErrPrefixReserved
+		}
+	}
+
+	return prefix, nil
+}
+
+// ValidateHash checks that a user-chosen hash is well formed and doesn't
+// shadow one of the app's routes. It doesn't check whether it is taken.
+func ValidateHash(hash string) error {
+	if hash == "" {
+		return ErrHashEmpty
+	}
+	if len(hash) > MaxHashLength {
+		return ErrHashTooLong
+	}
+
+	for _, c := range hash {
+		isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isAlnum && c != '_' && c != '-' {
+			return ErrHashInvalid
+		}
+	}
+
+	for _, reserved := range reservedPrefixes {
+		if strings.EqualFold(hash, reserved) {
+			return ErrHashReserved
+		}
+	}
+
+	return nil
+}
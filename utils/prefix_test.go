@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateHashPrefix(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr error
+	}{
+		{"", "", nil},
+		{"  promo ", "promo", nil},
+		{"Spring_24", "Spring_24", nil},
+		{"abcdefghijklmnopq", "", ErrPrefixTooLong},
+		{"pro-mo", "", ErrPrefixInvalid},
+		{"a/b", "", ErrPrefixInvalid},
+		{"admin", "", ErrPrefixReserved},
+		{"QR", "", ErrPrefixReserved},
+	}
+
+	for _, tt := range tests {
+		got, err := ValidateHashPrefix(tt.raw)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("ValidateHashPrefix(%q) error = %v, want %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ValidateHashPrefix(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestValidateHash(t *testing.T) {
+	tests := []struct {
+		hash string
+		want error
+	}{
+		{"abc123", nil},
+		{"promo-Xy3_aB", nil},
+		{"", ErrHashEmpty},
+		{strings.Repeat("a", 65), ErrHashTooLong},
+		{"a/b", ErrHashInvalid},
+		{"a.b", ErrHashInvalid},
+		{"Login", ErrHashReserved},
+		{"setup", ErrHashReserved},
+		{"campaigns", ErrHashReserved},
+		{"reports", ErrHashReserved},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateHash(tt.hash); !errors.Is(err, tt.want) {
+			t.Errorf("ValidateHash(%q) = %v, want %v", tt.hash, err, tt.want)
+		}
+	}
+}
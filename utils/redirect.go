@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+)
+
+// SafeRedirectPath reports whether raw is safe to use as a redirect target,
+// returning the path unchanged if so. Only local paths are permitted: they
+// must start with a single "/", contain no backslashes or control characters
+// (browsers normalise "/\evil.com" and "/\t/evil.com" to "//evil.com"), and
+// must not carry a scheme or host.
+func SafeRedirectPath(raw string) (string, bool) {
+	if !strings.HasPrefix(raw, "/") || strings.HasPrefix(raw, "//") {
+		return "", false
+	}
+
+	for _, c := range raw {
+		if c == '\\' || c < 0x20 || c == 0x7f {
+			return "", false
+		}
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return "", false
+	}
+
+	return raw, true
+}
@@ -0,0 +1,42 @@
+package utils
+
+import "testing"
+
+func TestSafeRedirectPath(t *testing.T) {
+	valid := []string{
+		"/",
+		"/admin",
+		"/stats/abc?x=1",
+		"/stats/abc#events",
+		"/a/b/../c",
+	}
+	for _, raw := range valid {
+		got, ok := SafeRedirectPath(raw)
+		if !ok || got != raw {
+			t.Errorf("SafeRedirectPath(%q) = %q, %v, want unchanged", raw, got, ok)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"//evil.com",
+		"///evil.com",
+		"/\\evil.com",
+		"/\\/evil.com",
+		"\\\\evil.com",
+		"/\t/evil.com",
+		"/\n/evil.com",
+		"/\x00",
+		"/\x7f",
+		"https://evil.com",
+		"http:/evil.com",
+		"javascript:alert(1)",
+		"evil.com",
+		"stats/abc",
+	}
+	for _, raw := range invalid {
+		if got, ok := SafeRedirectPath(raw); ok || got != "" {
+			t.Errorf("SafeRedirectPath(%q) = %q, %v, want rejected", raw, got, ok)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrEmptyURL           = errors.New("URL is required")
+	ErrMissingScheme      = errors.New("URL must include a scheme such as https://")
+	ErrInvalidURL         = errors.New("URL is not valid")
+	ErrSchemeNotAllowed   = errors.New("URL scheme is not allowed")
+	ErrSchemeNotSupported = errors.New("scheme can't be allowed")
+)
+
+// blockedSchemes run code or embed content in the browser and are never
+// accepted as destinations.
+var blockedSchemes = []string{"javascript", "vbscript", "data"}
+
+// NormalizeURL trims raw and validates it as a link destination. With
+// autoPrependScheme, input not starting with http://, https:// or one of
+// allowedSchemes is prefixed with https://. Without it, the scheme must be
+// given explicitly, which allows intranet and custom-scheme links to be
+// stored unchanged; when allowedSchemes is given, only those and http(s) are
+// accepted. javascript:, vbscript: and data: URLs are always refused.
+func NormalizeURL(raw string, autoPrependScheme bool, allowedSchemes ...string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", ErrEmptyURL
+	}
+
+	if autoPrependScheme {
+		if strings.HasPrefix(raw, "http://") || strings.HasPrefix(raw, "https://") {
+			return raw, nil
+		}
+		scheme, _, found := strings.Cut(raw, ":")
+		if !found || !slices.Contains(allowedSchemes, strings.ToLower(scheme)) {
+			return "https://" + raw, nil
+		}
+		// An allowed non-HTTP scheme is validated and stored as given.
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", ErrInvalidURL
+	}
+	if u.Scheme == "" {
+		return "", ErrMissingScheme
+	}
+	if slices.Contains(blockedSchemes, u.Scheme) {
+		return "", ErrSchemeNotAllowed
+	}
+	if !IsHTTPURL(raw) && len(allowedSchemes) > 0 && !slices.Contains(allowedSchemes, u.Scheme) {
+		return "", ErrSchemeNotAllowed
+	}
+	if (u.Scheme == "http" || u.Scheme == "https") && u.Host == "" {
+		return "", ErrInvalidURL
+	}
+	if u.Host == "" && u.Opaque == "" && u.Path == "" {
+		return "", ErrInvalidURL
+	}
+
+	return raw, nil
+}
+
+// IsHTTPURL reports whether raw is an http or https URL, i.e. a destination
+// browsers can be redirected to.
+func IsHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// ParseSchemes reads a comma-separated list of URL schemes, lowercased and
+// without trailing colons. http and https are always allowed and are
+// dropped; schemes that can run code are an error.
+func ParseSchemes(raw string) ([]string, error) {
+	var schemes []string
+	for _, s := range strings.Split(raw, ",") {
+		s = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(s), ":"))
+		if s == "" || s == "http" || s == "https" {
+			continue
+		}
+		if u, err := url.Parse(s + ":x"); err != nil || u.Scheme != s {
+			return nil, fmt.Errorf("%q is not a valid scheme", s)
+		}
+		if slices.Contains(blockedSchemes, s) {
+			return nil, fmt.Errorf("%q: %w", s, ErrSchemeNotSupported)
+		}
+		if !slices.Contains(schemes, s) {
+			schemes = append(schemes, s)
+		}
+	}
+	return schemes, nil
+}
+
+// RedactURL reduces raw to its scheme, host and path for logging, dropping
+// the query string, fragment and any user credentials, which can hold
+// tokens or personal data. URLs without a host, such as mailto: links, keep
+// only their scheme, and unparseable values are replaced entirely.
+func RedactURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "[invalid URL]"
+	}
+	if u.Opaque != "" {
+		return u.Scheme + ":[redacted]"
+	}
+
+	u.User = nil
+	u.RawQuery = ""
+	u.ForceQuery = false
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String()
+}